@@ -29,6 +29,8 @@ const (
 	CMD_Status    CMD = 3
 	CMD_Assign    CMD = 4
 	CMD_Interrupt CMD = 5
+	CMD_FetchFunc CMD = 6
+	CMD_FuncData  CMD = 7
 )
 
 // Enum value maps for CMD.
@@ -40,6 +42,8 @@ var (
 		3: "Status",
 		4: "Assign",
 		5: "Interrupt",
+		6: "FetchFunc",
+		7: "FuncData",
 	}
 	CMD_value = map[string]int32{
 		"Unknown":   0,
@@ -48,6 +52,8 @@ var (
 		"Status":    3,
 		"Assign":    4,
 		"Interrupt": 5,
+		"FetchFunc": 6,
+		"FuncData":  7,
 	}
 )
 
@@ -179,6 +185,61 @@ func (TaskStatus) EnumDescriptor() ([]byte, []int) {
 	return file_api_proto_rawDescGZIP(), []int{2}
 }
 
+type ContentType int32
+
+const (
+	ContentType_Text    ContentType = 0
+	ContentType_Raw     ContentType = 1
+	ContentType_Json    ContentType = 2
+	ContentType_Any     ContentType = 3
+	ContentType_Msgpack ContentType = 4
+)
+
+// Enum value maps for ContentType.
+var (
+	ContentType_name = map[int32]string{
+		0: "Text",
+		1: "Raw",
+		2: "Json",
+		3: "Any",
+		4: "Msgpack",
+	}
+	ContentType_value = map[string]int32{
+		"Text":    0,
+		"Raw":     1,
+		"Json":    2,
+		"Any":     3,
+		"Msgpack": 4,
+	}
+)
+
+func (x ContentType) Enum() *ContentType {
+	p := new(ContentType)
+	*p = x
+	return p
+}
+
+func (x ContentType) String() string {
+	return protoimpl.X.EnumStringOf(x.Descriptor(), protoreflect.EnumNumber(x))
+}
+
+func (ContentType) Descriptor() protoreflect.EnumDescriptor {
+	return file_api_proto_enumTypes[3].Descriptor()
+}
+
+func (ContentType) Type() protoreflect.EnumType {
+	return &file_api_proto_enumTypes[3]
+}
+
+func (x ContentType) Number() protoreflect.EnumNumber {
+	return protoreflect.EnumNumber(x)
+}
+
+// Deprecated: Use ContentType.Descriptor instead.
+func (ContentType) EnumDescriptor() ([]byte, []int) {
+	return file_api_proto_rawDescGZIP(), []int{3}
+}
+
 type Msg struct {
 	state         protoimpl.MessageState
 	sizeCache     protoimpl.SizeCache
@@ -190,6 +251,9 @@ type Msg struct {
 	//	*Msg_Assign
 	//	*Msg_Interrupt
 	//	*Msg_Empty
+	//	*Msg_Register
+	//	*Msg_FetchFunc
+	//	*Msg_FuncData
 	Payload isMsg_Payload `protobuf_oneof:"payload"`
 }
 
@@ -267,6 +331,27 @@ func (x *Msg) GetEmpty() *EmptyPayload {
 	return nil
 }
 
+func (x *Msg) GetRegister() *RegisterPayload {
+	if x, ok := x.GetPayload().(*Msg_Register); ok {
+		return x.Register
+	}
+	return nil
+}
+
+func (x *Msg) GetFetchFunc() *FetchFuncPayload {
+	if x, ok := x.GetPayload().(*Msg_FetchFunc); ok {
+		return x.FetchFunc
+	}
+	return nil
+}
+
+func (x *Msg) GetFuncData() *FuncDataPayload {
+	if x, ok := x.GetPayload().(*Msg_FuncData); ok {
+		return x.FuncData
+	}
+	return nil
+}
+
 type isMsg_Payload interface {
 	isMsg_Payload()
 }
@@ -287,6 +372,18 @@ type Msg_Empty struct {
 	Empty *EmptyPayload `protobuf:"bytes,5,opt,name=empty,proto3,oneof"`
 }
 
+type Msg_Register struct {
+	Register *RegisterPayload `protobuf:"bytes,6,opt,name=register,proto3,oneof"`
+}
+
+type Msg_FetchFunc struct {
+	FetchFunc *FetchFuncPayload `protobuf:"bytes,7,opt,name=fetch_func,json=fetchFunc,proto3,oneof"`
+}
+
+type Msg_FuncData struct {
+	FuncData *FuncDataPayload `protobuf:"bytes,8,opt,name=func_data,json=funcData,proto3,oneof"`
+}
+
 func (*Msg_Status) isMsg_Payload() {}
 
 func (*Msg_Assign) isMsg_Payload() {}
@@ -295,6 +392,68 @@ func (*Msg_Interrupt) isMsg_Payload() {}
 
 func (*Msg_Empty) isMsg_Payload() {}
 
+func (*Msg_Register) isMsg_Payload() {}
+
+func (*Msg_FetchFunc) isMsg_Payload() {}
+
+func (*Msg_FuncData) isMsg_Payload() {}
+
+// Payload is task input or output, data of Any is a serialized google.protobuf.Any
+type Payload struct {
+	state         protoimpl.MessageState
+	sizeCache     protoimpl.SizeCache
+	unknownFields protoimpl.UnknownFields
+
+	ContentType ContentType `protobuf:"varint,1,opt,name=content_type,json=contentType,proto3,enum=api.ContentType" json:"content_type,omitempty"`
+	Data        []byte      `protobuf:"bytes,2,opt,name=data,proto3" json:"data,omitempty"`
+}
+
+func (x *Payload) Reset() {
+	*x = Payload{}
+	if protoimpl.UnsafeEnabled {
+		mi := &file_api_proto_msgTypes[1]
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		ms.StoreMessageInfo(mi)
+	}
+}
+
+func (x *Payload) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*Payload) ProtoMessage() {}
+
+func (x *Payload) ProtoReflect() protoreflect.Message {
+	mi := &file_api_proto_msgTypes[1]
+	if protoimpl.UnsafeEnabled && x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use Payload.ProtoReflect.Descriptor instead.
+func (*Payload) Descriptor() ([]byte, []int) {
+	return file_api_proto_rawDescGZIP(), []int{1}
+}
+
+func (x *Payload) GetContentType() ContentType {
+	if x != nil {
+		return x.ContentType
+	}
+	return ContentType_Text
+}
+
+func (x *Payload) GetData() []byte {
+	if x != nil {
+		return x.Data
+	}
+	return nil
+}
+
 type StatusPayload struct {
 	state         protoimpl.MessageState
 	sizeCache     protoimpl.SizeCache
@@ -303,13 +462,17 @@ type StatusPayload struct {
 	WorkStatus WorkerStatus `protobuf:"varint,1,opt,name=work_status,json=workStatus,proto3,enum=api.WorkerStatus" json:"work_status,omitempty"`
 	TaskId     string       `protobuf:"bytes,2,opt,name=task_id,json=taskId,proto3" json:"task_id,omitempty"`
 	TaskStatus TaskStatus   `protobuf:"varint,3,opt,name=task_status,json=taskStatus,proto3,enum=api.TaskStatus" json:"task_status,omitempty"`
-	ExecResult string       `protobuf:"bytes,4,opt,name=exec_result,json=execResult,proto3" json:"exec_result,omitempty"`
+	// exec_result is for worker speaks protocol older than 3, result takes precedence
+	ExecResult string   `protobuf:"bytes,4,opt,name=exec_result,json=execResult,proto3" json:"exec_result,omitempty"`
+	Result     *Payload `protobuf:"bytes,5,opt,name=result,proto3" json:"result,omitempty"`
+	// progress of running task in [0, 1], result of running task is partial result
+	Progress float32 `protobuf:"fixed32,6,opt,name=progress,proto3" json:"progress,omitempty"`
 }
 
 func (x *StatusPayload) Reset() {
 	*x = StatusPayload{}
 	if protoimpl.UnsafeEnabled {
-		mi := &file_api_proto_msgTypes[1]
+		mi := &file_api_proto_msgTypes[2]
 		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
 		ms.StoreMessageInfo(mi)
 	}
@@ -322,7 +485,7 @@ func (x *StatusPayload) String() string {
 func (*StatusPayload) ProtoMessage() {}
 
 func (x *StatusPayload) ProtoReflect() protoreflect.Message {
-	mi := &file_api_proto_msgTypes[1]
+	mi := &file_api_proto_msgTypes[2]
 	if protoimpl.UnsafeEnabled && x != nil {
 		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
 		if ms.LoadMessageInfo() == nil {
@@ -335,7 +498,7 @@ func (x *StatusPayload) ProtoReflect() protoreflect.Message {
 
 // Deprecated: Use StatusPayload.ProtoReflect.Descriptor instead.
 func (*StatusPayload) Descriptor() ([]byte, []int) {
-	return file_api_proto_rawDescGZIP(), []int{1}
+	return file_api_proto_rawDescGZIP(), []int{2}
 }
 
 func (x *StatusPayload) GetWorkStatus() WorkerStatus {
@@ -366,20 +529,38 @@ func (x *StatusPayload) GetExecResult() string {
 	return ""
 }
 
+func (x *StatusPayload) GetResult() *Payload {
+	if x != nil {
+		return x.Result
+	}
+	return nil
+}
+
+func (x *StatusPayload) GetProgress() float32 {
+	if x != nil {
+		return x.Progress
+	}
+	return 0
+}
+
 type AssignPayload struct {
 	state         protoimpl.MessageState
 	sizeCache     protoimpl.SizeCache
 	unknownFields protoimpl.UnknownFields
 
 	TaskId string `protobuf:"bytes,1,opt,name=task_id,json=taskId,proto3" json:"task_id,omitempty"`
-	Data   string `protobuf:"bytes,2,opt,name=data,proto3" json:"data,omitempty"`
-	FuncId string `protobuf:"bytes,3,opt,name=func_id,json=funcId,proto3" json:"func_id,omitempty"`
+	// data is for worker speaks protocol older than 3, which only receives textual input
+	Data     string   `protobuf:"bytes,2,opt,name=data,proto3" json:"data,omitempty"`
+	FuncId   string   `protobuf:"bytes,3,opt,name=func_id,json=funcId,proto3" json:"func_id,omitempty"`
+	FuncCode []byte   `protobuf:"bytes,4,opt,name=func_code,json=funcCode,proto3" json:"func_code,omitempty"`
+	FuncHash string   `protobuf:"bytes,5,opt,name=func_hash,json=funcHash,proto3" json:"func_hash,omitempty"`
+	Input    *Payload `protobuf:"bytes,6,opt,name=input,proto3" json:"input,omitempty"`
 }
 
 func (x *AssignPayload) Reset() {
 	*x = AssignPayload{}
 	if protoimpl.UnsafeEnabled {
-		mi := &file_api_proto_msgTypes[2]
+		mi := &file_api_proto_msgTypes[3]
 		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
 		ms.StoreMessageInfo(mi)
 	}
@@ -392,7 +573,7 @@ func (x *AssignPayload) String() string {
 func (*AssignPayload) ProtoMessage() {}
 
 func (x *AssignPayload) ProtoReflect() protoreflect.Message {
-	mi := &file_api_proto_msgTypes[2]
+	mi := &file_api_proto_msgTypes[3]
 	if protoimpl.UnsafeEnabled && x != nil {
 		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
 		if ms.LoadMessageInfo() == nil {
@@ -405,7 +586,7 @@ func (x *AssignPayload) ProtoReflect() protoreflect.Message {
 
 // Deprecated: Use AssignPayload.ProtoReflect.Descriptor instead.
 func (*AssignPayload) Descriptor() ([]byte, []int) {
-	return file_api_proto_rawDescGZIP(), []int{2}
+	return file_api_proto_rawDescGZIP(), []int{3}
 }
 
 func (x *AssignPayload) GetTaskId() string {
@@ -429,6 +610,27 @@ func (x *AssignPayload) GetFuncId() string {
 	return ""
 }
 
+func (x *AssignPayload) GetFuncCode() []byte {
+	if x != nil {
+		return x.FuncCode
+	}
+	return nil
+}
+
+func (x *AssignPayload) GetFuncHash() string {
+	if x != nil {
+		return x.FuncHash
+	}
+	return ""
+}
+
+func (x *AssignPayload) GetInput() *Payload {
+	if x != nil {
+		return x.Input
+	}
+	return nil
+}
+
 type InterruptPayload struct {
 	state         protoimpl.MessageState
 	sizeCache     protoimpl.SizeCache
@@ -440,7 +642,7 @@ type InterruptPayload struct {
 func (x *InterruptPayload) Reset() {
 	*x = InterruptPayload{}
 	if protoimpl.UnsafeEnabled {
-		mi := &file_api_proto_msgTypes[3]
+		mi := &file_api_proto_msgTypes[4]
 		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
 		ms.StoreMessageInfo(mi)
 	}
@@ -453,7 +655,7 @@ func (x *InterruptPayload) String() string {
 func (*InterruptPayload) ProtoMessage() {}
 
 func (x *InterruptPayload) ProtoReflect() protoreflect.Message {
-	mi := &file_api_proto_msgTypes[3]
+	mi := &file_api_proto_msgTypes[4]
 	if protoimpl.UnsafeEnabled && x != nil {
 		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
 		if ms.LoadMessageInfo() == nil {
@@ -466,7 +668,7 @@ func (x *InterruptPayload) ProtoReflect() protoreflect.Message {
 
 // Deprecated: Use InterruptPayload.ProtoReflect.Descriptor instead.
 func (*InterruptPayload) Descriptor() ([]byte, []int) {
-	return file_api_proto_rawDescGZIP(), []int{3}
+	return file_api_proto_rawDescGZIP(), []int{4}
 }
 
 func (x *InterruptPayload) GetTaskId() string {
@@ -485,7 +687,7 @@ type EmptyPayload struct {
 func (x *EmptyPayload) Reset() {
 	*x = EmptyPayload{}
 	if protoimpl.UnsafeEnabled {
-		mi := &file_api_proto_msgTypes[4]
+		mi := &file_api_proto_msgTypes[5]
 		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
 		ms.StoreMessageInfo(mi)
 	}
@@ -498,7 +700,7 @@ func (x *EmptyPayload) String() string {
 func (*EmptyPayload) ProtoMessage() {}
 
 func (x *EmptyPayload) ProtoReflect() protoreflect.Message {
-	mi := &file_api_proto_msgTypes[4]
+	mi := &file_api_proto_msgTypes[5]
 	if protoimpl.UnsafeEnabled && x != nil {
 		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
 		if ms.LoadMessageInfo() == nil {
@@ -511,14 +713,236 @@ func (x *EmptyPayload) ProtoReflect() protoreflect.Message {
 
 // Deprecated: Use EmptyPayload.ProtoReflect.Descriptor instead.
 func (*EmptyPayload) Descriptor() ([]byte, []int) {
-	return file_api_proto_rawDescGZIP(), []int{4}
+	return file_api_proto_rawDescGZIP(), []int{5}
+}
+
+type RegisterPayload struct {
+	state         protoimpl.MessageState
+	sizeCache     protoimpl.SizeCache
+	unknownFields protoimpl.UnknownFields
+
+	WorkerId        string   `protobuf:"bytes,1,opt,name=worker_id,json=workerId,proto3" json:"worker_id,omitempty"`
+	UserAgent       string   `protobuf:"bytes,2,opt,name=user_agent,json=userAgent,proto3" json:"user_agent,omitempty"`
+	Cores           uint32   `protobuf:"varint,3,opt,name=cores,proto3" json:"cores,omitempty"`
+	Memory          uint64   `protobuf:"varint,4,opt,name=memory,proto3" json:"memory,omitempty"`
+	FuncIds         []string `protobuf:"bytes,5,rep,name=func_ids,json=funcIds,proto3" json:"func_ids,omitempty"`
+	Wasm            bool     `protobuf:"varint,6,opt,name=wasm,proto3" json:"wasm,omitempty"`
+	ProtocolVersion uint32   `protobuf:"varint,7,opt,name=protocol_version,json=protocolVersion,proto3" json:"protocol_version,omitempty"`
+	Slots           uint32   `protobuf:"varint,8,opt,name=slots,proto3" json:"slots,omitempty"`
+	// admission_token is issued by admin, required if scheduler admits tokened workers only
+	AdmissionToken string `protobuf:"bytes,9,opt,name=admission_token,json=admissionToken,proto3" json:"admission_token,omitempty"`
+}
+
+func (x *RegisterPayload) Reset() {
+	*x = RegisterPayload{}
+	if protoimpl.UnsafeEnabled {
+		mi := &file_api_proto_msgTypes[6]
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		ms.StoreMessageInfo(mi)
+	}
+}
+
+func (x *RegisterPayload) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*RegisterPayload) ProtoMessage() {}
+
+func (x *RegisterPayload) ProtoReflect() protoreflect.Message {
+	mi := &file_api_proto_msgTypes[6]
+	if protoimpl.UnsafeEnabled && x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use RegisterPayload.ProtoReflect.Descriptor instead.
+func (*RegisterPayload) Descriptor() ([]byte, []int) {
+	return file_api_proto_rawDescGZIP(), []int{6}
+}
+
+func (x *RegisterPayload) GetWorkerId() string {
+	if x != nil {
+		return x.WorkerId
+	}
+	return ""
+}
+
+func (x *RegisterPayload) GetUserAgent() string {
+	if x != nil {
+		return x.UserAgent
+	}
+	return ""
+}
+
+func (x *RegisterPayload) GetCores() uint32 {
+	if x != nil {
+		return x.Cores
+	}
+	return 0
+}
+
+func (x *RegisterPayload) GetMemory() uint64 {
+	if x != nil {
+		return x.Memory
+	}
+	return 0
+}
+
+func (x *RegisterPayload) GetFuncIds() []string {
+	if x != nil {
+		return x.FuncIds
+	}
+	return nil
+}
+
+func (x *RegisterPayload) GetWasm() bool {
+	if x != nil {
+		return x.Wasm
+	}
+	return false
+}
+
+func (x *RegisterPayload) GetProtocolVersion() uint32 {
+	if x != nil {
+		return x.ProtocolVersion
+	}
+	return 0
+}
+
+func (x *RegisterPayload) GetSlots() uint32 {
+	if x != nil {
+		return x.Slots
+	}
+	return 0
+}
+
+func (x *RegisterPayload) GetAdmissionToken() string {
+	if x != nil {
+		return x.AdmissionToken
+	}
+	return ""
+}
+
+type FetchFuncPayload struct {
+	state         protoimpl.MessageState
+	sizeCache     protoimpl.SizeCache
+	unknownFields protoimpl.UnknownFields
+
+	FuncHash string `protobuf:"bytes,1,opt,name=func_hash,json=funcHash,proto3" json:"func_hash,omitempty"`
+}
+
+func (x *FetchFuncPayload) Reset() {
+	*x = FetchFuncPayload{}
+	if protoimpl.UnsafeEnabled {
+		mi := &file_api_proto_msgTypes[7]
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		ms.StoreMessageInfo(mi)
+	}
+}
+
+func (x *FetchFuncPayload) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*FetchFuncPayload) ProtoMessage() {}
+
+func (x *FetchFuncPayload) ProtoReflect() protoreflect.Message {
+	mi := &file_api_proto_msgTypes[7]
+	if protoimpl.UnsafeEnabled && x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use FetchFuncPayload.ProtoReflect.Descriptor instead.
+func (*FetchFuncPayload) Descriptor() ([]byte, []int) {
+	return file_api_proto_rawDescGZIP(), []int{7}
+}
+
+func (x *FetchFuncPayload) GetFuncHash() string {
+	if x != nil {
+		return x.FuncHash
+	}
+	return ""
+}
+
+type FuncDataPayload struct {
+	state         protoimpl.MessageState
+	sizeCache     protoimpl.SizeCache
+	unknownFields protoimpl.UnknownFields
+
+	FuncHash string `protobuf:"bytes,1,opt,name=func_hash,json=funcHash,proto3" json:"func_hash,omitempty"`
+	Code     []byte `protobuf:"bytes,2,opt,name=code,proto3" json:"code,omitempty"`
+	Error    string `protobuf:"bytes,3,opt,name=error,proto3" json:"error,omitempty"`
+}
+
+func (x *FuncDataPayload) Reset() {
+	*x = FuncDataPayload{}
+	if protoimpl.UnsafeEnabled {
+		mi := &file_api_proto_msgTypes[8]
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		ms.StoreMessageInfo(mi)
+	}
+}
+
+func (x *FuncDataPayload) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*FuncDataPayload) ProtoMessage() {}
+
+func (x *FuncDataPayload) ProtoReflect() protoreflect.Message {
+	mi := &file_api_proto_msgTypes[8]
+	if protoimpl.UnsafeEnabled && x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use FuncDataPayload.ProtoReflect.Descriptor instead.
+func (*FuncDataPayload) Descriptor() ([]byte, []int) {
+	return file_api_proto_rawDescGZIP(), []int{8}
+}
+
+func (x *FuncDataPayload) GetFuncHash() string {
+	if x != nil {
+		return x.FuncHash
+	}
+	return ""
+}
+
+func (x *FuncDataPayload) GetCode() []byte {
+	if x != nil {
+		return x.Code
+	}
+	return nil
+}
+
+func (x *FuncDataPayload) GetError() string {
+	if x != nil {
+		return x.Error
+	}
+	return ""
 }
 
 var File_api_proto protoreflect.FileDescriptor
 
 var file_api_proto_rawDesc = []byte{
 	0x0a, 0x09, 0x61, 0x70, 0x69, 0x2e, 0x70, 0x72, 0x6f, 0x74, 0x6f, 0x12, 0x03, 0x61, 0x70, 0x69,
-	0x22, 0xea, 0x01, 0x0a, 0x03, 0x4d, 0x73, 0x67, 0x12, 0x1a, 0x0a, 0x03, 0x63, 0x6d, 0x64, 0x18,
+	0x22, 0x8b, 0x03, 0x0a, 0x03, 0x4d, 0x73, 0x67, 0x12, 0x1a, 0x0a, 0x03, 0x63, 0x6d, 0x64, 0x18,
 	0x01, 0x20, 0x01, 0x28, 0x0e, 0x32, 0x08, 0x2e, 0x61, 0x70, 0x69, 0x2e, 0x43, 0x4d, 0x44, 0x52,
 	0x03, 0x63, 0x6d, 0x64, 0x12, 0x2c, 0x0a, 0x06, 0x73, 0x74, 0x61, 0x74, 0x75, 0x73, 0x18, 0x02,
 	0x20, 0x01, 0x28, 0x0b, 0x32, 0x12, 0x2e, 0x61, 0x70, 0x69, 0x2e, 0x53, 0x74, 0x61, 0x74, 0x75,
@@ -532,41 +956,99 @@ var file_api_proto_rawDesc = []byte{
 	0x74, 0x65, 0x72, 0x72, 0x75, 0x70, 0x74, 0x12, 0x29, 0x0a, 0x05, 0x65, 0x6d, 0x70, 0x74, 0x79,
 	0x18, 0x05, 0x20, 0x01, 0x28, 0x0b, 0x32, 0x11, 0x2e, 0x61, 0x70, 0x69, 0x2e, 0x45, 0x6d, 0x70,
 	0x74, 0x79, 0x50, 0x61, 0x79, 0x6c, 0x6f, 0x61, 0x64, 0x48, 0x00, 0x52, 0x05, 0x65, 0x6d, 0x70,
-	0x74, 0x79, 0x42, 0x09, 0x0a, 0x07, 0x70, 0x61, 0x79, 0x6c, 0x6f, 0x61, 0x64, 0x22, 0xaf, 0x01,
-	0x0a, 0x0d, 0x53, 0x74, 0x61, 0x74, 0x75, 0x73, 0x50, 0x61, 0x79, 0x6c, 0x6f, 0x61, 0x64, 0x12,
-	0x32, 0x0a, 0x0b, 0x77, 0x6f, 0x72, 0x6b, 0x5f, 0x73, 0x74, 0x61, 0x74, 0x75, 0x73, 0x18, 0x01,
-	0x20, 0x01, 0x28, 0x0e, 0x32, 0x11, 0x2e, 0x61, 0x70, 0x69, 0x2e, 0x57, 0x6f, 0x72, 0x6b, 0x65,
-	0x72, 0x53, 0x74, 0x61, 0x74, 0x75, 0x73, 0x52, 0x0a, 0x77, 0x6f, 0x72, 0x6b, 0x53, 0x74, 0x61,
-	0x74, 0x75, 0x73, 0x12, 0x17, 0x0a, 0x07, 0x74, 0x61, 0x73, 0x6b, 0x5f, 0x69, 0x64, 0x18, 0x02,
-	0x20, 0x01, 0x28, 0x09, 0x52, 0x06, 0x74, 0x61, 0x73, 0x6b, 0x49, 0x64, 0x12, 0x30, 0x0a, 0x0b,
-	0x74, 0x61, 0x73, 0x6b, 0x5f, 0x73, 0x74, 0x61, 0x74, 0x75, 0x73, 0x18, 0x03, 0x20, 0x01, 0x28,
-	0x0e, 0x32, 0x0f, 0x2e, 0x61, 0x70, 0x69, 0x2e, 0x54, 0x61, 0x73, 0x6b, 0x53, 0x74, 0x61, 0x74,
-	0x75, 0x73, 0x52, 0x0a, 0x74, 0x61, 0x73, 0x6b, 0x53, 0x74, 0x61, 0x74, 0x75, 0x73, 0x12, 0x1f,
-	0x0a, 0x0b, 0x65, 0x78, 0x65, 0x63, 0x5f, 0x72, 0x65, 0x73, 0x75, 0x6c, 0x74, 0x18, 0x04, 0x20,
-	0x01, 0x28, 0x09, 0x52, 0x0a, 0x65, 0x78, 0x65, 0x63, 0x52, 0x65, 0x73, 0x75, 0x6c, 0x74, 0x22,
-	0x55, 0x0a, 0x0d, 0x41, 0x73, 0x73, 0x69, 0x67, 0x6e, 0x50, 0x61, 0x79, 0x6c, 0x6f, 0x61, 0x64,
+	0x74, 0x79, 0x12, 0x32, 0x0a, 0x08, 0x72, 0x65, 0x67, 0x69, 0x73, 0x74, 0x65, 0x72, 0x18, 0x06,
+	0x20, 0x01, 0x28, 0x0b, 0x32, 0x14, 0x2e, 0x61, 0x70, 0x69, 0x2e, 0x52, 0x65, 0x67, 0x69, 0x73,
+	0x74, 0x65, 0x72, 0x50, 0x61, 0x79, 0x6c, 0x6f, 0x61, 0x64, 0x48, 0x00, 0x52, 0x08, 0x72, 0x65,
+	0x67, 0x69, 0x73, 0x74, 0x65, 0x72, 0x12, 0x36, 0x0a, 0x0a, 0x66, 0x65, 0x74, 0x63, 0x68, 0x5f,
+	0x66, 0x75, 0x6e, 0x63, 0x18, 0x07, 0x20, 0x01, 0x28, 0x0b, 0x32, 0x15, 0x2e, 0x61, 0x70, 0x69,
+	0x2e, 0x46, 0x65, 0x74, 0x63, 0x68, 0x46, 0x75, 0x6e, 0x63, 0x50, 0x61, 0x79, 0x6c, 0x6f, 0x61,
+	0x64, 0x48, 0x00, 0x52, 0x09, 0x66, 0x65, 0x74, 0x63, 0x68, 0x46, 0x75, 0x6e, 0x63, 0x12, 0x33,
+	0x0a, 0x09, 0x66, 0x75, 0x6e, 0x63, 0x5f, 0x64, 0x61, 0x74, 0x61, 0x18, 0x08, 0x20, 0x01, 0x28,
+	0x0b, 0x32, 0x14, 0x2e, 0x61, 0x70, 0x69, 0x2e, 0x46, 0x75, 0x6e, 0x63, 0x44, 0x61, 0x74, 0x61,
+	0x50, 0x61, 0x79, 0x6c, 0x6f, 0x61, 0x64, 0x48, 0x00, 0x52, 0x08, 0x66, 0x75, 0x6e, 0x63, 0x44,
+	0x61, 0x74, 0x61, 0x42, 0x09, 0x0a, 0x07, 0x70, 0x61, 0x79, 0x6c, 0x6f, 0x61, 0x64, 0x22, 0x52,
+	0x0a, 0x07, 0x50, 0x61, 0x79, 0x6c, 0x6f, 0x61, 0x64, 0x12, 0x33, 0x0a, 0x0c, 0x63, 0x6f, 0x6e,
+	0x74, 0x65, 0x6e, 0x74, 0x5f, 0x74, 0x79, 0x70, 0x65, 0x18, 0x01, 0x20, 0x01, 0x28, 0x0e, 0x32,
+	0x10, 0x2e, 0x61, 0x70, 0x69, 0x2e, 0x43, 0x6f, 0x6e, 0x74, 0x65, 0x6e, 0x74, 0x54, 0x79, 0x70,
+	0x65, 0x52, 0x0b, 0x63, 0x6f, 0x6e, 0x74, 0x65, 0x6e, 0x74, 0x54, 0x79, 0x70, 0x65, 0x12, 0x12,
+	0x0a, 0x04, 0x64, 0x61, 0x74, 0x61, 0x18, 0x02, 0x20, 0x01, 0x28, 0x0c, 0x52, 0x04, 0x64, 0x61,
+	0x74, 0x61, 0x22, 0xf1, 0x01, 0x0a, 0x0d, 0x53, 0x74, 0x61, 0x74, 0x75, 0x73, 0x50, 0x61, 0x79,
+	0x6c, 0x6f, 0x61, 0x64, 0x12, 0x32, 0x0a, 0x0b, 0x77, 0x6f, 0x72, 0x6b, 0x5f, 0x73, 0x74, 0x61,
+	0x74, 0x75, 0x73, 0x18, 0x01, 0x20, 0x01, 0x28, 0x0e, 0x32, 0x11, 0x2e, 0x61, 0x70, 0x69, 0x2e,
+	0x57, 0x6f, 0x72, 0x6b, 0x65, 0x72, 0x53, 0x74, 0x61, 0x74, 0x75, 0x73, 0x52, 0x0a, 0x77, 0x6f,
+	0x72, 0x6b, 0x53, 0x74, 0x61, 0x74, 0x75, 0x73, 0x12, 0x17, 0x0a, 0x07, 0x74, 0x61, 0x73, 0x6b,
+	0x5f, 0x69, 0x64, 0x18, 0x02, 0x20, 0x01, 0x28, 0x09, 0x52, 0x06, 0x74, 0x61, 0x73, 0x6b, 0x49,
+	0x64, 0x12, 0x30, 0x0a, 0x0b, 0x74, 0x61, 0x73, 0x6b, 0x5f, 0x73, 0x74, 0x61, 0x74, 0x75, 0x73,
+	0x18, 0x03, 0x20, 0x01, 0x28, 0x0e, 0x32, 0x0f, 0x2e, 0x61, 0x70, 0x69, 0x2e, 0x54, 0x61, 0x73,
+	0x6b, 0x53, 0x74, 0x61, 0x74, 0x75, 0x73, 0x52, 0x0a, 0x74, 0x61, 0x73, 0x6b, 0x53, 0x74, 0x61,
+	0x74, 0x75, 0x73, 0x12, 0x1f, 0x0a, 0x0b, 0x65, 0x78, 0x65, 0x63, 0x5f, 0x72, 0x65, 0x73, 0x75,
+	0x6c, 0x74, 0x18, 0x04, 0x20, 0x01, 0x28, 0x09, 0x52, 0x0a, 0x65, 0x78, 0x65, 0x63, 0x52, 0x65,
+	0x73, 0x75, 0x6c, 0x74, 0x12, 0x24, 0x0a, 0x06, 0x72, 0x65, 0x73, 0x75, 0x6c, 0x74, 0x18, 0x05,
+	0x20, 0x01, 0x28, 0x0b, 0x32, 0x0c, 0x2e, 0x61, 0x70, 0x69, 0x2e, 0x50, 0x61, 0x79, 0x6c, 0x6f,
+	0x61, 0x64, 0x52, 0x06, 0x72, 0x65, 0x73, 0x75, 0x6c, 0x74, 0x12, 0x1a, 0x0a, 0x08, 0x70, 0x72,
+	0x6f, 0x67, 0x72, 0x65, 0x73, 0x73, 0x18, 0x06, 0x20, 0x01, 0x28, 0x02, 0x52, 0x08, 0x70, 0x72,
+	0x6f, 0x67, 0x72, 0x65, 0x73, 0x73, 0x22, 0xb3, 0x01, 0x0a, 0x0d, 0x41, 0x73, 0x73, 0x69, 0x67,
+	0x6e, 0x50, 0x61, 0x79, 0x6c, 0x6f, 0x61, 0x64, 0x12, 0x17, 0x0a, 0x07, 0x74, 0x61, 0x73, 0x6b,
+	0x5f, 0x69, 0x64, 0x18, 0x01, 0x20, 0x01, 0x28, 0x09, 0x52, 0x06, 0x74, 0x61, 0x73, 0x6b, 0x49,
+	0x64, 0x12, 0x12, 0x0a, 0x04, 0x64, 0x61, 0x74, 0x61, 0x18, 0x02, 0x20, 0x01, 0x28, 0x09, 0x52,
+	0x04, 0x64, 0x61, 0x74, 0x61, 0x12, 0x17, 0x0a, 0x07, 0x66, 0x75, 0x6e, 0x63, 0x5f, 0x69, 0x64,
+	0x18, 0x03, 0x20, 0x01, 0x28, 0x09, 0x52, 0x06, 0x66, 0x75, 0x6e, 0x63, 0x49, 0x64, 0x12, 0x1b,
+	0x0a, 0x09, 0x66, 0x75, 0x6e, 0x63, 0x5f, 0x63, 0x6f, 0x64, 0x65, 0x18, 0x04, 0x20, 0x01, 0x28,
+	0x0c, 0x52, 0x08, 0x66, 0x75, 0x6e, 0x63, 0x43, 0x6f, 0x64, 0x65, 0x12, 0x1b, 0x0a, 0x09, 0x66,
+	0x75, 0x6e, 0x63, 0x5f, 0x68, 0x61, 0x73, 0x68, 0x18, 0x05, 0x20, 0x01, 0x28, 0x09, 0x52, 0x08,
+	0x66, 0x75, 0x6e, 0x63, 0x48, 0x61, 0x73, 0x68, 0x12, 0x22, 0x0a, 0x05, 0x69, 0x6e, 0x70, 0x75,
+	0x74, 0x18, 0x06, 0x20, 0x01, 0x28, 0x0b, 0x32, 0x0c, 0x2e, 0x61, 0x70, 0x69, 0x2e, 0x50, 0x61,
+	0x79, 0x6c, 0x6f, 0x61, 0x64, 0x52, 0x05, 0x69, 0x6e, 0x70, 0x75, 0x74, 0x22, 0x2b, 0x0a, 0x10,
+	0x49, 0x6e, 0x74, 0x65, 0x72, 0x72, 0x75, 0x70, 0x74, 0x50, 0x61, 0x79, 0x6c, 0x6f, 0x61, 0x64,
 	0x12, 0x17, 0x0a, 0x07, 0x74, 0x61, 0x73, 0x6b, 0x5f, 0x69, 0x64, 0x18, 0x01, 0x20, 0x01, 0x28,
-	0x09, 0x52, 0x06, 0x74, 0x61, 0x73, 0x6b, 0x49, 0x64, 0x12, 0x12, 0x0a, 0x04, 0x64, 0x61, 0x74,
-	0x61, 0x18, 0x02, 0x20, 0x01, 0x28, 0x09, 0x52, 0x04, 0x64, 0x61, 0x74, 0x61, 0x12, 0x17, 0x0a,
-	0x07, 0x66, 0x75, 0x6e, 0x63, 0x5f, 0x69, 0x64, 0x18, 0x03, 0x20, 0x01, 0x28, 0x09, 0x52, 0x06,
-	0x66, 0x75, 0x6e, 0x63, 0x49, 0x64, 0x22, 0x2b, 0x0a, 0x10, 0x49, 0x6e, 0x74, 0x65, 0x72, 0x72,
-	0x75, 0x70, 0x74, 0x50, 0x61, 0x79, 0x6c, 0x6f, 0x61, 0x64, 0x12, 0x17, 0x0a, 0x07, 0x74, 0x61,
-	0x73, 0x6b, 0x5f, 0x69, 0x64, 0x18, 0x01, 0x20, 0x01, 0x28, 0x09, 0x52, 0x06, 0x74, 0x61, 0x73,
-	0x6b, 0x49, 0x64, 0x22, 0x0e, 0x0a, 0x0c, 0x45, 0x6d, 0x70, 0x74, 0x79, 0x50, 0x61, 0x79, 0x6c,
-	0x6f, 0x61, 0x64, 0x2a, 0x52, 0x0a, 0x03, 0x43, 0x4d, 0x44, 0x12, 0x0b, 0x0a, 0x07, 0x55, 0x6e,
-	0x6b, 0x6e, 0x6f, 0x77, 0x6e, 0x10, 0x00, 0x12, 0x0c, 0x0a, 0x08, 0x52, 0x65, 0x67, 0x69, 0x73,
-	0x74, 0x65, 0x72, 0x10, 0x01, 0x12, 0x09, 0x0a, 0x05, 0x43, 0x6c, 0x6f, 0x73, 0x65, 0x10, 0x02,
-	0x12, 0x0a, 0x0a, 0x06, 0x53, 0x74, 0x61, 0x74, 0x75, 0x73, 0x10, 0x03, 0x12, 0x0a, 0x0a, 0x06,
-	0x41, 0x73, 0x73, 0x69, 0x67, 0x6e, 0x10, 0x04, 0x12, 0x0d, 0x0a, 0x09, 0x49, 0x6e, 0x74, 0x65,
-	0x72, 0x72, 0x75, 0x70, 0x74, 0x10, 0x05, 0x2a, 0x2f, 0x0a, 0x0c, 0x57, 0x6f, 0x72, 0x6b, 0x65,
-	0x72, 0x53, 0x74, 0x61, 0x74, 0x75, 0x73, 0x12, 0x08, 0x0a, 0x04, 0x49, 0x64, 0x6c, 0x65, 0x10,
-	0x00, 0x12, 0x08, 0x0a, 0x04, 0x42, 0x75, 0x73, 0x79, 0x10, 0x01, 0x12, 0x0b, 0x0a, 0x07, 0x43,
-	0x6c, 0x6f, 0x73, 0x69, 0x6e, 0x67, 0x10, 0x02, 0x2a, 0x43, 0x0a, 0x0a, 0x54, 0x61, 0x73, 0x6b,
-	0x53, 0x74, 0x61, 0x74, 0x75, 0x73, 0x12, 0x0b, 0x0a, 0x07, 0x52, 0x75, 0x6e, 0x6e, 0x69, 0x6e,
-	0x67, 0x10, 0x00, 0x12, 0x0c, 0x0a, 0x08, 0x46, 0x69, 0x6e, 0x69, 0x73, 0x68, 0x65, 0x64, 0x10,
-	0x01, 0x12, 0x09, 0x0a, 0x05, 0x45, 0x72, 0x72, 0x6f, 0x72, 0x10, 0x02, 0x12, 0x0f, 0x0a, 0x0b,
-	0x49, 0x6e, 0x74, 0x65, 0x72, 0x72, 0x75, 0x70, 0x74, 0x65, 0x64, 0x10, 0x03, 0x42, 0x07, 0x5a,
-	0x05, 0x2e, 0x2f, 0x61, 0x70, 0x69, 0x62, 0x06, 0x70, 0x72, 0x6f, 0x74, 0x6f, 0x33,
+	0x09, 0x52, 0x06, 0x74, 0x61, 0x73, 0x6b, 0x49, 0x64, 0x22, 0x0e, 0x0a, 0x0c, 0x45, 0x6d, 0x70,
+	0x74, 0x79, 0x50, 0x61, 0x79, 0x6c, 0x6f, 0x61, 0x64, 0x22, 0x94, 0x02, 0x0a, 0x0f, 0x52, 0x65,
+	0x67, 0x69, 0x73, 0x74, 0x65, 0x72, 0x50, 0x61, 0x79, 0x6c, 0x6f, 0x61, 0x64, 0x12, 0x1b, 0x0a,
+	0x09, 0x77, 0x6f, 0x72, 0x6b, 0x65, 0x72, 0x5f, 0x69, 0x64, 0x18, 0x01, 0x20, 0x01, 0x28, 0x09,
+	0x52, 0x08, 0x77, 0x6f, 0x72, 0x6b, 0x65, 0x72, 0x49, 0x64, 0x12, 0x1d, 0x0a, 0x0a, 0x75, 0x73,
+	0x65, 0x72, 0x5f, 0x61, 0x67, 0x65, 0x6e, 0x74, 0x18, 0x02, 0x20, 0x01, 0x28, 0x09, 0x52, 0x09,
+	0x75, 0x73, 0x65, 0x72, 0x41, 0x67, 0x65, 0x6e, 0x74, 0x12, 0x14, 0x0a, 0x05, 0x63, 0x6f, 0x72,
+	0x65, 0x73, 0x18, 0x03, 0x20, 0x01, 0x28, 0x0d, 0x52, 0x05, 0x63, 0x6f, 0x72, 0x65, 0x73, 0x12,
+	0x16, 0x0a, 0x06, 0x6d, 0x65, 0x6d, 0x6f, 0x72, 0x79, 0x18, 0x04, 0x20, 0x01, 0x28, 0x04, 0x52,
+	0x06, 0x6d, 0x65, 0x6d, 0x6f, 0x72, 0x79, 0x12, 0x19, 0x0a, 0x08, 0x66, 0x75, 0x6e, 0x63, 0x5f,
+	0x69, 0x64, 0x73, 0x18, 0x05, 0x20, 0x03, 0x28, 0x09, 0x52, 0x07, 0x66, 0x75, 0x6e, 0x63, 0x49,
+	0x64, 0x73, 0x12, 0x12, 0x0a, 0x04, 0x77, 0x61, 0x73, 0x6d, 0x18, 0x06, 0x20, 0x01, 0x28, 0x08,
+	0x52, 0x04, 0x77, 0x61, 0x73, 0x6d, 0x12, 0x29, 0x0a, 0x10, 0x70, 0x72, 0x6f, 0x74, 0x6f, 0x63,
+	0x6f, 0x6c, 0x5f, 0x76, 0x65, 0x72, 0x73, 0x69, 0x6f, 0x6e, 0x18, 0x07, 0x20, 0x01, 0x28, 0x0d,
+	0x52, 0x0f, 0x70, 0x72, 0x6f, 0x74, 0x6f, 0x63, 0x6f, 0x6c, 0x56, 0x65, 0x72, 0x73, 0x69, 0x6f,
+	0x6e, 0x12, 0x14, 0x0a, 0x05, 0x73, 0x6c, 0x6f, 0x74, 0x73, 0x18, 0x08, 0x20, 0x01, 0x28, 0x0d,
+	0x52, 0x05, 0x73, 0x6c, 0x6f, 0x74, 0x73, 0x12, 0x27, 0x0a, 0x0f, 0x61, 0x64, 0x6d, 0x69, 0x73,
+	0x73, 0x69, 0x6f, 0x6e, 0x5f, 0x74, 0x6f, 0x6b, 0x65, 0x6e, 0x18, 0x09, 0x20, 0x01, 0x28, 0x09,
+	0x52, 0x0e, 0x61, 0x64, 0x6d, 0x69, 0x73, 0x73, 0x69, 0x6f, 0x6e, 0x54, 0x6f, 0x6b, 0x65, 0x6e,
+	0x22, 0x2f, 0x0a, 0x10, 0x46, 0x65, 0x74, 0x63, 0x68, 0x46, 0x75, 0x6e, 0x63, 0x50, 0x61, 0x79,
+	0x6c, 0x6f, 0x61, 0x64, 0x12, 0x1b, 0x0a, 0x09, 0x66, 0x75, 0x6e, 0x63, 0x5f, 0x68, 0x61, 0x73,
+	0x68, 0x18, 0x01, 0x20, 0x01, 0x28, 0x09, 0x52, 0x08, 0x66, 0x75, 0x6e, 0x63, 0x48, 0x61, 0x73,
+	0x68, 0x22, 0x58, 0x0a, 0x0f, 0x46, 0x75, 0x6e, 0x63, 0x44, 0x61, 0x74, 0x61, 0x50, 0x61, 0x79,
+	0x6c, 0x6f, 0x61, 0x64, 0x12, 0x1b, 0x0a, 0x09, 0x66, 0x75, 0x6e, 0x63, 0x5f, 0x68, 0x61, 0x73,
+	0x68, 0x18, 0x01, 0x20, 0x01, 0x28, 0x09, 0x52, 0x08, 0x66, 0x75, 0x6e, 0x63, 0x48, 0x61, 0x73,
+	0x68, 0x12, 0x12, 0x0a, 0x04, 0x63, 0x6f, 0x64, 0x65, 0x18, 0x02, 0x20, 0x01, 0x28, 0x0c, 0x52,
+	0x04, 0x63, 0x6f, 0x64, 0x65, 0x12, 0x14, 0x0a, 0x05, 0x65, 0x72, 0x72, 0x6f, 0x72, 0x18, 0x03,
+	0x20, 0x01, 0x28, 0x09, 0x52, 0x05, 0x65, 0x72, 0x72, 0x6f, 0x72, 0x2a, 0x6f, 0x0a, 0x03, 0x43,
+	0x4d, 0x44, 0x12, 0x0b, 0x0a, 0x07, 0x55, 0x6e, 0x6b, 0x6e, 0x6f, 0x77, 0x6e, 0x10, 0x00, 0x12,
+	0x0c, 0x0a, 0x08, 0x52, 0x65, 0x67, 0x69, 0x73, 0x74, 0x65, 0x72, 0x10, 0x01, 0x12, 0x09, 0x0a,
+	0x05, 0x43, 0x6c, 0x6f, 0x73, 0x65, 0x10, 0x02, 0x12, 0x0a, 0x0a, 0x06, 0x53, 0x74, 0x61, 0x74,
+	0x75, 0x73, 0x10, 0x03, 0x12, 0x0a, 0x0a, 0x06, 0x41, 0x73, 0x73, 0x69, 0x67, 0x6e, 0x10, 0x04,
+	0x12, 0x0d, 0x0a, 0x09, 0x49, 0x6e, 0x74, 0x65, 0x72, 0x72, 0x75, 0x70, 0x74, 0x10, 0x05, 0x12,
+	0x0d, 0x0a, 0x09, 0x46, 0x65, 0x74, 0x63, 0x68, 0x46, 0x75, 0x6e, 0x63, 0x10, 0x06, 0x12, 0x0c,
+	0x0a, 0x08, 0x46, 0x75, 0x6e, 0x63, 0x44, 0x61, 0x74, 0x61, 0x10, 0x07, 0x2a, 0x2f, 0x0a, 0x0c,
+	0x57, 0x6f, 0x72, 0x6b, 0x65, 0x72, 0x53, 0x74, 0x61, 0x74, 0x75, 0x73, 0x12, 0x08, 0x0a, 0x04,
+	0x49, 0x64, 0x6c, 0x65, 0x10, 0x00, 0x12, 0x08, 0x0a, 0x04, 0x42, 0x75, 0x73, 0x79, 0x10, 0x01,
+	0x12, 0x0b, 0x0a, 0x07, 0x43, 0x6c, 0x6f, 0x73, 0x69, 0x6e, 0x67, 0x10, 0x02, 0x2a, 0x43, 0x0a,
+	0x0a, 0x54, 0x61, 0x73, 0x6b, 0x53, 0x74, 0x61, 0x74, 0x75, 0x73, 0x12, 0x0b, 0x0a, 0x07, 0x52,
+	0x75, 0x6e, 0x6e, 0x69, 0x6e, 0x67, 0x10, 0x00, 0x12, 0x0c, 0x0a, 0x08, 0x46, 0x69, 0x6e, 0x69,
+	0x73, 0x68, 0x65, 0x64, 0x10, 0x01, 0x12, 0x09, 0x0a, 0x05, 0x45, 0x72, 0x72, 0x6f, 0x72, 0x10,
+	0x02, 0x12, 0x0f, 0x0a, 0x0b, 0x49, 0x6e, 0x74, 0x65, 0x72, 0x72, 0x75, 0x70, 0x74, 0x65, 0x64,
+	0x10, 0x03, 0x2a, 0x40, 0x0a, 0x0b, 0x43, 0x6f, 0x6e, 0x74, 0x65, 0x6e, 0x74, 0x54, 0x79, 0x70,
+	0x65, 0x12, 0x08, 0x0a, 0x04, 0x54, 0x65, 0x78, 0x74, 0x10, 0x00, 0x12, 0x07, 0x0a, 0x03, 0x52,
+	0x61, 0x77, 0x10, 0x01, 0x12, 0x08, 0x0a, 0x04, 0x4a, 0x73, 0x6f, 0x6e, 0x10, 0x02, 0x12, 0x07,
+	0x0a, 0x03, 0x41, 0x6e, 0x79, 0x10, 0x03, 0x12, 0x0b, 0x0a, 0x07, 0x4d, 0x73, 0x67, 0x70, 0x61,
+	0x63, 0x6b, 0x10, 0x04, 0x42, 0x07, 0x5a, 0x05, 0x2e, 0x2f, 0x61, 0x70, 0x69, 0x62, 0x06, 0x70,
+	0x72, 0x6f, 0x74, 0x6f, 0x33,
 }
 
 var (
@@ -581,31 +1063,42 @@ func file_api_proto_rawDescGZIP() []byte {
 	return file_api_proto_rawDescData
 }
 
-var file_api_proto_enumTypes = make([]protoimpl.EnumInfo, 3)
-var file_api_proto_msgTypes = make([]protoimpl.MessageInfo, 5)
+var file_api_proto_enumTypes = make([]protoimpl.EnumInfo, 4)
+var file_api_proto_msgTypes = make([]protoimpl.MessageInfo, 9)
 var file_api_proto_goTypes = []interface{}{
 	(CMD)(0),                 // 0: api.CMD
 	(WorkerStatus)(0),        // 1: api.WorkerStatus
 	(TaskStatus)(0),          // 2: api.TaskStatus
-	(*Msg)(nil),              // 3: api.Msg
-	(*StatusPayload)(nil),    // 4: api.StatusPayload
-	(*AssignPayload)(nil),    // 5: api.AssignPayload
-	(*InterruptPayload)(nil), // 6: api.InterruptPayload
-	(*EmptyPayload)(nil),     // 7: api.EmptyPayload
+	(ContentType)(0),         // 3: api.ContentType
+	(*Msg)(nil),              // 4: api.Msg
+	(*Payload)(nil),          // 5: api.Payload
+	(*StatusPayload)(nil),    // 6: api.StatusPayload
+	(*AssignPayload)(nil),    // 7: api.AssignPayload
+	(*InterruptPayload)(nil), // 8: api.InterruptPayload
+	(*EmptyPayload)(nil),     // 9: api.EmptyPayload
+	(*RegisterPayload)(nil),  // 10: api.RegisterPayload
+	(*FetchFuncPayload)(nil), // 11: api.FetchFuncPayload
+	(*FuncDataPayload)(nil),  // 12: api.FuncDataPayload
 }
 var file_api_proto_depIdxs = []int32{
-	0, // 0: api.Msg.cmd:type_name -> api.CMD
-	4, // 1: api.Msg.status:type_name -> api.StatusPayload
-	5, // 2: api.Msg.assign:type_name -> api.AssignPayload
-	6, // 3: api.Msg.interrupt:type_name -> api.InterruptPayload
-	7, // 4: api.Msg.empty:type_name -> api.EmptyPayload
-	1, // 5: api.StatusPayload.work_status:type_name -> api.WorkerStatus
-	2, // 6: api.StatusPayload.task_status:type_name -> api.TaskStatus
-	7, // [7:7] is the sub-list for method output_type
-	7, // [7:7] is the sub-list for method input_type
-	7, // [7:7] is the sub-list for extension type_name
-	7, // [7:7] is the sub-list for extension extendee
-	0, // [0:7] is the sub-list for field type_name
+	0,  // 0: api.Msg.cmd:type_name -> api.CMD
+	6,  // 1: api.Msg.status:type_name -> api.StatusPayload
+	7,  // 2: api.Msg.assign:type_name -> api.AssignPayload
+	8,  // 3: api.Msg.interrupt:type_name -> api.InterruptPayload
+	9,  // 4: api.Msg.empty:type_name -> api.EmptyPayload
+	10, // 5: api.Msg.register:type_name -> api.RegisterPayload
+	11, // 6: api.Msg.fetch_func:type_name -> api.FetchFuncPayload
+	12, // 7: api.Msg.func_data:type_name -> api.FuncDataPayload
+	3,  // 8: api.Payload.content_type:type_name -> api.ContentType
+	1,  // 9: api.StatusPayload.work_status:type_name -> api.WorkerStatus
+	2,  // 10: api.StatusPayload.task_status:type_name -> api.TaskStatus
+	5,  // 11: api.StatusPayload.result:type_name -> api.Payload
+	5,  // 12: api.AssignPayload.input:type_name -> api.Payload
+	13, // [13:13] is the sub-list for method output_type
+	13, // [13:13] is the sub-list for method input_type
+	13, // [13:13] is the sub-list for extension type_name
+	13, // [13:13] is the sub-list for extension extendee
+	0,  // [0:13] is the sub-list for field type_name
 }
 
 func init() { file_api_proto_init() }
@@ -627,7 +1120,7 @@ func file_api_proto_init() {
 			}
 		}
 		file_api_proto_msgTypes[1].Exporter = func(v interface{}, i int) interface{} {
-			switch v := v.(*StatusPayload); i {
+			switch v := v.(*Payload); i {
 			case 0:
 				return &v.state
 			case 1:
@@ -639,7 +1132,7 @@ func file_api_proto_init() {
 			}
 		}
 		file_api_proto_msgTypes[2].Exporter = func(v interface{}, i int) interface{} {
-			switch v := v.(*AssignPayload); i {
+			switch v := v.(*StatusPayload); i {
 			case 0:
 				return &v.state
 			case 1:
@@ -651,7 +1144,7 @@ func file_api_proto_init() {
 			}
 		}
 		file_api_proto_msgTypes[3].Exporter = func(v interface{}, i int) interface{} {
-			switch v := v.(*InterruptPayload); i {
+			switch v := v.(*AssignPayload); i {
 			case 0:
 				return &v.state
 			case 1:
@@ -663,6 +1156,18 @@ func file_api_proto_init() {
 			}
 		}
 		file_api_proto_msgTypes[4].Exporter = func(v interface{}, i int) interface{} {
+			switch v := v.(*InterruptPayload); i {
+			case 0:
+				return &v.state
+			case 1:
+				return &v.sizeCache
+			case 2:
+				return &v.unknownFields
+			default:
+				return nil
+			}
+		}
+		file_api_proto_msgTypes[5].Exporter = func(v interface{}, i int) interface{} {
 			switch v := v.(*EmptyPayload); i {
 			case 0:
 				return &v.state
@@ -674,20 +1179,59 @@ func file_api_proto_init() {
 				return nil
 			}
 		}
+		file_api_proto_msgTypes[6].Exporter = func(v interface{}, i int) interface{} {
+			switch v := v.(*RegisterPayload); i {
+			case 0:
+				return &v.state
+			case 1:
+				return &v.sizeCache
+			case 2:
+				return &v.unknownFields
+			default:
+				return nil
+			}
+		}
+		file_api_proto_msgTypes[7].Exporter = func(v interface{}, i int) interface{} {
+			switch v := v.(*FetchFuncPayload); i {
+			case 0:
+				return &v.state
+			case 1:
+				return &v.sizeCache
+			case 2:
+				return &v.unknownFields
+			default:
+				return nil
+			}
+		}
+		file_api_proto_msgTypes[8].Exporter = func(v interface{}, i int) interface{} {
+			switch v := v.(*FuncDataPayload); i {
+			case 0:
+				return &v.state
+			case 1:
+				return &v.sizeCache
+			case 2:
+				return &v.unknownFields
+			default:
+				return nil
+			}
+		}
 	}
 	file_api_proto_msgTypes[0].OneofWrappers = []interface{}{
 		(*Msg_Status)(nil),
 		(*Msg_Assign)(nil),
 		(*Msg_Interrupt)(nil),
 		(*Msg_Empty)(nil),
+		(*Msg_Register)(nil),
+		(*Msg_FetchFunc)(nil),
+		(*Msg_FuncData)(nil),
 	}
 	type x struct{}
 	out := protoimpl.TypeBuilder{
 		File: protoimpl.DescBuilder{
 			GoPackagePath: reflect.TypeOf(x{}).PkgPath(),
 			RawDescriptor: file_api_proto_rawDesc,
-			NumEnums:      3,
-			NumMessages:   5,
+			NumEnums:      4,
+			NumMessages:   9,
 			NumExtensions: 0,
 			NumServices:   0,
 		},
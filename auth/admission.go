@@ -0,0 +1,438 @@
+package auth
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"github.com/pkg/errors"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// workerTokenPrefix tells worker token apart from admin tokens in logs and configs
+const workerTokenPrefix = "wt_"
+
+var (
+	// ErrAdmissionDenied means worker is banned, or its token is missing, unknown, expired or bound to other worker
+	ErrAdmissionDenied     = errors.New("admission denied")
+	ErrTooManyConnections  = errors.New("too many connections")
+	ErrWorkerTokenNotFound = errors.New("worker token not found")
+	ErrBanNotFound         = errors.New("worker not banned")
+)
+
+// WorkerToken admits worker at register, its secret is only returned when issued and kept hashed
+type WorkerToken struct {
+	Id string `json:"id"`
+	// WorkerId binds token to the worker, token without worker id admits any worker
+	WorkerId  string     `json:"workerId,omitempty"`
+	Note      string     `json:"note,omitempty"`
+	IssuedBy  string     `json:"issuedBy,omitempty"`
+	CreatedAt time.Time  `json:"createdAt"`
+	ExpiresAt *time.Time `json:"expiresAt,omitempty"`
+}
+
+func (t *WorkerToken) expired(now time.Time) bool {
+	return t.ExpiresAt != nil && !now.Before(*t.ExpiresAt)
+}
+
+type storedToken struct {
+	*WorkerToken
+	Hash string `json:"hash"`
+}
+
+// Ban rejects worker id, and principal of the worker if known, so that the client can not come back as another worker id
+type Ban struct {
+	WorkerId  string    `json:"workerId"`
+	Principal string    `json:"principal,omitempty"`
+	Reason    string    `json:"reason,omitempty"`
+	BannedBy  string    `json:"bannedBy,omitempty"`
+	BannedAt  time.Time `json:"bannedAt"`
+}
+
+// admissionState is persisted, so that issued tokens and bans survive restart
+type admissionState struct {
+	Tokens []*storedToken `json:"tokens"`
+	Bans   []*Ban         `json:"bans"`
+}
+
+// Admission decides which clients connect to scheduler and register as worker: origin of browser worker is checked
+// against allowlist, connections per IP are limited, banned workers are rejected, and tokens are checked if required
+type Admission struct {
+	statePath     string
+	requireToken  bool
+	origins       []string
+	maxConnsPerIP int
+
+	lock   sync.RWMutex
+	tokens map[string]*storedToken
+	bans   map[string]*Ban
+	conns  map[string]int
+	now    func() time.Time
+
+	// principalBans indexes bans by principal
+	principalBans map[string]*Ban
+}
+
+type AdmissionOption func(a *Admission)
+
+// WithRequiredToken admits only workers registering with token issued by admin
+func WithRequiredToken() AdmissionOption {
+	return func(a *Admission) {
+		a.requireToken = true
+	}
+}
+
+// WithAllowedOrigins allows browser worker of origin matching any pattern, e.g. https://*.example.com, * allows any,
+// only same origin is allowed without pattern
+func WithAllowedOrigins(patterns ...string) AdmissionOption {
+	return func(a *Admission) {
+		for _, p := range patterns {
+			a.origins = append(a.origins, strings.ToLower(p))
+		}
+	}
+}
+
+// WithMaxConnectionsPerIP limits concurrent connections from one remote IP, 0 means unlimited
+func WithMaxConnectionsPerIP(n int) AdmissionOption {
+	return func(a *Admission) {
+		a.maxConnsPerIP = n
+	}
+}
+
+// WithAdmissionState persists issued tokens and bans to file
+func WithAdmissionState(path string) AdmissionOption {
+	return func(a *Admission) {
+		a.statePath = path
+	}
+}
+
+func (a *Admission) TokenRequired() bool {
+	return a.requireToken
+}
+
+// CheckOrigin allows client without Origin header, which is not a browser, and browser of allowed origin
+func (a *Admission) CheckOrigin(r *http.Request) bool {
+	origin := strings.ToLower(r.Header.Get("Origin"))
+	if origin == "" {
+		return true
+	}
+
+	if len(a.origins) == 0 {
+		u, err := url.Parse(origin)
+		return err == nil && strings.EqualFold(u.Host, r.Host)
+	}
+
+	for _, pattern := range a.origins {
+		if matched, _ := path.Match(pattern, origin); matched || pattern == "*" {
+			return true
+		}
+	}
+	return false
+}
+
+// Connect counts connection of remote address against per IP limit, release should be called once connection closed
+func (a *Admission) Connect(remoteAddr string) (release func(), err error) {
+	ip := ipOf(remoteAddr)
+	a.lock.Lock()
+	defer a.lock.Unlock()
+	if a.maxConnsPerIP > 0 && a.conns[ip] >= a.maxConnsPerIP {
+		return nil, errors.Wrapf(ErrTooManyConnections, "%s has %d connections", ip, a.conns[ip])
+	}
+
+	a.conns[ip]++
+	var once sync.Once
+	return func() {
+		once.Do(func() {
+			a.lock.Lock()
+			defer a.lock.Unlock()
+			if a.conns[ip]--; a.conns[ip] <= 0 {
+				delete(a.conns, ip)
+			}
+		})
+	}, nil
+}
+
+// Principal identifies admitted worker by what its client can not choose freely, unlike worker id:
+// id of its token if registered with one, otherwise its IP
+func (a *Admission) Principal(remoteAddr, token string) string {
+	a.lock.RLock()
+	defer a.lock.RUnlock()
+	return a.principal(remoteAddr, token)
+}
+
+func (a *Admission) principal(remoteAddr, token string) string {
+	if token != "" {
+		if t, exist := a.tokens[hashToken(token)]; exist {
+			return "token:" + t.Id
+		}
+	}
+	return "ip:" + ipOf(remoteAddr)
+}
+
+func ipOf(remoteAddr string) string {
+	ip, _, err := net.SplitHostPort(remoteAddr)
+	if err != nil {
+		return remoteAddr
+	}
+	return ip
+}
+
+// Admit checks worker registering from remote address with token, neither worker id nor principal of it should be banned,
+// token is checked whenever given even if not required
+func (a *Admission) Admit(workerId, remoteAddr, token string) error {
+	a.lock.RLock()
+	defer a.lock.RUnlock()
+	if ban, banned := a.bans[workerId]; banned {
+		return errors.Wrapf(ErrAdmissionDenied, "worker %s banned: %s", workerId, ban.Reason)
+	}
+	if ban, banned := a.principalBans[a.principal(remoteAddr, token)]; banned {
+		return errors.Wrapf(ErrAdmissionDenied, "worker %s registers as %s banned along with worker %s: %s",
+			workerId, ban.Principal, ban.WorkerId, ban.Reason)
+	}
+
+	if token == "" {
+		if a.requireToken {
+			return errors.Wrapf(ErrAdmissionDenied, "worker %s registers without token", workerId)
+		}
+		return nil
+	}
+
+	t, exist := a.tokens[hashToken(token)]
+	switch {
+	case !exist:
+		return errors.Wrapf(ErrAdmissionDenied, "worker %s registers with unknown token", workerId)
+	case t.expired(a.now()):
+		return errors.Wrapf(ErrAdmissionDenied, "worker %s registers with token %s expired", workerId, t.Id)
+	case t.WorkerId != "" && t.WorkerId != workerId:
+		return errors.Wrapf(ErrAdmissionDenied, "worker %s registers with token %s of worker %s", workerId, t.Id, t.WorkerId)
+	}
+	return nil
+}
+
+// Banned tells whether worker registered is banned by its id or principal
+func (a *Admission) Banned(workerId, principal string) bool {
+	a.lock.RLock()
+	defer a.lock.RUnlock()
+	_, banned := a.bans[workerId]
+	_, principalBanned := a.principalBans[principal]
+	return banned || principalBanned
+}
+
+// IssueToken issues token admits given worker, or any worker if worker id is empty, ttl 0 means never expire
+func (a *Admission) IssueToken(workerId, note, issuedBy string, ttl time.Duration) (string, *WorkerToken, error) {
+	id, err := randomString(8, hex.EncodeToString)
+	if err != nil {
+		return "", nil, err
+	}
+
+	secret, err := randomString(32, base64.RawURLEncoding.EncodeToString)
+	if err != nil {
+		return "", nil, err
+	}
+	secret = workerTokenPrefix + secret
+
+	t := &WorkerToken{Id: id, WorkerId: workerId, Note: note, IssuedBy: issuedBy, CreatedAt: a.now()}
+	if ttl > 0 {
+		expiresAt := t.CreatedAt.Add(ttl)
+		t.ExpiresAt = &expiresAt
+	}
+
+	hash := hashToken(secret)
+	a.lock.Lock()
+	defer a.lock.Unlock()
+	a.tokens[hash] = &storedToken{WorkerToken: t, Hash: hash}
+	if err := a.save(); err != nil {
+		delete(a.tokens, hash)
+		return "", nil, err
+	}
+	return secret, t, nil
+}
+
+// RevokeToken stops admitting workers by token, workers already registered are not affected
+func (a *Admission) RevokeToken(id string) error {
+	a.lock.Lock()
+	defer a.lock.Unlock()
+	for hash, t := range a.tokens {
+		if t.Id == id {
+			delete(a.tokens, hash)
+			return a.save()
+		}
+	}
+	return errors.Wrapf(ErrWorkerTokenNotFound, "token id: %s", id)
+}
+
+func (a *Admission) Tokens() []*WorkerToken {
+	a.lock.RLock()
+	defer a.lock.RUnlock()
+	tokens := make([]*WorkerToken, 0, len(a.tokens))
+	for _, t := range a.tokens {
+		tokens = append(tokens, t.WorkerToken)
+	}
+
+	sort.Slice(tokens, func(i, j int) bool { return tokens[i].CreatedAt.Before(tokens[j].CreatedAt) })
+	return tokens
+}
+
+// Ban rejects worker of given id from registering, along with any worker of principal if given, see Principal,
+// banning again updates the reason and principal
+func (a *Admission) Ban(workerId, principal, reason, bannedBy string) (*Ban, error) {
+	ban := &Ban{WorkerId: workerId, Principal: principal, Reason: reason, BannedBy: bannedBy, BannedAt: a.now()}
+
+	a.lock.Lock()
+	defer a.lock.Unlock()
+	old := a.bans[workerId]
+	a.setBan(workerId, ban)
+	if err := a.save(); err != nil {
+		a.setBan(workerId, old)
+		return nil, err
+	}
+	return ban, nil
+}
+
+func (a *Admission) Unban(workerId string) error {
+	a.lock.Lock()
+	defer a.lock.Unlock()
+	old, banned := a.bans[workerId]
+	if !banned {
+		return errors.Wrapf(ErrBanNotFound, "worker id: %s", workerId)
+	}
+
+	a.setBan(workerId, nil)
+	if err := a.save(); err != nil {
+		a.setBan(workerId, old)
+		return err
+	}
+	return nil
+}
+
+// setBan replaces ban of worker id and its principal index with lock held, nil ban lifts it
+func (a *Admission) setBan(workerId string, ban *Ban) {
+	if old := a.bans[workerId]; old != nil && a.principalBans[old.Principal] == old {
+		delete(a.principalBans, old.Principal)
+	}
+
+	if ban == nil {
+		delete(a.bans, workerId)
+		return
+	}
+	a.bans[workerId] = ban
+	if ban.Principal != "" {
+		a.principalBans[ban.Principal] = ban
+	}
+}
+
+func (a *Admission) Bans() []*Ban {
+	a.lock.RLock()
+	defer a.lock.RUnlock()
+	bans := make([]*Ban, 0, len(a.bans))
+	for _, ban := range a.bans {
+		bans = append(bans, ban)
+	}
+
+	sort.Slice(bans, func(i, j int) bool { return bans[i].BannedAt.Before(bans[j].BannedAt) })
+	return bans
+}
+
+// save writes state file with lock held, nothing is persisted without state path
+func (a *Admission) save() error {
+	if a.statePath == "" {
+		return nil
+	}
+
+	state := &admissionState{Tokens: make([]*storedToken, 0, len(a.tokens)), Bans: make([]*Ban, 0, len(a.bans))}
+	for _, t := range a.tokens {
+		state.Tokens = append(state.Tokens, t)
+	}
+	for _, ban := range a.bans {
+		state.Bans = append(state.Bans, ban)
+	}
+
+	data, err := json.Marshal(state)
+	if err != nil {
+		return errors.Wrap(err, "marshal admission state")
+	}
+
+	tmp := a.statePath + ".tmp"
+	if err := ioutil.WriteFile(tmp, data, 0600); err != nil {
+		return errors.Wrap(err, "write admission state")
+	}
+	return errors.Wrap(os.Rename(tmp, a.statePath), "write admission state")
+}
+
+func (a *Admission) load() error {
+	data, err := ioutil.ReadFile(a.statePath)
+	if os.IsNotExist(err) {
+		return nil
+	} else if err != nil {
+		return errors.Wrap(err, "read admission state")
+	}
+
+	state := &admissionState{}
+	if err := json.Unmarshal(data, state); err != nil {
+		return errors.Wrap(err, "unmarshal admission state")
+	}
+
+	for _, t := range state.Tokens {
+		a.tokens[t.Hash] = t
+	}
+	for _, ban := range state.Bans {
+		a.setBan(ban.WorkerId, ban)
+	}
+	return nil
+}
+
+func hashToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
+
+func randomString(n int, encode func([]byte) string) (string, error) {
+	b := make([]byte, n)
+	if _, err := rand.Read(b); err != nil {
+		return "", errors.Wrap(err, "generate random")
+	}
+	return encode(b), nil
+}
+
+func NewAdmission(opts ...AdmissionOption) (*Admission, error) {
+	a := &Admission{
+		tokens:        make(map[string]*storedToken),
+		bans:          make(map[string]*Ban),
+		principalBans: make(map[string]*Ban),
+		conns:         make(map[string]int),
+		now:           time.Now,
+	}
+	for _, opt := range opts {
+		opt(a)
+	}
+
+	for _, pattern := range a.origins {
+		if _, err := path.Match(pattern, ""); err != nil {
+			return nil, errors.Wrapf(err, "origin pattern %q", pattern)
+		}
+	}
+
+	if a.statePath == "" {
+		return a, nil
+	}
+
+	if err := os.MkdirAll(filepath.Dir(a.statePath), 0755); err != nil {
+		return nil, errors.Wrap(err, "create admission state dir")
+	}
+
+	if err := a.load(); err != nil {
+		return nil, err
+	}
+	return a, nil
+}
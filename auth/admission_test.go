@@ -0,0 +1,202 @@
+package auth
+
+import (
+	"github.com/pkg/errors"
+	. "github.com/smartystreets/goconvey/convey"
+	"io/ioutil"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+const workerAddr = "10.0.0.1:50000"
+
+func TestAdmission_ShouldAdmitWorkerByIssuedToken(t *testing.T) {
+	Convey("given admission requires token", t, func() {
+		dir, _ := ioutil.TempDir("", "admission")
+		defer os.RemoveAll(dir)
+		statePath := filepath.Join(dir, "admission.json")
+		a, err := NewAdmission(WithRequiredToken(), WithAdmissionState(statePath))
+		So(err, ShouldBeNil)
+
+		anyWorker, _, _ := a.IssueToken("", "lab", "ops", 0)
+		boundWorker, _, _ := a.IssueToken("worker-1", "", "ops", 0)
+		expiring, _, _ := a.IssueToken("", "", "ops", time.Hour)
+
+		Convey("then worker with valid token is admitted", func() {
+			So(a.Admit("worker-2", workerAddr, anyWorker), ShouldBeNil)
+			So(a.Admit("worker-1", workerAddr, boundWorker), ShouldBeNil)
+			So(a.Admit("worker-3", workerAddr, expiring), ShouldBeNil)
+		})
+
+		Convey("then worker is identified by its token rather than worker id, or by IP without token", func() {
+			id := a.Tokens()[0].Id
+			So(a.Principal("10.0.0.1:4321", anyWorker), ShouldEqual, "token:"+id)
+			So(a.Principal("10.0.0.2:4321", anyWorker), ShouldEqual, "token:"+id)
+			So(a.Principal("10.0.0.1:4321", ""), ShouldEqual, "ip:10.0.0.1")
+			So(a.Principal("10.0.0.1:1234", "wt_guessed"), ShouldEqual, "ip:10.0.0.1")
+		})
+
+		Convey("then worker without, with unknown, others' or expired token is denied", func() {
+			So(errors.Cause(a.Admit("worker-2", workerAddr, "")), ShouldEqual, ErrAdmissionDenied)
+			So(errors.Cause(a.Admit("worker-2", workerAddr, "wt_guessed")), ShouldEqual, ErrAdmissionDenied)
+			So(errors.Cause(a.Admit("worker-2", workerAddr, boundWorker)), ShouldEqual, ErrAdmissionDenied)
+
+			a.now = func() time.Time { return time.Now().Add(2 * time.Hour) }
+			So(errors.Cause(a.Admit("worker-3", workerAddr, expiring)), ShouldEqual, ErrAdmissionDenied)
+		})
+
+		Convey("when revoke token", func() {
+			tokens := a.Tokens()
+			So(tokens, ShouldHaveLength, 3)
+			So(tokens[0].Note, ShouldEqual, "lab")
+			So(a.RevokeToken(tokens[0].Id), ShouldBeNil)
+
+			Convey("then the token is denied, others still admitted after reload", func() {
+				So(errors.Cause(a.RevokeToken(tokens[0].Id)), ShouldEqual, ErrWorkerTokenNotFound)
+
+				reloaded, err := NewAdmission(WithRequiredToken(), WithAdmissionState(statePath))
+				So(err, ShouldBeNil)
+				So(reloaded.Tokens(), ShouldHaveLength, 2)
+				So(errors.Cause(reloaded.Admit("worker-2", workerAddr, anyWorker)), ShouldEqual, ErrAdmissionDenied)
+				So(reloaded.Admit("worker-1", workerAddr, boundWorker), ShouldBeNil)
+			})
+		})
+	})
+}
+
+func TestAdmission_ShouldDenyBannedWorker(t *testing.T) {
+	Convey("given admission without token required", t, func() {
+		dir, _ := ioutil.TempDir("", "admission")
+		defer os.RemoveAll(dir)
+		statePath := filepath.Join(dir, "admission.json")
+		a, _ := NewAdmission(WithAdmissionState(statePath))
+
+		Convey("then any worker is admitted, given token is still checked", func() {
+			So(a.Admit("worker-1", workerAddr, ""), ShouldBeNil)
+			So(errors.Cause(a.Admit("worker-1", workerAddr, "wt_guessed")), ShouldEqual, ErrAdmissionDenied)
+		})
+
+		Convey("when ban worker", func() {
+			_, err := a.Ban("worker-1", "", "fake results", "ops")
+			So(err, ShouldBeNil)
+
+			Convey("then it is denied even after reload, until unbanned", func() {
+				So(a.Banned("worker-1", ""), ShouldBeTrue)
+				So(errors.Cause(a.Admit("worker-1", workerAddr, "")), ShouldEqual, ErrAdmissionDenied)
+
+				reloaded, _ := NewAdmission(WithAdmissionState(statePath))
+				So(reloaded.Bans(), ShouldHaveLength, 1)
+				So(reloaded.Bans()[0].Reason, ShouldEqual, "fake results")
+				So(errors.Cause(reloaded.Admit("worker-1", workerAddr, "")), ShouldEqual, ErrAdmissionDenied)
+
+				So(a.Unban("worker-1"), ShouldBeNil)
+				So(a.Admit("worker-1", workerAddr, ""), ShouldBeNil)
+				So(errors.Cause(a.Unban("worker-1")), ShouldEqual, ErrBanNotFound)
+			})
+		})
+	})
+}
+
+func TestAdmission_ShouldDenyAnyWorkerOfBannedPrincipal(t *testing.T) {
+	Convey("given admission with token issued", t, func() {
+		a, _ := NewAdmission()
+		token, issued, _ := a.IssueToken("", "", "ops", 0)
+		principal := a.Principal(workerAddr, token)
+
+		Convey("when ban worker along with its principal", func() {
+			_, err := a.Ban("worker-1", principal, "fake results", "ops")
+			So(err, ShouldBeNil)
+
+			Convey("then client is denied under another worker id, until unbanned", func() {
+				So(principal, ShouldEqual, "token:"+issued.Id)
+				So(a.Banned("worker-2", principal), ShouldBeTrue)
+				So(errors.Cause(a.Admit("worker-2", "10.0.0.2:50000", token)), ShouldEqual, ErrAdmissionDenied)
+				So(a.Admit("worker-2", workerAddr, ""), ShouldBeNil)
+
+				So(a.Unban("worker-1"), ShouldBeNil)
+				So(a.Banned("worker-2", principal), ShouldBeFalse)
+				So(a.Admit("worker-2", "10.0.0.2:50000", token), ShouldBeNil)
+			})
+		})
+	})
+}
+
+func TestAdmission_ShouldCheckOriginAgainstAllowlist(t *testing.T) {
+	check := func(a *Admission, origin string) bool {
+		r := httptest.NewRequest("GET", "http://scheduler.example.com/connect", nil)
+		if origin != "" {
+			r.Header.Set("Origin", origin)
+		}
+		return a.CheckOrigin(r)
+	}
+
+	Convey("given admission without allowed origins", t, func() {
+		a, _ := NewAdmission()
+
+		Convey("then only same origin and non-browser client are allowed", func() {
+			So(check(a, ""), ShouldBeTrue)
+			So(check(a, "https://scheduler.example.com"), ShouldBeTrue)
+			So(check(a, "https://evil.com"), ShouldBeFalse)
+		})
+	})
+
+	Convey("given admission with allowed origin patterns", t, func() {
+		a, err := NewAdmission(WithAllowedOrigins("https://*.Workers.io", "http://localhost:3000"))
+		So(err, ShouldBeNil)
+
+		Convey("then only matched origins are allowed", func() {
+			So(check(a, "https://a.workers.io"), ShouldBeTrue)
+			So(check(a, "http://localhost:3000"), ShouldBeTrue)
+			So(check(a, "https://workers.io.evil.com"), ShouldBeFalse)
+			So(check(a, "https://scheduler.example.com"), ShouldBeFalse)
+		})
+	})
+
+	Convey("given admission allows any origin", t, func() {
+		a, _ := NewAdmission(WithAllowedOrigins("*"))
+
+		Convey("then any origin is allowed", func() {
+			So(check(a, "https://evil.com"), ShouldBeTrue)
+		})
+	})
+
+	Convey("given malformed origin pattern", t, func() {
+		_, err := NewAdmission(WithAllowedOrigins("https://[a"))
+
+		Convey("then admission is not created", func() {
+			So(err, ShouldNotBeNil)
+		})
+	})
+}
+
+func TestAdmission_ShouldLimitConnectionsPerIP(t *testing.T) {
+	Convey("given admission limits 2 connections per IP", t, func() {
+		a, _ := NewAdmission(WithMaxConnectionsPerIP(2))
+		release1, err1 := a.Connect("10.0.0.1:5001")
+		_, err2 := a.Connect("10.0.0.1:5002")
+
+		Convey("then third connection from the IP is rejected, others' are not", func() {
+			So(err1, ShouldBeNil)
+			So(err2, ShouldBeNil)
+			_, err := a.Connect("10.0.0.1:5003")
+			So(errors.Cause(err), ShouldEqual, ErrTooManyConnections)
+			_, err = a.Connect("10.0.0.2:5001")
+			So(err, ShouldBeNil)
+		})
+
+		Convey("when a connection released, even twice", func() {
+			release1()
+			release1()
+
+			Convey("then one more connection is allowed", func() {
+				_, err := a.Connect("10.0.0.1:5003")
+				So(err, ShouldBeNil)
+				_, err = a.Connect("10.0.0.1:5004")
+				So(errors.Cause(err), ShouldEqual, ErrTooManyConnections)
+			})
+		})
+	})
+}
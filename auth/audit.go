@@ -0,0 +1,49 @@
+package auth
+
+import (
+	"encoding/json"
+	"github.com/TD-Hackathon-2022/DCoB-Scheduler/comm"
+	"io"
+	"sync"
+	"time"
+)
+
+var log = comm.GetLogger()
+
+type AuditEntry struct {
+	Time      time.Time  `json:"time"`
+	Remote    string     `json:"remote"`
+	Method    string     `json:"method"`
+	Path      string     `json:"path"`
+	Principal *Principal `json:"principal,omitempty"`
+	Required  string     `json:"required"`
+	Status    int        `json:"status"`
+	Reason    string     `json:"reason"`
+}
+
+// AuditLog writes one JSON entry per line, nil audit log writes nothing
+type AuditLog struct {
+	lock sync.Mutex
+	enc  *json.Encoder
+}
+
+func (a *AuditLog) Record(e *AuditEntry) {
+	log.Warnf("Admin request denied: %s %s from %s, %s", e.Method, e.Path, e.Remote, e.Reason)
+	if a == nil {
+		return
+	}
+
+	if e.Time.IsZero() {
+		e.Time = time.Now()
+	}
+
+	a.lock.Lock()
+	defer a.lock.Unlock()
+	if err := a.enc.Encode(e); err != nil {
+		log.Errorf("write audit log: %v", err)
+	}
+}
+
+func NewAuditLog(w io.Writer) *AuditLog {
+	return &AuditLog{enc: json.NewEncoder(w)}
+}
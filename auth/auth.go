@@ -0,0 +1,140 @@
+package auth
+
+import (
+	"github.com/gin-gonic/gin"
+	"github.com/pkg/errors"
+	"net/http"
+	"strings"
+)
+
+var (
+	// ErrNoCredentials means request carries no credentials the authenticator understands, next one may try
+	ErrNoCredentials = errors.New("no credentials")
+	// ErrUnauthenticated means request carries credentials the authenticator understands, but invalid
+	ErrUnauthenticated = errors.New("unauthenticated")
+)
+
+// Role permits its own operations and those of lower roles: viewer reads, submitter runs jobs and uploads funcs,
+// operator controls scheduler and jobs
+type Role int
+
+const (
+	Viewer Role = iota + 1
+	Submitter
+	Operator
+)
+
+var roleNames = map[Role]string{Viewer: "viewer", Submitter: "submitter", Operator: "operator"}
+
+func (r Role) String() string {
+	if name, ok := roleNames[r]; ok {
+		return name
+	}
+	return "none"
+}
+
+func (r Role) MarshalText() ([]byte, error) {
+	return []byte(r.String()), nil
+}
+
+func (r *Role) UnmarshalText(text []byte) (err error) {
+	*r, err = ParseRole(string(text))
+	return err
+}
+
+func ParseRole(name string) (Role, error) {
+	for role, n := range roleNames {
+		if strings.EqualFold(n, name) {
+			return role, nil
+		}
+	}
+	return 0, errors.Errorf("role %q is not one of viewer, submitter, operator", name)
+}
+
+// Principal is the authenticated caller
+type Principal struct {
+	Name string `json:"name"`
+	Role Role   `json:"role"`
+	// Method authenticated the caller: token, hmac or cert
+	Method string `json:"method"`
+}
+
+type Authenticator interface {
+	Authenticate(r *http.Request) (*Principal, error)
+}
+
+const principalKey = "principal"
+
+// Guard authenticates admin requests by the first authenticator understands its credentials, and checks role,
+// denied requests are written to audit log, guard without authenticator denies everything unless it is open
+type Guard struct {
+	authenticators []Authenticator
+	audit          *AuditLog
+	open           bool
+}
+
+func (g *Guard) Enabled() bool {
+	return !g.open
+}
+
+// Require allows request of principal has at least given role
+func (g *Guard) Require(role Role) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if !g.Enabled() {
+			return
+		}
+
+		principal, err := g.authenticate(c.Request)
+		if err != nil {
+			g.deny(c, http.StatusUnauthorized, nil, role, err)
+			return
+		}
+
+		if principal.Role < role {
+			g.deny(c, http.StatusForbidden, principal, role, errors.Errorf("%s role required", role))
+			return
+		}
+		c.Set(principalKey, principal)
+	}
+}
+
+func (g *Guard) authenticate(r *http.Request) (*Principal, error) {
+	for _, a := range g.authenticators {
+		principal, err := a.Authenticate(r)
+		if errors.Cause(err) == ErrNoCredentials {
+			continue
+		}
+		return principal, err
+	}
+	return nil, ErrNoCredentials
+}
+
+func (g *Guard) deny(c *gin.Context, status int, principal *Principal, required Role, reason error) {
+	g.audit.Record(&AuditEntry{
+		Remote:    c.ClientIP(),
+		Method:    c.Request.Method,
+		Path:      c.Request.URL.Path,
+		Principal: principal,
+		Required:  required.String(),
+		Status:    status,
+		Reason:    reason.Error(),
+	})
+	c.AbortWithStatusJSON(status, gin.H{"error": http.StatusText(status)})
+}
+
+// PrincipalOf returns the caller authenticated by guard, nil if auth is disabled
+func PrincipalOf(c *gin.Context) *Principal {
+	if v, exist := c.Get(principalKey); exist {
+		return v.(*Principal)
+	}
+	return nil
+}
+
+func NewGuard(audit *AuditLog, authenticators ...Authenticator) *Guard {
+	return &Guard{authenticators: authenticators, audit: audit}
+}
+
+// NewOpenGuard allows everything, only for admin API protected by other means, e.g. reachable from trusted network only
+func NewOpenGuard() *Guard {
+	return &Guard{open: true}
+}
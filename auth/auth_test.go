@@ -0,0 +1,163 @@
+package auth
+
+import (
+	"bytes"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/json"
+	"github.com/gin-gonic/gin"
+	. "github.com/smartystreets/goconvey/convey"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+const (
+	viewerToken   = "viewer-token-0123456789"
+	operatorToken = "operator-token-0123456789"
+	hmacSecret    = "hmac-secret-0123456789"
+)
+
+func newTestRouter(guard *Guard) *gin.Engine {
+	gin.SetMode(gin.TestMode)
+	router := gin.New()
+	ok := func(c *gin.Context) { c.Status(http.StatusOK) }
+	router.GET("/admin/jobs", guard.Require(Viewer), ok)
+	router.POST("/admin/job/run", guard.Require(Submitter), ok)
+	router.POST("/admin/shutdown", guard.Require(Operator), ok)
+	return router
+}
+
+func serve(router *gin.Engine, r *http.Request) int {
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, r)
+	return w.Code
+}
+
+func TestGuard_ShouldCheckRoleOfTokenAndAuditDenial(t *testing.T) {
+	Convey("given guard with viewer and operator tokens", t, func() {
+		audit := &bytes.Buffer{}
+		router := newTestRouter(NewGuard(NewAuditLog(audit), NewTokenAuthenticator(map[string]*Principal{
+			viewerToken:   {Name: "dashboard", Role: Viewer},
+			operatorToken: {Name: "ops", Role: Operator},
+		})))
+		request := func(method, url, token string) *http.Request {
+			r := httptest.NewRequest(method, url, nil)
+			if token != "" {
+				r.Header.Set("Authorization", "Bearer "+token)
+			}
+			return r
+		}
+
+		Convey("then role permits its own and lower operations", func() {
+			So(serve(router, request(http.MethodGet, "/admin/jobs", viewerToken)), ShouldEqual, http.StatusOK)
+			So(serve(router, request(http.MethodPost, "/admin/shutdown", operatorToken)), ShouldEqual, http.StatusOK)
+			So(serve(router, request(http.MethodPost, "/admin/job/run", operatorToken)), ShouldEqual, http.StatusOK)
+			So(audit.Len(), ShouldEqual, 0)
+		})
+
+		Convey("then missing, unknown or insufficient credentials are denied and audited", func() {
+			So(serve(router, request(http.MethodGet, "/admin/jobs", "")), ShouldEqual, http.StatusUnauthorized)
+			So(serve(router, request(http.MethodGet, "/admin/jobs", "guessed-token")), ShouldEqual, http.StatusUnauthorized)
+			So(serve(router, request(http.MethodGet, "/admin/jobs?access_token="+viewerToken, "")), ShouldEqual, http.StatusUnauthorized)
+			So(serve(router, request(http.MethodPost, "/admin/shutdown", viewerToken)), ShouldEqual, http.StatusForbidden)
+
+			lines := strings.Split(strings.TrimSpace(audit.String()), "\n")
+			So(lines, ShouldHaveLength, 4)
+			entry := &AuditEntry{}
+			So(json.Unmarshal([]byte(lines[3]), entry), ShouldBeNil)
+			So(entry.Path, ShouldEqual, "/admin/shutdown")
+			So(entry.Status, ShouldEqual, http.StatusForbidden)
+			So(entry.Principal.Name, ShouldEqual, "dashboard")
+			So(entry.Required, ShouldEqual, "operator")
+		})
+	})
+}
+
+func TestGuard_ShouldVerifyHMACSignedRequest(t *testing.T) {
+	Convey("given guard with hmac key of submitter", t, func() {
+		router := newTestRouter(NewGuard(nil, NewHMACAuthenticator(map[string]*HMACKey{
+			"ci": {Secret: []byte(hmacSecret), Principal: &Principal{Name: "ci", Role: Submitter}},
+		}, time.Minute)))
+		signed := func(body, secret string, at time.Time) *http.Request {
+			r := httptest.NewRequest(http.MethodPost, "/admin/job/run?priority=1", strings.NewReader(body))
+			So(Sign(r, "ci", []byte(secret), at), ShouldBeNil)
+			return r
+		}
+
+		Convey("then signed request is allowed, and handler still reads body", func() {
+			r := signed(`{"func":"pi"}`, hmacSecret, time.Now())
+			So(serve(router, r), ShouldEqual, http.StatusOK)
+		})
+
+		Convey("then replayed or oversized request is denied", func() {
+			r := signed(`{"func":"pi"}`, hmacSecret, time.Now())
+			replayed := r.Clone(r.Context())
+			replayed.Body = ioutil.NopCloser(strings.NewReader(`{"func":"pi"}`))
+			So(serve(router, r), ShouldEqual, http.StatusOK)
+			So(serve(router, replayed), ShouldEqual, http.StatusUnauthorized)
+
+			noNonce := signed(`{}`, hmacSecret, time.Now())
+			noNonce.Header.Del(NonceHeader)
+			So(serve(router, noNonce), ShouldEqual, http.StatusUnauthorized)
+
+			limited := newTestRouter(NewGuard(nil, NewHMACAuthenticator(map[string]*HMACKey{
+				"ci": {Secret: []byte(hmacSecret), Principal: &Principal{Name: "ci", Role: Submitter}},
+			}, time.Minute, WithMaxSignedBodySize(8))))
+			So(serve(limited, signed(`{"func":"pi"}`, hmacSecret, time.Now())), ShouldEqual, http.StatusUnauthorized)
+			So(serve(limited, signed(`{}`, hmacSecret, time.Now())), ShouldEqual, http.StatusOK)
+		})
+
+		Convey("then tampered, wrongly signed or stale request is denied", func() {
+			tampered := signed(`{"func":"pi"}`, hmacSecret, time.Now())
+			tampered.URL.RawQuery = "priority=9"
+			So(serve(router, tampered), ShouldEqual, http.StatusUnauthorized)
+			So(serve(router, signed(`{}`, "wrong-secret-0123456789", time.Now())), ShouldEqual, http.StatusUnauthorized)
+			So(serve(router, signed(`{}`, hmacSecret, time.Now().Add(-time.Hour))), ShouldEqual, http.StatusUnauthorized)
+		})
+
+		Convey("then role is still checked", func() {
+			r := httptest.NewRequest(http.MethodPost, "/admin/shutdown", nil)
+			So(Sign(r, "ci", []byte(hmacSecret), time.Now()), ShouldBeNil)
+			So(serve(router, r), ShouldEqual, http.StatusForbidden)
+		})
+	})
+}
+
+func TestGuard_ShouldMapVerifiedClientCert(t *testing.T) {
+	Convey("given guard with cert of operator", t, func() {
+		router := newTestRouter(NewGuard(nil, NewCertAuthenticator(map[string]*Principal{"admin-laptop": {Name: "admin-laptop", Role: Operator}})))
+		withCert := func(cn string) *http.Request {
+			r := httptest.NewRequest(http.MethodPost, "/admin/shutdown", nil)
+			cert := &x509.Certificate{Subject: pkix.Name{CommonName: cn}}
+			r.TLS = &tls.ConnectionState{VerifiedChains: [][]*x509.Certificate{{cert}}}
+			return r
+		}
+
+		Convey("then known cert is allowed, unknown one denied", func() {
+			So(serve(router, withCert("admin-laptop")), ShouldEqual, http.StatusOK)
+			So(serve(router, withCert("stranger")), ShouldEqual, http.StatusUnauthorized)
+		})
+	})
+
+	Convey("given guard without authenticator", t, func() {
+		router := newTestRouter(NewGuard(nil))
+
+		Convey("then everything is denied", func() {
+			So(serve(router, httptest.NewRequest(http.MethodGet, "/admin/jobs", nil)), ShouldEqual, http.StatusUnauthorized)
+			So(serve(router, httptest.NewRequest(http.MethodPost, "/admin/shutdown", nil)), ShouldEqual, http.StatusUnauthorized)
+		})
+	})
+
+	Convey("given open guard", t, func() {
+		router := newTestRouter(NewOpenGuard())
+
+		Convey("then everything is allowed", func() {
+			So(serve(router, httptest.NewRequest(http.MethodPost, "/admin/shutdown", nil)), ShouldEqual, http.StatusOK)
+		})
+	})
+}
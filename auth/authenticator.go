@@ -0,0 +1,240 @@
+package auth
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"github.com/pkg/errors"
+	"io/ioutil"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	KeyIdHeader     = "X-DCoB-Key-Id"
+	TimestampHeader = "X-DCoB-Timestamp"
+	NonceHeader     = "X-DCoB-Nonce"
+	SignatureHeader = "X-DCoB-Signature"
+
+	defaultMaxSignedBodySize = 32 << 20
+)
+
+// tokenAuthenticator accepts static bearer token, tokens are kept hashed
+type tokenAuthenticator struct {
+	tokens map[[sha256.Size]byte]*Principal
+}
+
+func (a *tokenAuthenticator) Authenticate(r *http.Request) (*Principal, error) {
+	h := r.Header.Get("Authorization")
+	token := strings.TrimPrefix(h, "Bearer ")
+	if !strings.HasPrefix(h, "Bearer ") || token == "" {
+		return nil, ErrNoCredentials
+	}
+
+	principal, ok := a.tokens[sha256.Sum256([]byte(token))]
+	if !ok {
+		return nil, errors.Wrap(ErrUnauthenticated, "unknown token")
+	}
+	return principal, nil
+}
+
+// NewTokenAuthenticator accepts `Authorization: Bearer <token>`, never token in url which ends up in access logs
+func NewTokenAuthenticator(tokens map[string]*Principal) Authenticator {
+	a := &tokenAuthenticator{tokens: make(map[[sha256.Size]byte]*Principal, len(tokens))}
+	for token, principal := range tokens {
+		principal.Method = "token"
+		a.tokens[sha256.Sum256([]byte(token))] = principal
+	}
+	return a
+}
+
+type HMACKey struct {
+	Secret    []byte
+	Principal *Principal
+}
+
+// hmacAuthenticator accepts request signed by shared secret of key id, against replay, timestamp outside of skew is
+// rejected, and nonce seen within skew is rejected
+type hmacAuthenticator struct {
+	keys        map[string]*HMACKey
+	maxSkew     time.Duration
+	maxBodySize int64
+	now         func() time.Time
+	nonceLock   sync.Mutex
+	// nonces are key id and nonce of accepted requests, to the time they can be forgotten
+	nonces    map[string]time.Time
+	nextSweep time.Time
+}
+
+type HMACOption func(a *hmacAuthenticator)
+
+// WithMaxSignedBodySize bounds body read to verify signature, larger request is rejected
+func WithMaxSignedBodySize(size int64) HMACOption {
+	return func(a *hmacAuthenticator) {
+		a.maxBodySize = size
+	}
+}
+
+func (a *hmacAuthenticator) Authenticate(r *http.Request) (*Principal, error) {
+	keyId := r.Header.Get(KeyIdHeader)
+	if keyId == "" {
+		return nil, ErrNoCredentials
+	}
+
+	key, ok := a.keys[keyId]
+	if !ok {
+		return nil, errors.Wrapf(ErrUnauthenticated, "unknown key id %s", keyId)
+	}
+
+	ts, err := strconv.ParseInt(r.Header.Get(TimestampHeader), 10, 64)
+	if err != nil {
+		return nil, errors.Wrap(ErrUnauthenticated, "invalid timestamp")
+	}
+
+	if skew := a.now().Sub(time.Unix(ts, 0)); skew > a.maxSkew || skew < -a.maxSkew {
+		return nil, errors.Wrapf(ErrUnauthenticated, "timestamp skewed by %v", skew)
+	}
+
+	nonce := r.Header.Get(NonceHeader)
+	if nonce == "" {
+		return nil, errors.Wrap(ErrUnauthenticated, "missing nonce")
+	}
+
+	signature, err := hex.DecodeString(r.Header.Get(SignatureHeader))
+	if err != nil {
+		return nil, errors.Wrap(ErrUnauthenticated, "invalid signature")
+	}
+
+	expected, err := signature256(r, key.Secret, ts, nonce, a.maxBodySize)
+	if err != nil {
+		return nil, errors.Wrap(ErrUnauthenticated, err.Error())
+	}
+
+	if !hmac.Equal(signature, expected) {
+		return nil, errors.Wrap(ErrUnauthenticated, "signature mismatch")
+	}
+
+	// nonce is only remembered once signature verified, so that forged requests cannot flood the cache
+	if !a.remember(keyId + "\n" + nonce) {
+		return nil, errors.Wrap(ErrUnauthenticated, "nonce replayed")
+	}
+	return key.Principal, nil
+}
+
+// remember returns false if nonce was seen within skew, request with older timestamp is rejected anyway
+func (a *hmacAuthenticator) remember(nonce string) bool {
+	a.nonceLock.Lock()
+	defer a.nonceLock.Unlock()
+
+	now := a.now()
+	if now.After(a.nextSweep) {
+		for n, expiry := range a.nonces {
+			if now.After(expiry) {
+				delete(a.nonces, n)
+			}
+		}
+		a.nextSweep = now.Add(a.maxSkew)
+	}
+
+	if expiry, seen := a.nonces[nonce]; seen && !now.After(expiry) {
+		return false
+	}
+	// timestamp of request is within skew of now, so it stays acceptable for at most twice the skew
+	a.nonces[nonce] = now.Add(2 * a.maxSkew)
+	return true
+}
+
+// signature256 is HMAC-SHA256 of "METHOD\nREQUEST_URI\nTIMESTAMP\nNONCE\nhex(sha256(BODY))", body is kept readable,
+// body larger than max size (if positive) fails
+func signature256(r *http.Request, secret []byte, ts int64, nonce string, maxBodySize int64) ([]byte, error) {
+	body := []byte{}
+	if r.Body != nil {
+		reader := r.Body
+		if maxBodySize > 0 {
+			reader = http.MaxBytesReader(nil, r.Body, maxBodySize)
+		}
+
+		var err error
+		body, err = ioutil.ReadAll(reader)
+		if err != nil {
+			return nil, errors.Wrap(err, "read body")
+		}
+		_ = r.Body.Close()
+		r.Body = ioutil.NopCloser(bytes.NewReader(body))
+	}
+
+	bodySum := sha256.Sum256(body)
+	mac := hmac.New(sha256.New, secret)
+	mac.Write([]byte(r.Method + "\n" + r.URL.RequestURI() + "\n" + strconv.FormatInt(ts, 10) + "\n" + nonce + "\n" +
+		hex.EncodeToString(bodySum[:])))
+	return mac.Sum(nil), nil
+}
+
+// Sign signs request by key for HMAC authenticator with random nonce, it is for clients of admin API
+func Sign(r *http.Request, keyId string, secret []byte, now time.Time) error {
+	raw := make([]byte, 16)
+	if _, err := rand.Read(raw); err != nil {
+		return errors.Wrap(err, "generate nonce")
+	}
+
+	nonce := hex.EncodeToString(raw)
+	signature, err := signature256(r, secret, now.Unix(), nonce, 0)
+	if err != nil {
+		return err
+	}
+
+	r.Header.Set(KeyIdHeader, keyId)
+	r.Header.Set(TimestampHeader, strconv.FormatInt(now.Unix(), 10))
+	r.Header.Set(NonceHeader, nonce)
+	r.Header.Set(SignatureHeader, hex.EncodeToString(signature))
+	return nil
+}
+
+func NewHMACAuthenticator(keys map[string]*HMACKey, maxSkew time.Duration, opts ...HMACOption) Authenticator {
+	for _, key := range keys {
+		key.Principal.Method = "hmac"
+	}
+
+	a := &hmacAuthenticator{
+		keys:        keys,
+		maxSkew:     maxSkew,
+		maxBodySize: defaultMaxSignedBodySize,
+		now:         time.Now,
+		nonces:      make(map[string]time.Time),
+	}
+	for _, opt := range opts {
+		opt(a)
+	}
+	return a
+}
+
+// certAuthenticator accepts client cert verified by TLS handshake, cert is mapped to principal by subject common name
+type certAuthenticator struct {
+	principals map[string]*Principal
+}
+
+func (a *certAuthenticator) Authenticate(r *http.Request) (*Principal, error) {
+	if r.TLS == nil || len(r.TLS.VerifiedChains) == 0 || len(r.TLS.VerifiedChains[0]) == 0 {
+		return nil, ErrNoCredentials
+	}
+
+	cn := r.TLS.VerifiedChains[0][0].Subject.CommonName
+	principal, ok := a.principals[cn]
+	if !ok {
+		return nil, errors.Wrapf(ErrUnauthenticated, "unknown cert %s", cn)
+	}
+	return principal, nil
+}
+
+// NewCertAuthenticator maps verified client cert by its common name, server should verify certs against client CA
+func NewCertAuthenticator(principals map[string]*Principal) Authenticator {
+	for _, principal := range principals {
+		principal.Method = "cert"
+	}
+	return &certAuthenticator{principals: principals}
+}
@@ -21,6 +21,15 @@ func GetLogger() *zap.SugaredLogger {
 	return sugarLogger
 }
 
+// InitLogger reconfigures the logger in place, so that loggers already got by GetLogger follow it as well,
+// it should be called once at startup before logging concurrently
+func InitLogger(opts ...ApplyLoggerOption) {
+	logger := GetLogger()
+	initLogger(opts...)
+	*logger = *sugarLogger
+	sugarLogger = logger
+}
+
 type ApplyLoggerOption func(l *loggerOption)
 
 func WithLoggerFile(fileName string) ApplyLoggerOption {
@@ -0,0 +1,106 @@
+package comm
+
+import (
+	"context"
+	"github.com/pkg/errors"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracehttp"
+	"go.opentelemetry.io/otel/exporters/stdout/stdouttrace"
+	"go.opentelemetry.io/otel/sdk/resource"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	semconv "go.opentelemetry.io/otel/semconv/v1.10.0"
+	"net/url"
+	"os"
+)
+
+const serviceName = "dcob-scheduler"
+
+type ApplyTracerOption func(t *tracerOption)
+
+// WithOTLPEndpoint exports spans over OTLP/HTTP to collector, e.g. http://localhost:4318
+func WithOTLPEndpoint(endpoint string) ApplyTracerOption {
+	return func(t *tracerOption) {
+		t.otlpEndpoint = endpoint
+	}
+}
+
+// WithTraceFile appends spans to local file as JSON, for offline use
+func WithTraceFile(fileName string) ApplyTracerOption {
+	return func(t *tracerOption) {
+		t.traceFile = fileName
+	}
+}
+
+type tracerOption struct {
+	otlpEndpoint string
+	traceFile    string
+}
+
+// InitTracer installs global tracer provider exporting to configured destinations, spans are dropped if none configured,
+// shutdown flushes pending spans and should be called before exit
+func InitTracer(opts ...ApplyTracerOption) (shutdown func(context.Context) error, err error) {
+	opt := &tracerOption{}
+	for _, o := range opts {
+		o(opt)
+	}
+
+	providerOpts := []sdktrace.TracerProviderOption{
+		sdktrace.WithResource(resource.NewWithAttributes(semconv.SchemaURL, semconv.ServiceNameKey.String(serviceName))),
+	}
+
+	if opt.otlpEndpoint != "" {
+		exporter, err := newOTLPExporter(opt.otlpEndpoint)
+		if err != nil {
+			return nil, err
+		}
+		providerOpts = append(providerOpts, sdktrace.WithBatcher(exporter))
+	}
+
+	var file *os.File
+	if opt.traceFile != "" {
+		file, err = os.OpenFile(opt.traceFile, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0644)
+		if err != nil {
+			return nil, errors.Wrap(err, "open trace file")
+		}
+
+		exporter, err := stdouttrace.New(stdouttrace.WithWriter(file))
+		if err != nil {
+			_ = file.Close()
+			return nil, errors.Wrap(err, "create file exporter")
+		}
+		providerOpts = append(providerOpts, sdktrace.WithBatcher(exporter))
+	}
+
+	provider := sdktrace.NewTracerProvider(providerOpts...)
+	otel.SetTracerProvider(provider)
+
+	return func(ctx context.Context) error {
+		err := provider.Shutdown(ctx)
+		if file != nil {
+			_ = file.Close()
+		}
+		return err
+	}, nil
+}
+
+func newOTLPExporter(endpoint string) (sdktrace.SpanExporter, error) {
+	u, err := url.Parse(endpoint)
+	if err != nil || u.Host == "" {
+		return nil, errors.Errorf("invalid otlp endpoint: %s", endpoint)
+	}
+
+	opts := []otlptracehttp.Option{otlptracehttp.WithEndpoint(u.Host)}
+	if u.Scheme == "http" {
+		opts = append(opts, otlptracehttp.WithInsecure())
+	}
+	if u.Path != "" && u.Path != "/" {
+		opts = append(opts, otlptracehttp.WithURLPath(u.Path))
+	}
+
+	// exporter connects lazily, so unreachable collector never blocks startup
+	exporter, err := otlptracehttp.New(context.Background(), opts...)
+	if err != nil {
+		return nil, errors.Wrap(err, "create otlp exporter")
+	}
+	return exporter, nil
+}
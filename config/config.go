@@ -0,0 +1,488 @@
+package config
+
+import (
+	"flag"
+	"fmt"
+	"github.com/TD-Hackathon-2022/DCoB-Scheduler/api"
+	"github.com/TD-Hackathon-2022/DCoB-Scheduler/auth"
+	"github.com/TD-Hackathon-2022/DCoB-Scheduler/module"
+	"github.com/pkg/errors"
+	"gopkg.in/yaml.v2"
+	"io/ioutil"
+	"net/url"
+	"os"
+	"path"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// configEnv points to config file if -config flag not given
+const configEnv = "DCOB_CONFIG"
+
+var ErrInvalidConfig = errors.New("invalid config")
+
+var logLevels = []string{"debug", "info", "warn", "error", "panic", "fatal"}
+
+// Config of scheduler, loaded from defaults, then YAML file, environment variables and flags, latter overrides former
+type Config struct {
+	Addr      string          `yaml:"addr"`
+	UIDir     string          `yaml:"uiDir"`
+	Log       LogConfig       `yaml:"log"`
+	Queue     QueueConfig     `yaml:"queue"`
+	Schedule  ScheduleConfig  `yaml:"schedule"`
+	Retry     RetryConfig     `yaml:"retry"`
+	Store     StoreConfig     `yaml:"store"`
+	Funcs     FuncsConfig     `yaml:"funcs"`
+	Events    EventsConfig    `yaml:"events"`
+	Tracing   TracingConfig   `yaml:"tracing"`
+	Auth      AuthConfig      `yaml:"auth"`
+	TLS       TLSConfig       `yaml:"tls"`
+	Admission AdmissionConfig `yaml:"admission"`
+	Verify    VerifyConfig    `yaml:"verification"`
+}
+
+type LogConfig struct {
+	Level string `yaml:"level"`
+	// File receives logs besides stdout, truncated at startup
+	File string `yaml:"file"`
+}
+
+type QueueConfig struct {
+	TaskCapacity int `yaml:"taskCapacity"`
+	JobCapacity  int `yaml:"jobCapacity"`
+}
+
+type ScheduleConfig struct {
+	Policy           string        `yaml:"policy"`
+	HeartbeatTimeout time.Duration `yaml:"heartbeatTimeout"`
+	TaskTimeout      time.Duration `yaml:"taskTimeout"`
+	CloseGracePeriod time.Duration `yaml:"closeGracePeriod"`
+}
+
+// RetryConfig is the default retry policy of tasks, RetryOn lists task status worth retry: error or interrupted
+type RetryConfig struct {
+	MaxAttempts    int           `yaml:"maxAttempts"`
+	InitialBackoff time.Duration `yaml:"initialBackoff"`
+	MaxBackoff     time.Duration `yaml:"maxBackoff"`
+	Multiplier     float64       `yaml:"multiplier"`
+	RetryOn        []string      `yaml:"retryOn"`
+}
+
+type StoreConfig struct {
+	Path          string        `yaml:"path"`
+	FlushInterval time.Duration `yaml:"flushInterval"`
+	// CompactSize of log in bytes, over which the log is rewritten with the latest records only
+	CompactSize int64 `yaml:"compactSize"`
+}
+
+type FuncsConfig struct {
+	RegistryPath string `yaml:"registryPath"`
+	BuiltinDir   string `yaml:"builtinDir"`
+	MaxSize      int64  `yaml:"maxSize"`
+}
+
+type EventsConfig struct {
+	KeepAliveInterval time.Duration `yaml:"keepAliveInterval"`
+}
+
+type TracingConfig struct {
+	OTLPEndpoint string `yaml:"otlpEndpoint"`
+	File         string `yaml:"file"`
+}
+
+// AuthConfig guards admin API by credentials given in config file, admin API denies everything if none given,
+// unless auth is disabled
+type AuthConfig struct {
+	// Disabled serves admin API to anyone, admin API without credentials denies everything otherwise
+	Disabled bool              `yaml:"disabled"`
+	Tokens   []TokenCredential `yaml:"tokens"`
+	HMACKeys []HMACCredential  `yaml:"hmacKeys"`
+	Certs    []CertCredential  `yaml:"certs"`
+	// MaxClockSkew bounds difference between timestamp of HMAC signed request and now
+	MaxClockSkew time.Duration `yaml:"maxClockSkew"`
+	AuditLog     string        `yaml:"auditLog"`
+}
+
+type TokenCredential struct {
+	Name  string `yaml:"name"`
+	Token string `yaml:"token"`
+	Role  string `yaml:"role"`
+}
+
+type HMACCredential struct {
+	KeyId  string `yaml:"keyId"`
+	Secret string `yaml:"secret"`
+	Role   string `yaml:"role"`
+}
+
+// CertCredential maps client cert of common name to role, cert should be issued by TLS client CA
+type CertCredential struct {
+	CommonName string `yaml:"commonName"`
+	Role       string `yaml:"role"`
+}
+
+// TLSConfig serves HTTPS if cert and key given, client cert is verified against client CA if given
+type TLSConfig struct {
+	CertFile     string `yaml:"certFile"`
+	KeyFile      string `yaml:"keyFile"`
+	ClientCAFile string `yaml:"clientCAFile"`
+}
+
+// AdmissionConfig controls which clients connect to /connect and register as worker
+type AdmissionConfig struct {
+	// RequireToken admits only workers registering with token issued by admin
+	RequireToken bool `yaml:"requireToken"`
+	// AllowedOrigins of browser workers, e.g. https://*.example.com, * allows any, only same origin if empty
+	AllowedOrigins []string `yaml:"allowedOrigins"`
+	// MaxConnectionsPerIP limits concurrent connections from one remote IP, 0 means unlimited
+	MaxConnectionsPerIP int `yaml:"maxConnectionsPerIP"`
+	// StatePath keeps issued worker tokens and banned workers
+	StatePath string `yaml:"statePath"`
+}
+
+// VerifyConfig judges workers by their verified results, results are verified as jobs ask for
+type VerifyConfig struct {
+	// MinReputation under which worker gets no task, 0 trusts every worker
+	MinReputation float64 `yaml:"minReputation"`
+	// ReputationHalfLife recovers half of reputation worker lost every half life, 0 means never
+	ReputationHalfLife time.Duration `yaml:"reputationHalfLife"`
+}
+
+// minSecretLength rejects guessable tokens and secrets
+const minSecretLength = 16
+
+func Default() *Config {
+	return &Config{
+		Addr:  ":8080",
+		UIDir: "./ui",
+		Log:   LogConfig{Level: "debug"},
+		Queue: QueueConfig{TaskCapacity: 128, JobCapacity: 16},
+		Schedule: ScheduleConfig{
+			Policy:           module.FairSharePolicy,
+			HeartbeatTimeout: 30 * time.Second,
+			TaskTimeout:      10 * time.Minute,
+			CloseGracePeriod: 30 * time.Second,
+		},
+		Retry: RetryConfig{
+			MaxAttempts:    3,
+			InitialBackoff: time.Second,
+			MaxBackoff:     30 * time.Second,
+			Multiplier:     2,
+			RetryOn:        []string{"error", "interrupted"},
+		},
+		Store:  StoreConfig{Path: "./data/jobs.log", FlushInterval: 5 * time.Second, CompactSize: 64 << 20},
+		Funcs:  FuncsConfig{RegistryPath: "./data/funcs", BuiltinDir: "./custom_func", MaxSize: 32 << 20},
+		Events: EventsConfig{KeepAliveInterval: 15 * time.Second},
+		Auth:   AuthConfig{MaxClockSkew: 5 * time.Minute, AuditLog: "./data/audit.log"},
+		Admission: AdmissionConfig{
+			MaxConnectionsPerIP: 16,
+			StatePath:           "./data/admission.json",
+		},
+		Verify: VerifyConfig{MinReputation: module.DefaultMinReputation, ReputationHalfLife: module.DefaultReputationHalfLife},
+	}
+}
+
+// setting binds a config field to its flag and environment variable
+type setting struct {
+	flag  string
+	env   string
+	usage string
+	value interface{}
+}
+
+func (c *Config) settings() []setting {
+	return []setting{
+		{"addr", "DCOB_ADDR", "address to listen", &c.Addr},
+		{"ui-dir", "DCOB_UI_DIR", "directory of web ui served under /ui", &c.UIDir},
+		{"log.level", "DCOB_LOG_LEVEL", "log level: " + strings.Join(logLevels, ", "), &c.Log.Level},
+		{"log.file", "DCOB_LOG_FILE", "file receives logs besides stdout", &c.Log.File},
+		{"queue.task-capacity", "DCOB_TASK_QUEUE_CAPACITY", "capacity of task queue", &c.Queue.TaskCapacity},
+		{"queue.job-capacity", "DCOB_JOB_QUEUE_CAPACITY", "capacity of job queue", &c.Queue.JobCapacity},
+		{"schedule.policy", "DCOB_SCHEDULE_POLICY", "schedule policy: fifo, priority or fair-share", &c.Schedule.Policy},
+		{"schedule.heartbeat-timeout", "DCOB_HEARTBEAT_TIMEOUT", "worker without ping or msg within timeout is dead, 0 means never", &c.Schedule.HeartbeatTimeout},
+		{"schedule.task-timeout", "DCOB_TASK_TIMEOUT", "task without status within timeout fails, 0 means never", &c.Schedule.TaskTimeout},
+		{"schedule.close-grace-period", "DCOB_CLOSE_GRACE_PERIOD", "time closing worker can take to finish its tasks", &c.Schedule.CloseGracePeriod},
+		{"retry.max-attempts", "DCOB_RETRY_MAX_ATTEMPTS", "attempts of task including the first one", &c.Retry.MaxAttempts},
+		{"retry.initial-backoff", "DCOB_RETRY_INITIAL_BACKOFF", "delay before first retry", &c.Retry.InitialBackoff},
+		{"retry.max-backoff", "DCOB_RETRY_MAX_BACKOFF", "upper bound of retry delay, 0 means unbounded", &c.Retry.MaxBackoff},
+		{"retry.multiplier", "DCOB_RETRY_MULTIPLIER", "growth of retry delay per attempt", &c.Retry.Multiplier},
+		{"retry.retry-on", "DCOB_RETRY_ON", "comma separated task status to retry: error, interrupted", &c.Retry.RetryOn},
+		{"store.path", "DCOB_STORE_PATH", "job store file", &c.Store.Path},
+		{"store.flush-interval", "DCOB_STORE_FLUSH_INTERVAL", "interval to flush job store", &c.Store.FlushInterval},
+		{"store.compact-size", "DCOB_STORE_COMPACT_SIZE", "bytes of job store over which it is compacted", &c.Store.CompactSize},
+		{"funcs.registry-path", "DCOB_FUNC_REGISTRY_PATH", "directory of uploaded WASM funcs", &c.Funcs.RegistryPath},
+		{"funcs.builtin-dir", "DCOB_BUILTIN_FUNC_DIR", "directory of WASM funcs registered at startup", &c.Funcs.BuiltinDir},
+		{"funcs.max-size", "DCOB_MAX_FUNC_SIZE", "max bytes of uploaded WASM module", &c.Funcs.MaxSize},
+		{"events.keep-alive-interval", "DCOB_EVENT_KEEP_ALIVE_INTERVAL", "keep-alive interval of job event stream", &c.Events.KeepAliveInterval},
+		{"tracing.otlp-endpoint", "DCOB_OTLP_ENDPOINT", "OTLP/HTTP collector to export traces, e.g. http://localhost:4318", &c.Tracing.OTLPEndpoint},
+		{"tracing.file", "DCOB_TRACE_FILE", "file to append traces as JSON", &c.Tracing.File},
+		{"auth.disabled", "DCOB_AUTH_DISABLED", "serve admin API without authentication", &c.Auth.Disabled},
+		{"auth.max-clock-skew", "DCOB_AUTH_MAX_CLOCK_SKEW", "max clock skew of HMAC signed request", &c.Auth.MaxClockSkew},
+		{"auth.audit-log", "DCOB_AUTH_AUDIT_LOG", "file to append denied admin requests", &c.Auth.AuditLog},
+		{"tls.cert-file", "DCOB_TLS_CERT_FILE", "server cert to serve HTTPS", &c.TLS.CertFile},
+		{"tls.key-file", "DCOB_TLS_KEY_FILE", "server key to serve HTTPS", &c.TLS.KeyFile},
+		{"tls.client-ca-file", "DCOB_TLS_CLIENT_CA_FILE", "CA to verify client certs", &c.TLS.ClientCAFile},
+		{"admission.require-token", "DCOB_ADMISSION_REQUIRE_TOKEN", "admit only workers registering with token issued by admin", &c.Admission.RequireToken},
+		{"admission.allowed-origins", "DCOB_ADMISSION_ALLOWED_ORIGINS", "comma separated origin patterns of browser workers, e.g. https://*.example.com", &c.Admission.AllowedOrigins},
+		{"admission.max-connections-per-ip", "DCOB_ADMISSION_MAX_CONNECTIONS_PER_IP", "max concurrent worker connections from one IP, 0 means unlimited", &c.Admission.MaxConnectionsPerIP},
+		{"admission.state-path", "DCOB_ADMISSION_STATE_PATH", "file keeps issued worker tokens and banned workers", &c.Admission.StatePath},
+		{"verification.min-reputation", "DCOB_MIN_REPUTATION", "reputation in [0, 1] under which worker gets no task, 0 trusts every worker", &c.Verify.MinReputation},
+		{"verification.reputation-half-life", "DCOB_REPUTATION_HALF_LIFE", "time worker recovers half of reputation lost, 0 means never", &c.Verify.ReputationHalfLife},
+	}
+}
+
+func (s setting) set(raw string) (err error) {
+	switch v := s.value.(type) {
+	case *string:
+		*v = raw
+	case *bool:
+		*v, err = strconv.ParseBool(raw)
+	case *int:
+		*v, err = strconv.Atoi(raw)
+	case *int64:
+		*v, err = strconv.ParseInt(raw, 10, 64)
+	case *float64:
+		*v, err = strconv.ParseFloat(raw, 64)
+	case *time.Duration:
+		*v, err = time.ParseDuration(raw)
+	case *[]string:
+		*v = make([]string, 0)
+		for _, item := range strings.Split(raw, ",") {
+			if item = strings.TrimSpace(item); item != "" {
+				*v = append(*v, item)
+			}
+		}
+	default:
+		err = errors.Errorf("unsupported type %T", v)
+	}
+	return err
+}
+
+func (s setting) String() string {
+	switch v := s.value.(type) {
+	case *string:
+		return *v
+	case *bool:
+		return strconv.FormatBool(*v)
+	case *int:
+		return strconv.Itoa(*v)
+	case *int64:
+		return strconv.FormatInt(*v, 10)
+	case *float64:
+		return strconv.FormatFloat(*v, 'g', -1, 64)
+	case *time.Duration:
+		return v.String()
+	case *[]string:
+		return strings.Join(*v, ",")
+	}
+	return ""
+}
+
+// rawFlag keeps flag as given, it is applied after file and environment variables so that it takes precedence
+type rawFlag struct {
+	value   string
+	boolean bool
+}
+
+// IsBoolFlag allows bool flag given without value, e.g. -admission.require-token
+func (f *rawFlag) IsBoolFlag() bool {
+	return f.boolean
+}
+
+func (f *rawFlag) String() string {
+	return f.value
+}
+
+func (f *rawFlag) Set(s string) error {
+	f.value = s
+	return nil
+}
+
+// Load builds config from defaults, file given by -config flag or DCOB_CONFIG, environment variables and flags,
+// and validates it
+func Load(args []string) (*Config, error) {
+	c := Default()
+	settings := c.settings()
+
+	fs := flag.NewFlagSet("scheduler", flag.ContinueOnError)
+	path := fs.String("config", os.Getenv(configEnv), "config file in YAML, env "+configEnv)
+	for _, s := range settings {
+		_, boolean := s.value.(*bool)
+		fs.Var(&rawFlag{value: s.String(), boolean: boolean}, s.flag, s.usage+", env "+s.env)
+	}
+	if err := fs.Parse(args); err != nil {
+		return nil, err
+	}
+
+	if *path != "" {
+		if err := c.loadFile(*path); err != nil {
+			return nil, err
+		}
+	}
+
+	for _, s := range settings {
+		if raw, ok := os.LookupEnv(s.env); ok {
+			if err := s.set(raw); err != nil {
+				return nil, errors.Wrapf(ErrInvalidConfig, "env %s: %v", s.env, err)
+			}
+		}
+	}
+
+	var err error
+	fs.Visit(func(f *flag.Flag) {
+		for _, s := range settings {
+			if s.flag == f.Name && err == nil {
+				if e := s.set(f.Value.String()); e != nil {
+					err = errors.Wrapf(ErrInvalidConfig, "flag -%s: %v", f.Name, e)
+				}
+			}
+		}
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return c, c.Validate()
+}
+
+func (c *Config) loadFile(path string) error {
+	b, err := ioutil.ReadFile(path)
+	if err != nil {
+		return errors.Wrap(err, "read config file")
+	}
+
+	// unknown keys are likely typos, reject rather than silently ignore them
+	if err := yaml.UnmarshalStrict(b, c); err != nil {
+		return errors.Wrapf(ErrInvalidConfig, "%s: %v", path, err)
+	}
+	return nil
+}
+
+// Validate reports all invalid settings at once
+func (c *Config) Validate() error {
+	problems := make([]string, 0)
+	check := func(ok bool, format string, args ...interface{}) {
+		if !ok {
+			problems = append(problems, fmt.Sprintf(format, args...))
+		}
+	}
+
+	check(c.Addr != "", "addr is empty")
+	check(containsString(logLevels, c.Log.Level), "log.level %q is not one of %s", c.Log.Level, strings.Join(logLevels, ", "))
+	check(c.Queue.TaskCapacity > 0, "queue.taskCapacity %d should be positive", c.Queue.TaskCapacity)
+	check(c.Queue.JobCapacity > 0, "queue.jobCapacity %d should be positive", c.Queue.JobCapacity)
+	_, err := module.NewSchedulePolicy(c.Schedule.Policy)
+	check(err == nil, "schedule.policy %q is unknown", c.Schedule.Policy)
+	check(c.Schedule.HeartbeatTimeout >= 0, "schedule.heartbeatTimeout should not be negative")
+	check(c.Schedule.TaskTimeout >= 0, "schedule.taskTimeout should not be negative")
+	check(c.Schedule.CloseGracePeriod >= 0, "schedule.closeGracePeriod should not be negative")
+	check(c.Retry.MaxAttempts >= 1, "retry.maxAttempts %d should be at least 1", c.Retry.MaxAttempts)
+	check(c.Retry.InitialBackoff >= 0, "retry.initialBackoff should not be negative")
+	check(c.Retry.MaxBackoff == 0 || c.Retry.MaxBackoff >= c.Retry.InitialBackoff, "retry.maxBackoff should not be less than retry.initialBackoff")
+	check(c.Retry.Multiplier >= 1, "retry.multiplier %v should be at least 1", c.Retry.Multiplier)
+	_, err = retryStatus(c.Retry.RetryOn)
+	check(err == nil, "retry.retryOn: %v", err)
+	check(c.Store.Path != "", "store.path is empty")
+	check(c.Store.FlushInterval > 0, "store.flushInterval should be positive")
+	check(c.Store.CompactSize > 0, "store.compactSize %d should be positive", c.Store.CompactSize)
+	check(c.Funcs.RegistryPath != "", "funcs.registryPath is empty")
+	check(c.Funcs.MaxSize > 0, "funcs.maxSize %d should be positive", c.Funcs.MaxSize)
+	check(c.Events.KeepAliveInterval > 0, "events.keepAliveInterval should be positive")
+	if c.Tracing.OTLPEndpoint != "" {
+		u, err := url.Parse(c.Tracing.OTLPEndpoint)
+		check(err == nil && u.Host != "", "tracing.otlpEndpoint %q should be an url like http://localhost:4318", c.Tracing.OTLPEndpoint)
+	}
+
+	problems = append(problems, c.Auth.validate()...)
+	check((c.TLS.CertFile == "") == (c.TLS.KeyFile == ""), "tls.certFile and tls.keyFile should be given together")
+	check(c.TLS.ClientCAFile == "" || c.TLS.CertFile != "", "tls.clientCAFile requires tls.certFile")
+	check(len(c.Auth.Certs) == 0 || c.TLS.ClientCAFile != "", "auth.certs requires tls.clientCAFile")
+	check(c.Admission.MaxConnectionsPerIP >= 0, "admission.maxConnectionsPerIP should not be negative")
+	check(c.Admission.StatePath != "", "admission.statePath is empty")
+	for _, pattern := range c.Admission.AllowedOrigins {
+		_, err := path.Match(pattern, "")
+		check(err == nil, "admission.allowedOrigins: pattern %q is malformed", pattern)
+	}
+	check(c.Verify.MinReputation >= 0 && c.Verify.MinReputation <= 1, "verification.minReputation %v should be in [0, 1]",
+		c.Verify.MinReputation)
+	check(c.Verify.ReputationHalfLife >= 0, "verification.reputationHalfLife %v should not be negative", c.Verify.ReputationHalfLife)
+
+	if len(problems) > 0 {
+		return errors.Wrap(ErrInvalidConfig, strings.Join(problems, "; "))
+	}
+	return nil
+}
+
+func (c *AuthConfig) validate() []string {
+	problems := make([]string, 0)
+	seen := make(map[string]bool)
+	check := func(kind, name, role string) {
+		if name == "" || seen[kind+name] {
+			problems = append(problems, fmt.Sprintf("auth.%s: name %q is empty or duplicated", kind, name))
+		}
+		seen[kind+name] = true
+
+		if _, err := auth.ParseRole(role); err != nil {
+			problems = append(problems, fmt.Sprintf("auth.%s: %s: %v", kind, name, err))
+		}
+	}
+	checkSecret := func(kind, name, secret string) {
+		if len(secret) < minSecretLength {
+			problems = append(problems, fmt.Sprintf("auth.%s: %s: secret should be at least %d chars", kind, name, minSecretLength))
+		}
+	}
+
+	for _, t := range c.Tokens {
+		check("tokens", t.Name, t.Role)
+		checkSecret("tokens", t.Name, t.Token)
+	}
+	for _, k := range c.HMACKeys {
+		check("hmacKeys", k.KeyId, k.Role)
+		checkSecret("hmacKeys", k.KeyId, k.Secret)
+	}
+	for _, cert := range c.Certs {
+		check("certs", cert.CommonName, cert.Role)
+	}
+
+	if c.MaxClockSkew <= 0 {
+		problems = append(problems, "auth.maxClockSkew should be positive")
+	}
+	if c.Disabled && len(c.Tokens)+len(c.HMACKeys)+len(c.Certs) > 0 {
+		problems = append(problems, "auth.disabled conflicts with configured credentials")
+	}
+	return problems
+}
+
+// RetryPolicy is the default retry policy of tasks, config should have been validated
+func (c *RetryConfig) RetryPolicy() *module.RetryPolicy {
+	retryOn, _ := retryStatus(c.RetryOn)
+	p := module.NewRetryPolicy(c.MaxAttempts, c.InitialBackoff, c.MaxBackoff, retryOn...)
+	p.Multiplier = c.Multiplier
+	return p
+}
+
+// retryStatus parses task status case-insensitively, only failed status is worth retry
+func retryStatus(names []string) ([]api.TaskStatus, error) {
+	statuses := make([]api.TaskStatus, 0, len(names))
+	for _, name := range names {
+		switch strings.ToLower(name) {
+		case "error":
+			statuses = append(statuses, api.TaskStatus_Error)
+		case "interrupted":
+			statuses = append(statuses, api.TaskStatus_Interrupted)
+		default:
+			return nil, errors.Errorf("task status %q is not one of error, interrupted", name)
+		}
+	}
+	return statuses, nil
+}
+
+func containsString(values []string, value string) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,113 @@
+package config
+
+import (
+	"github.com/TD-Hackathon-2022/DCoB-Scheduler/api"
+	"github.com/pkg/errors"
+	. "github.com/smartystreets/goconvey/convey"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestLoad_ShouldOverrideFileByEnvAndEnvByFlag(t *testing.T) {
+	Convey("given config file, env and flags", t, func() {
+		dir, _ := ioutil.TempDir("", "config")
+		defer os.RemoveAll(dir)
+		path := filepath.Join(dir, "scheduler.yaml")
+		_ = ioutil.WriteFile(path, []byte(`
+addr: ":9090"
+log:
+  level: info
+queue:
+  taskCapacity: 256
+schedule:
+  taskTimeout: 1m
+retry:
+  retryOn: [error]
+`), 0644)
+
+		_ = os.Setenv("DCOB_TASK_QUEUE_CAPACITY", "512")
+		_ = os.Setenv("DCOB_LOG_LEVEL", "warn")
+		defer os.Unsetenv("DCOB_TASK_QUEUE_CAPACITY")
+		defer os.Unsetenv("DCOB_LOG_LEVEL")
+
+		Convey("when load", func() {
+			conf, err := Load([]string{"-config", path, "-log.level", "error", "-retry.max-attempts", "5", "-admission.require-token"})
+
+			Convey("then latter source wins, unset ones keep defaults", func() {
+				So(err, ShouldBeNil)
+				So(conf.Addr, ShouldEqual, ":9090")
+				So(conf.Queue.TaskCapacity, ShouldEqual, 512)
+				So(conf.Log.Level, ShouldEqual, "error")
+				So(conf.Schedule.TaskTimeout, ShouldEqual, time.Minute)
+				So(conf.Queue.JobCapacity, ShouldEqual, 16)
+				So(conf.Admission.RequireToken, ShouldBeTrue)
+
+				policy := conf.Retry.RetryPolicy()
+				So(policy.MaxAttempts, ShouldEqual, 5)
+				So(policy.RetryOn, ShouldResemble, []api.TaskStatus{api.TaskStatus_Error})
+			})
+		})
+	})
+}
+
+func TestLoad_ShouldRejectInvalidConfig(t *testing.T) {
+	Convey("given config file with unknown key", t, func() {
+		dir, _ := ioutil.TempDir("", "config")
+		defer os.RemoveAll(dir)
+		path := filepath.Join(dir, "scheduler.yaml")
+		_ = ioutil.WriteFile(path, []byte("queue:\n  taskCapcity: 1\n"), 0644)
+
+		Convey("then loading fails", func() {
+			_, err := Load([]string{"-config", path})
+			So(errors.Cause(err), ShouldEqual, ErrInvalidConfig)
+		})
+	})
+
+	Convey("given invalid settings", t, func() {
+		_, err := Load([]string{"-queue.task-capacity", "0", "-schedule.policy", "lifo", "-retry.retry-on", "finished",
+			"-admission.allowed-origins", "https://[a", "-verification.min-reputation", "1.5"})
+
+		Convey("then all problems are reported", func() {
+			So(errors.Cause(err), ShouldEqual, ErrInvalidConfig)
+			So(err.Error(), ShouldContainSubstring, "queue.taskCapacity")
+			So(err.Error(), ShouldContainSubstring, "schedule.policy")
+			So(err.Error(), ShouldContainSubstring, "retry.retryOn")
+			So(err.Error(), ShouldContainSubstring, "admission.allowedOrigins")
+			So(err.Error(), ShouldContainSubstring, "verification.minReputation")
+		})
+	})
+
+	Convey("given weak or incomplete admin credentials", t, func() {
+		dir, _ := ioutil.TempDir("", "config")
+		defer os.RemoveAll(dir)
+		path := filepath.Join(dir, "scheduler.yaml")
+		_ = ioutil.WriteFile(path, []byte(`
+auth:
+  tokens:
+    - {name: ci, token: short, role: submitter}
+    - {name: ops, token: long-enough-token-0123, role: root}
+  certs:
+    - {commonName: admin, role: operator}
+`), 0644)
+
+		Convey("then all problems are reported", func() {
+			_, err := Load([]string{"-config", path, "-auth.disabled"})
+			So(errors.Cause(err), ShouldEqual, ErrInvalidConfig)
+			So(err.Error(), ShouldContainSubstring, "auth.disabled conflicts with configured credentials")
+			So(err.Error(), ShouldContainSubstring, "ci: secret should be at least 16 chars")
+			So(err.Error(), ShouldContainSubstring, `role "root"`)
+			So(err.Error(), ShouldContainSubstring, "auth.certs requires tls.clientCAFile")
+		})
+	})
+
+	Convey("given malformed flag value", t, func() {
+		_, err := Load([]string{"-schedule.task-timeout", "10"})
+
+		Convey("then loading fails", func() {
+			So(errors.Cause(err), ShouldEqual, ErrInvalidConfig)
+		})
+	})
+}
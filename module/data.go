@@ -0,0 +1,131 @@
+package module
+
+import (
+	"encoding/json"
+	"fmt"
+	"github.com/TD-Hackathon-2022/DCoB-Scheduler/api"
+	"github.com/pkg/errors"
+	"github.com/ugorji/go/codec"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/types/known/anypb"
+	"reflect"
+)
+
+var ErrUndecodable = errors.New("undecodable data")
+
+var msgpackHandle = func() *codec.MsgpackHandle {
+	h := &codec.MsgpackHandle{}
+	// decode into what encoding/json understands, so decoded values can be served as JSON
+	h.MapType = reflect.TypeOf(map[string]interface{}(nil))
+	h.RawToString = true
+	h.SignedInteger = true
+	return h
+}()
+
+// Data is input or output of task tagged with its content type, zero value is empty text
+type Data struct {
+	ContentType api.ContentType
+	Bytes       []byte
+}
+
+func Text(s string) Data {
+	return Data{ContentType: api.ContentType_Text, Bytes: []byte(s)}
+}
+
+func Raw(b []byte) Data {
+	return Data{ContentType: api.ContentType_Raw, Bytes: b}
+}
+
+func JSON(v interface{}) (Data, error) {
+	b, err := json.Marshal(v)
+	if err != nil {
+		return Data{}, errors.Wrap(err, "marshal json data")
+	}
+	return Data{ContentType: api.ContentType_Json, Bytes: b}, nil
+}
+
+func Msgpack(v interface{}) (Data, error) {
+	b := make([]byte, 0)
+	if err := codec.NewEncoderBytes(&b, msgpackHandle).Encode(v); err != nil {
+		return Data{}, errors.Wrap(err, "marshal msgpack data")
+	}
+	return Data{ContentType: api.ContentType_Msgpack, Bytes: b}, nil
+}
+
+// AnyOf wraps protobuf message in google.protobuf.Any, so worker knows its type by type url
+func AnyOf(m proto.Message) (Data, error) {
+	a, err := anypb.New(m)
+	if err != nil {
+		return Data{}, errors.Wrap(err, "wrap any data")
+	}
+
+	b, err := proto.Marshal(a)
+	if err != nil {
+		return Data{}, errors.Wrap(err, "marshal any data")
+	}
+	return Data{ContentType: api.ContentType_Any, Bytes: b}, nil
+}
+
+// Textual data can be sent to worker speaks protocol older than 3 as string
+func (d Data) Textual() bool {
+	return d.ContentType == api.ContentType_Text || d.ContentType == api.ContentType_Json
+}
+
+// Decode unmarshals JSON or msgpack data into v, Any data into v of proto.Message,
+// text or raw data into v of *string or *[]byte
+func (d Data) Decode(v interface{}) error {
+	var err error
+	switch d.ContentType {
+	case api.ContentType_Text, api.ContentType_Raw:
+		switch v := v.(type) {
+		case *string:
+			*v = string(d.Bytes)
+		case *[]byte:
+			*v = d.Bytes
+		default:
+			err = errors.Errorf("%s into %T", d.ContentType, v)
+		}
+	case api.ContentType_Json:
+		err = json.Unmarshal(d.Bytes, v)
+	case api.ContentType_Msgpack:
+		err = codec.NewDecoderBytes(d.Bytes, msgpackHandle).Decode(v)
+	case api.ContentType_Any:
+		m, ok := v.(proto.Message)
+		if !ok {
+			err = errors.Errorf("any into %T", v)
+			break
+		}
+
+		a := &anypb.Any{}
+		if err = proto.Unmarshal(d.Bytes, a); err == nil {
+			err = a.UnmarshalTo(m)
+		}
+	default:
+		err = errors.Errorf("unknown content type %d", d.ContentType)
+	}
+
+	if err != nil {
+		return errors.Wrapf(ErrUndecodable, "%v", err)
+	}
+	return nil
+}
+
+// String is for logging, binary data is summarized
+func (d Data) String() string {
+	if d.Textual() {
+		return string(d.Bytes)
+	}
+	return fmt.Sprintf("<%s %d bytes>", d.ContentType, len(d.Bytes))
+}
+
+func (d Data) toPayload() *api.Payload {
+	return &api.Payload{ContentType: d.ContentType, Data: d.Bytes}
+}
+
+// dataOf converts payload received from worker, worker speaks protocol older than 3 only reports legacy string
+func dataOf(p *api.Payload, legacy string) Data {
+	if p == nil {
+		return Text(legacy)
+	}
+	return Data{ContentType: p.GetContentType(), Bytes: p.GetData()}
+}
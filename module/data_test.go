@@ -0,0 +1,56 @@
+package module
+
+import (
+	"github.com/pkg/errors"
+	. "github.com/smartystreets/goconvey/convey"
+	"google.golang.org/protobuf/types/known/wrapperspb"
+	"testing"
+)
+
+func TestData_ShouldDecodeByContentType(t *testing.T) {
+	Convey("given data of each content type", t, func() {
+		type point struct {
+			X int `json:"x" codec:"x"`
+		}
+
+		json, err := JSON(point{X: 1})
+		So(err, ShouldBeNil)
+		msgpack, err := Msgpack(point{X: 2})
+		So(err, ShouldBeNil)
+		any, err := AnyOf(wrapperspb.String("hello"))
+		So(err, ShouldBeNil)
+
+		Convey("then decoded into typed values", func() {
+			p := point{}
+			So(json.Decode(&p), ShouldBeNil)
+			So(p.X, ShouldEqual, 1)
+			So(msgpack.Decode(&p), ShouldBeNil)
+			So(p.X, ShouldEqual, 2)
+
+			s := &wrapperspb.StringValue{}
+			So(any.Decode(s), ShouldBeNil)
+			So(s.Value, ShouldEqual, "hello")
+
+			var b []byte
+			So(Raw([]byte{0x01}).Decode(&b), ShouldBeNil)
+			So(b, ShouldResemble, []byte{0x01})
+		})
+
+		Convey("then decoded into values can be served as JSON", func() {
+			v, err := DecodeValue(msgpack)
+			So(err, ShouldBeNil)
+			So(v, ShouldResemble, map[string]interface{}{"x": int64(2)})
+
+			n, err := DecodeNumber(json)
+			So(errors.Cause(err), ShouldEqual, ErrUndecodable)
+			So(n, ShouldEqual, 0)
+		})
+
+		Convey("then only textual data can be sent as string", func() {
+			So(Text("a").Textual(), ShouldBeTrue)
+			So(json.Textual(), ShouldBeTrue)
+			So(msgpack.Textual(), ShouldBeFalse)
+			So(any.Textual(), ShouldBeFalse)
+		})
+	})
+}
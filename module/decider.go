@@ -1,39 +1,349 @@
 package module
 
 import (
+	"container/list"
 	"github.com/TD-Hackathon-2022/DCoB-Scheduler/api"
 	"github.com/TD-Hackathon-2022/DCoB-Scheduler/comm"
+	"github.com/pkg/errors"
+	"sync"
+	"time"
 )
 
 var log = comm.GetLogger()
 
+// interruptedJobTTL is how long tasks of interrupted job are still dropped, long enough for its retries and
+// interrupted tasks to drain, job ids are never reused so the entry is useless afterwards
+const interruptedJobTTL = time.Hour
+
+// parkedRecheckInterval is how often parked tasks are checked again without worker freed, e.g. reputation recovered
+const parkedRecheckInterval = 10 * time.Second
+
 type Decider struct {
-	taskQ <-chan *Task
-	pool  *WorkerPool
+	taskQ       chan *Task
+	pool        *WorkerPool
+	policy      SchedulePolicy
+	bufferSize  int
+	taskTimeout time.Duration
+	funcs       *FuncRegistry
+	// parked are tasks no connected worker is capable to run, kept out of policy so that they never fill the buffer
+	parked *list.List
+	// recheckParked is set once worker freed or joined, parked tasks may be capable to run then
+	recheckParked bool
+	// waitingSince is when decider began to wait for free capable worker to run buffered tasks, zero if not waiting
+	waitingSince time.Time
+	// interruptedJobs are ids of interrupted jobs to the time they were interrupted
+	interruptedJobs sync.Map
+	interruptCh     chan struct{}
+}
+
+type DeciderOption func(d *Decider)
+
+func WithSchedulePolicy(policy SchedulePolicy) DeciderOption {
+	return func(d *Decider) {
+		d.policy = policy
+	}
+}
+
+func WithPolicyBufferSize(size int) DeciderOption {
+	return func(d *Decider) {
+		if size > 0 {
+			d.bufferSize = size
+		}
+	}
+}
+
+// WithTaskTimeout fails task that reports no status within timeout since assigned or last reported,
+// task's own timeout takes precedence, zero means never timeout
+func WithTaskTimeout(timeout time.Duration) DeciderOption {
+	return func(d *Decider) {
+		d.taskTimeout = timeout
+	}
+}
+
+// WithFuncRegistry ships registered WASM func along with task, by hash or by code for legacy worker
+func WithFuncRegistry(funcs *FuncRegistry) DeciderOption {
+	return func(d *Decider) {
+		d.funcs = funcs
+	}
 }
 
 func (d *Decider) Start() {
-	for task := range d.taskQ {
-		if task == poisonTask {
-			d.pool.InterruptJobTasks(task.JobId)
+	recheck := time.NewTicker(parkedRecheckInterval)
+	defer recheck.Stop()
+
+	for {
+		d.unpark()
+		d.fillBuffer()
+
+		if d.dispatch() {
+			continue
+		}
+		if d.waitingSince.IsZero() && d.policy.Len() > 0 {
+			d.waitingSince = time.Now()
+		}
+
+		// none of free workers capable to run buffered tasks, wait for newly freed worker or new task,
+		// buffer full of tasks waiting for busy workers still takes one more in case free worker suits it,
+		// nil channel is never ready
+		var taskQ chan *Task
+		if d.policy.Len() < d.bufferSize || d.policy.Len() == d.bufferSize && d.pool.hasFree() {
+			taskQ = d.taskQ
+		}
+		var recheckC <-chan time.Time
+		if d.parked.Len() > 0 {
+			recheckC = recheck.C
+		}
+
+		select {
+		case task, ok := <-taskQ:
+			if !ok {
+				return
+			}
+			d.accept(task)
+		case <-d.pool.freed():
+			d.recheckParked = true
+		case <-recheckC:
+			d.recheckParked = true
+		case <-d.interruptCh:
+			d.purge()
+		}
+	}
+}
+
+// dispatch assigns the first task chosen by policy that some free worker is capable to run,
+// tasks skipped for lacking free capable worker are put back to policy where they were,
+// or parked if no connected worker is capable to run them
+func (d *Decider) dispatch() (dispatched bool) {
+	skipped := make([]*Task, 0)
+	defer func() {
+		for i := len(skipped) - 1; i >= 0; i-- {
+			d.policy.Putback(skipped[i])
+		}
+	}()
+
+	for {
+		task, ok := d.policy.Pop()
+		if !ok {
+			return false
+		}
+
+		if d.jobInterrupted(task.JobId) {
+			task.endTrace()
+			continue
+		}
+
+		if err := d.loadFunc(task); err != nil {
+			d.reject(task, err)
+			continue
+		}
+
+		s, found := d.pool.apply(task)
+		if !found {
+			if d.pool.capable(task) {
+				skipped = append(skipped, task)
+			} else {
+				d.park(task)
+			}
 			continue
 		}
 
-		wkr := d.pool.blockApply(task.JobId)
-		success := wkr.assign(task, d.statusNotify, d.exitNotify)
+		s.taskLock.Lock()
+		task.traceStage("task.run", workerIdKey.String(s.wkr.id), slotKey.Int(s.index))
+		task.workerId = s.wkr.id
+		task.principal = s.wkr.principal
+		success := s.assign(task, d.statusNotify, d.exitNotify)
+		if success {
+			observeAssigned(task)
+			d.resetTimeout(s, task)
+			if task.group != nil {
+				task.group.assigned(s.wkr.principal)
+			}
+			d.endWait(task)
+			if d.jobInterrupted(task.JobId) {
+				// job interrupted concurrently after checked, its running tasks may be interrupted before this one
+				s.interrupt()
+			}
+		}
+		s.taskLock.Unlock()
+
 		if !success {
+			if *s.atomicGetOccupiedBy() == notAvailable {
+				// worker removed between apply and assign, try another one
+				d.requeue(task, 0)
+				return true
+			}
+
 			log.Fatalf("Occupied worker cannot be assign to antoher job.")
 		}
+		return true
+	}
+}
+
+// endWait observes how long decider waited for free capable worker before task dispatched, if it ever waited
+func (d *Decider) endWait(task *Task) {
+	if d.waitingSince.IsZero() {
+		return
+	}
+
+	observeWait(d.waitingSince)
+	task.traceSince("pool.wait", d.waitingSince)
+	d.waitingSince = time.Time{}
+}
+
+// loadFunc attaches WASM func to task, func not in registry is regarded as built in func of worker
+func (d *Decider) loadFunc(task *Task) error {
+	if !task.NeedsWasm || task.funcCode != nil {
+		return nil
+	}
+
+	if d.funcs == nil {
+		return errors.Wrapf(ErrFuncNotFound, "no func registry for func: %s", task.FuncId)
+	}
+
+	fn, code, err := d.funcs.Load(task.FuncId)
+	if err != nil {
+		return err
+	}
+
+	task.funcCode = code
+	task.funcHash = fn.Hash
+	return nil
+}
+
+// reject fails the task without dispatching it, retry is pointless since it can never be run
+func (d *Decider) reject(task *Task, err error) {
+	log.Errorf("Task %s rejected: %v", task.Id, err)
+	task.Ctx.Status = api.TaskStatus_Error
+	task.Ctx.IntermediateData = Text(err.Error())
+	task.UpdateHandler(task)
+}
+
+func (d *Decider) accept(task *Task) {
+	if task.poison {
+		d.InterruptJob(task.JobId)
+		return
+	}
+
+	// task to be verified is scheduled as its replicas, it is settled once replicas agree
+	if task.Replicas > 1 && task.group == nil {
+		task.traceStage("task.verify", replicasKey.Int(task.Replicas))
+		for _, replica := range replicate(task, d.pool.reputation).replicas {
+			startTaskTrace(task.traceContext(), replica)
+			d.accept(replica)
+		}
+		return
+	}
+
+	task.traceStage("task.schedule")
+	d.policy.Push(task)
+}
+
+// fillBuffer moves queued tasks to policy without blocking, until buffer is full
+func (d *Decider) fillBuffer() {
+	for d.policy.Len() < d.bufferSize {
+		select {
+		case task, ok := <-d.taskQ:
+			if !ok {
+				return
+			}
+			d.accept(task)
+		default:
+			return
+		}
 	}
 }
 
-func (d *Decider) statusNotify(w *worker, payload *api.StatusPayload) {
-	task := w.task
+// park keeps task no connected worker is capable to run, until some worker joined or freed suits it
+func (d *Decider) park(task *Task) {
+	task.traceStage("task.park")
+	d.parked.PushBack(task)
+}
+
+// unpark moves parked tasks some connected worker is capable to run back to policy, until buffer is full
+func (d *Decider) unpark() {
+	if !d.recheckParked {
+		return
+	}
+
+	for e := d.parked.Front(); e != nil; {
+		if d.policy.Len() >= d.bufferSize {
+			// the rest is checked again once buffer drained
+			return
+		}
+
+		next := e.Next()
+		task := e.Value.(*Task)
+		if d.jobInterrupted(task.JobId) {
+			d.parked.Remove(e)
+			task.endTrace()
+		} else if d.pool.capable(task) {
+			d.parked.Remove(e)
+			task.traceStage("task.schedule")
+			d.policy.Push(task)
+		}
+		e = next
+	}
+	d.recheckParked = false
+}
+
+// purge drops buffered and parked tasks of interrupted jobs
+func (d *Decider) purge() {
+	kept := make([]*Task, 0, d.policy.Len())
+	for {
+		task, ok := d.policy.Pop()
+		if !ok {
+			break
+		}
+
+		if d.jobInterrupted(task.JobId) {
+			task.endTrace()
+			continue
+		}
+		kept = append(kept, task)
+	}
+	for i := len(kept) - 1; i >= 0; i-- {
+		d.policy.Putback(kept[i])
+	}
+
+	for e := d.parked.Front(); e != nil; {
+		next := e.Next()
+		if task := e.Value.(*Task); d.jobInterrupted(task.JobId) {
+			d.parked.Remove(e)
+			task.endTrace()
+		}
+		e = next
+	}
+}
+
+func (d *Decider) statusNotify(s *slot, payload *api.StatusPayload) {
+	task := s.task
+	span := task.startSpan("worker.status", workerIdKey.String(s.wkr.id),
+		taskStatusKey.String(payload.TaskStatus.String()), progressKey.Float64(float64(payload.Progress)))
+	defer span.End()
+
 	task.Ctx.Status = payload.TaskStatus
+	result := dataOf(payload.Result, payload.ExecResult)
 	if payload.TaskStatus == api.TaskStatus_Finished {
-		task.Ctx.FinalData = payload.ExecResult
+		task.Ctx.FinalData = result
+		task.Ctx.Progress = 1
 	} else {
-		task.Ctx.IntermediateData = payload.ExecResult
+		task.Ctx.Progress = payload.Progress
+		task.Ctx.IntermediateData = result
+	}
+	d.verify(s, task)
+
+	if task.Ctx.Status == api.TaskStatus_Running {
+		d.resetTimeout(s, task)
+	} else {
+		stopTimeout(s)
+		observeEnded(task, task.Ctx.Status)
+	}
+
+	// failed task will be sent back to task q, job only see the final failure after retries run out
+	if d.shouldRetry(task) {
+		d.pool.returnBack(s)
+		d.retry(task)
+		return
 	}
 
 	task.UpdateHandler(task)
@@ -42,24 +352,152 @@ func (d *Decider) statusNotify(w *worker, payload *api.StatusPayload) {
 	case api.TaskStatus_Error:
 		fallthrough
 	case api.TaskStatus_Interrupted:
-		// TODO: maybe retry?
 		fallthrough
 	case api.TaskStatus_Finished:
-		d.pool.returnBack(w)
+		d.pool.returnBack(s)
 	default:
 	}
 }
 
-func (d *Decider) exitNotify(w *worker) {
-	task := w.task
-	if task != nil && task.Ctx.Status == api.TaskStatus_Running {
-		task.Ctx.Status = api.TaskStatus_Interrupted
+// verify fails finished task whose result rejected by its verifier, and penalizes the worker reported it
+func (d *Decider) verify(s *slot, task *Task) {
+	if task.Ctx.Status != api.TaskStatus_Finished || task.Verify == nil {
+		return
+	}
+
+	if err := task.Verify(task); err != nil {
+		log.Warnf("Result of task %s from worker %s rejected: %v", task.Id, s.wkr.id, err)
+		observeVerification(task, "rejected")
+		d.pool.reputation.Penalize(s.wkr.principal, err.Error())
+		task.Ctx.Status = api.TaskStatus_Error
+		task.Ctx.FinalData = Data{}
+		task.Ctx.IntermediateData = Text(err.Error())
+	}
+}
+
+func (d *Decider) exitNotify(s *slot) {
+	stopTimeout(s)
+	task := s.task
+	if task == nil || task.Ctx.Status != api.TaskStatus_Running {
+		return
+	}
+
+	task.Ctx.Status = api.TaskStatus_Interrupted
+	observeEnded(task, task.Ctx.Status)
+	if d.jobInterrupted(task.JobId) {
+		task.UpdateHandler(task)
+		return
+	}
+
+	// task lost by worker disconnecting is not task's fault, re-dispatch it without consuming retry attempts
+	if task.LostHandler != nil {
+		task.LostHandler(task)
+	}
+
+	task.Ctx.Status = api.TaskStatus_Running
+	task.Ctx.IntermediateData = Data{}
+	task.Ctx.Progress = 0
+	log.Infof("Task %s lost by worker %s, re-dispatch", task.Id, s.wkr.id)
+	d.requeue(task, 0)
+}
+
+// resetTimeout (re)starts the execution timer of task running on slot, caller should hold slot's task lock
+func (d *Decider) resetTimeout(s *slot, task *Task) {
+	timeout := task.Timeout
+	if timeout == 0 {
+		timeout = d.taskTimeout
+	}
+
+	stopTimeout(s)
+	if timeout <= 0 {
+		return
+	}
+
+	s.taskTimer = time.AfterFunc(timeout, func() {
+		log.Warnf("Task %s timeout on worker %s", task.Id, s.wkr.id)
+		d.pool.expireTask(s, task.Id)
+	})
+}
+
+func stopTimeout(s *slot) {
+	if s.taskTimer != nil {
+		s.taskTimer.Stop()
+		s.taskTimer = nil
+	}
+}
+
+func (d *Decider) shouldRetry(task *Task) bool {
+	if d.jobInterrupted(task.JobId) {
+		return false
+	}
+
+	return task.RetryPolicy.shouldRetry(task)
+}
+
+func (d *Decider) retry(task *Task) {
+	task.Attempt++
+	task.Ctx.Status = api.TaskStatus_Running
+	task.Ctx.IntermediateData = Data{}
+	task.Ctx.Progress = 0
+
+	delay := task.RetryPolicy.backoff(task.Attempt)
+	log.Infof("Task %s will be retried after %v, attempt: %d", task.Id, delay, task.Attempt)
+	d.requeue(task, delay)
+}
+
+// requeue send task back to task q asynchronously, since caller may hold the pool lock
+func (d *Decider) requeue(task *Task, delay time.Duration) {
+	task.traceStage("task.queue")
+	time.AfterFunc(delay, func() {
+		if d.jobInterrupted(task.JobId) {
+			task.endTrace()
+			return
+		}
+
+		d.taskQ <- task
+	})
+}
+
+// InterruptJob interrupts running tasks of job and drops its tasks not dispatched yet, it is safe to call
+// from any goroutine, so that job is interrupted even if task q is full
+func (d *Decider) InterruptJob(jobId string) {
+	d.markInterrupted(jobId)
+	d.pool.InterruptJobTasks(jobId)
+	select {
+	case d.interruptCh <- struct{}{}:
+	default:
 	}
 }
 
-func NewDecider(pool *WorkerPool, taskQ <-chan *Task) *Decider {
-	return &Decider{
-		pool:  pool,
-		taskQ: taskQ,
+// markInterrupted remembers job interrupted, and forgets jobs interrupted before ttl, so entries do not pile up
+func (d *Decider) markInterrupted(jobId string) {
+	now := time.Now()
+	d.interruptedJobs.Range(func(id, at interface{}) bool {
+		if now.Sub(at.(time.Time)) > interruptedJobTTL {
+			d.interruptedJobs.Delete(id)
+		}
+		return true
+	})
+	d.interruptedJobs.Store(jobId, now)
+}
+
+func (d *Decider) jobInterrupted(jobId string) bool {
+	_, interrupted := d.interruptedJobs.Load(jobId)
+	return interrupted
+}
+
+func NewDecider(pool *WorkerPool, taskQ chan *Task, opts ...DeciderOption) *Decider {
+	d := &Decider{
+		pool:        pool,
+		taskQ:       taskQ,
+		policy:      newFIFOPolicy(),
+		bufferSize:  defaultPolicyBufferSize,
+		parked:      list.New(),
+		interruptCh: make(chan struct{}, 1),
+	}
+
+	for _, opt := range opts {
+		opt(d)
 	}
+	return d
 }
@@ -1,10 +1,15 @@
 package module
 
 import (
+	"fmt"
 	. "github.com/TD-Hackathon-2022/DCoB-Scheduler/api"
+	"github.com/pkg/errors"
 	. "github.com/smartystreets/goconvey/convey"
+	"io/ioutil"
+	"os"
 	"runtime"
 	"testing"
+	"time"
 )
 
 func TestDecider_ShouldOccupyAndAssignTaskToWorker(t *testing.T) {
@@ -15,15 +20,15 @@ func TestDecider_ShouldOccupyAndAssignTaskToWorker(t *testing.T) {
 			JobId: jobId,
 			Ctx: &Context{
 				Status:   TaskStatus_Running,
-				InitData: "fake-data",
+				InitData: Text("fake-data"),
 			},
 			FuncId: "fake-func-id",
 		}
 
 		addr := "127.0.0.1:8081"
-		w := &worker{id: addr, status: WorkerStatus_Idle, occupiedBy: &notOccupied}
+		w := newTestSlot(addr, WorkerStatus_Idle, &notOccupied, nil, nil)
 		wp := NewWorkerPool()
-		wp.pool[addr] = w
+		wp.pool[addr] = w.wkr
 		wp.freeList.PushFront(w)
 
 		taskQ := make(chan *Task, 1)
@@ -46,6 +51,69 @@ func TestDecider_ShouldOccupyAndAssignTaskToWorker(t *testing.T) {
 	})
 }
 
+func TestDecider_ShouldSkipTaskWithoutCapableWorker(t *testing.T) {
+	Convey("given decider with worker only capable to mine", t, func() {
+		piTask := &Task{Id: "pi-task", JobId: "pi-job", Ctx: &Context{InitData: Text("fake-data")}, FuncId: "custom-func-monte_carlo_pi"}
+		minerTask := &Task{Id: "miner-task", JobId: "miner-job", Ctx: &Context{InitData: Text("fake-data")}, FuncId: "hash-miner"}
+
+		wp := NewWorkerPool()
+		outputCh := make(chan *Msg, 1)
+		_ = wp.Add("miner", outputCh, &RegisterPayload{FuncIds: []string{"hash-miner"}, ProtocolVersion: ProtocolVersion})
+
+		taskQ := make(chan *Task, 2)
+		taskQ <- piTask
+		taskQ <- minerTask
+		decider := NewDecider(wp, taskQ)
+		go decider.Start()
+		defer close(taskQ)
+
+		Convey("when decider start", func() {
+			msg := <-outputCh
+
+			Convey("then miner task assigned, pi task waits for capable worker", func() {
+				So(msg.GetAssign().TaskId, ShouldEqual, minerTask.Id)
+			})
+		})
+	})
+}
+
+func TestDecider_ShouldShipWasmFuncCodeOrRejectUnknownFunc(t *testing.T) {
+	Convey("given decider with func registry and wasm worker", t, func() {
+		dir, _ := ioutil.TempDir("", "func-registry")
+		defer os.RemoveAll(dir)
+		funcs, _ := NewFuncRegistry(dir)
+		fn, _ := funcs.Register("pi", "v1", fakeWasm)
+
+		rejected := make(chan *Task, 1)
+		known := &Task{Id: "known-task", JobId: "job", Ctx: &Context{}, FuncId: "pi", NeedsWasm: true}
+		unknown := &Task{Id: "unknown-task", JobId: "job", Ctx: &Context{}, FuncId: "e", NeedsWasm: true,
+			UpdateHandler: func(task *Task) { rejected <- task }}
+
+		wp := NewWorkerPool()
+		outputCh := make(chan *Msg, 1)
+		_ = wp.Add("wasm", outputCh, &RegisterPayload{Wasm: true, ProtocolVersion: ProtocolVersion})
+
+		taskQ := make(chan *Task, 2)
+		taskQ <- unknown
+		taskQ <- known
+		decider := NewDecider(wp, taskQ, WithFuncRegistry(funcs))
+		go decider.Start()
+		defer close(taskQ)
+
+		Convey("when decider start", func() {
+			failed := <-rejected
+			msg := <-outputCh
+
+			Convey("then unknown func rejected, registered func shipped by hash only", func() {
+				So(failed.Ctx.Status, ShouldEqual, TaskStatus_Error)
+				So(msg.GetAssign().TaskId, ShouldEqual, known.Id)
+				So(msg.GetAssign().FuncHash, ShouldEqual, fn.Hash)
+				So(msg.GetAssign().FuncCode, ShouldBeEmpty)
+			})
+		})
+	})
+}
+
 func TestDecider_ShouldUpdateTaskStatusThenCallTaskHandlerWhenNotify(t *testing.T) {
 	Convey("given decider", t, func() {
 		notified := false
@@ -54,7 +122,7 @@ func TestDecider_ShouldUpdateTaskStatusThenCallTaskHandlerWhenNotify(t *testing.
 			JobId: "fake-job-id",
 			Ctx: &Context{
 				Status:   TaskStatus_Running,
-				InitData: "fake-data",
+				InitData: Text("fake-data"),
 			},
 			FuncId: "fake-func-id",
 			UpdateHandler: func(*Task) {
@@ -66,7 +134,7 @@ func TestDecider_ShouldUpdateTaskStatusThenCallTaskHandlerWhenNotify(t *testing.
 		decider := NewDecider(wp, nil)
 
 		Convey("when notify with finished status", func() {
-			w := &worker{id: "127.0.0.1:8081", status: WorkerStatus_Busy, occupiedBy: &task.JobId, task: task}
+			w := newTestSlot("127.0.0.1:8081", WorkerStatus_Busy, &task.JobId, task, nil)
 
 			payload := &StatusPayload{
 				TaskStatus: TaskStatus_Finished,
@@ -76,13 +144,13 @@ func TestDecider_ShouldUpdateTaskStatusThenCallTaskHandlerWhenNotify(t *testing.
 
 			Convey("then worker updated", func() {
 				So(task.Ctx.Status, ShouldEqual, TaskStatus_Finished)
-				So(task.Ctx.FinalData, ShouldEqual, payload.ExecResult)
+				So(task.Ctx.FinalData, ShouldResemble, Text(payload.ExecResult))
 				So(notified, ShouldBeTrue)
 			})
 		})
 
 		Convey("when notify with running status", func() {
-			w := &worker{id: "127.0.0.1:8081", status: WorkerStatus_Busy, occupiedBy: &task.JobId, task: task}
+			w := newTestSlot("127.0.0.1:8081", WorkerStatus_Busy, &task.JobId, task, nil)
 
 			payload := &StatusPayload{
 				TaskStatus: TaskStatus_Running,
@@ -92,10 +160,24 @@ func TestDecider_ShouldUpdateTaskStatusThenCallTaskHandlerWhenNotify(t *testing.
 
 			Convey("then worker updated", func() {
 				So(task.Ctx.Status, ShouldEqual, TaskStatus_Running)
-				So(task.Ctx.IntermediateData, ShouldEqual, payload.ExecResult)
+				So(task.Ctx.IntermediateData, ShouldResemble, Text(payload.ExecResult))
 				So(notified, ShouldBeTrue)
 			})
 		})
+
+		Convey("when notify with typed result", func() {
+			w := newTestSlot("127.0.0.1:8081", WorkerStatus_Busy, &task.JobId, task, nil)
+
+			payload := &StatusPayload{
+				TaskStatus: TaskStatus_Finished,
+				Result:     &Payload{ContentType: ContentType_Raw, Data: []byte{0x00, 0xff}},
+			}
+			decider.statusNotify(w, payload)
+
+			Convey("then result kept as bytes with content type", func() {
+				So(task.Ctx.FinalData, ShouldResemble, Raw([]byte{0x00, 0xff}))
+			})
+		})
 	})
 }
 
@@ -107,7 +189,7 @@ func TestDecider_ShouldReleaseWorkerWhenNotifyWithTaskNotRunningStatus(t *testin
 			JobId: "fake-job-id",
 			Ctx: &Context{
 				Status:   TaskStatus_Finished,
-				InitData: "fake-data",
+				InitData: Text("fake-data"),
 			},
 			FuncId: "fake-func-id",
 			UpdateHandler: func(*Task) {
@@ -119,16 +201,307 @@ func TestDecider_ShouldReleaseWorkerWhenNotifyWithTaskNotRunningStatus(t *testin
 		decider := NewDecider(wp, nil)
 
 		Convey("when notify", func() {
-			w := &worker{id: "127.0.0.1:8081", status: WorkerStatus_Busy, occupiedBy: &task.JobId, task: task}
+			w := newTestSlot("127.0.0.1:8081", WorkerStatus_Busy, &task.JobId, task, nil)
 			decider.statusNotify(w, &StatusPayload{
 				TaskStatus: TaskStatus_Error,
 			})
 
 			Convey("then worker updated", func() {
 				So(notified, ShouldBeTrue)
-				So(w.status, ShouldEqual, WorkerStatus_Idle)
+				So(w.wkr.status, ShouldEqual, WorkerStatus_Idle)
 				So(w.occupiedBy, ShouldEqual, &notOccupied)
 			})
 		})
 	})
 }
+
+func TestDecider_ShouldRequeueFailedTaskWithoutNotifyJobWhenRetryable(t *testing.T) {
+	Convey("given decider", t, func() {
+		notified := false
+		task := &Task{
+			Id:    "fake-task",
+			JobId: "fake-job-id",
+			Ctx: &Context{
+				Status:   TaskStatus_Running,
+				InitData: Text("fake-data"),
+			},
+			FuncId: "fake-func-id",
+			UpdateHandler: func(*Task) {
+				notified = true
+			},
+			RetryPolicy: NewRetryPolicy(2, time.Millisecond, time.Millisecond, TaskStatus_Error),
+		}
+
+		wp := NewWorkerPool()
+		taskQ := make(chan *Task, 1)
+		decider := NewDecider(wp, taskQ)
+
+		Convey("when notify with error status", func() {
+			w := newTestSlot("127.0.0.1:8081", WorkerStatus_Busy, &task.JobId, task, nil)
+			decider.statusNotify(w, &StatusPayload{TaskStatus: TaskStatus_Error})
+
+			Convey("then task requeued and worker released", func() {
+				So(<-taskQ, ShouldEqual, task)
+				So(task.Attempt, ShouldEqual, 1)
+				So(task.Ctx.Status, ShouldEqual, TaskStatus_Running)
+				So(notified, ShouldBeFalse)
+				So(w.occupiedBy, ShouldEqual, &notOccupied)
+			})
+
+			Convey("then job notified when retries run out", func() {
+				<-taskQ
+				w := newTestSlot("127.0.0.1:8081", WorkerStatus_Busy, &task.JobId, task, nil)
+				decider.statusNotify(w, &StatusPayload{TaskStatus: TaskStatus_Error})
+
+				So(notified, ShouldBeTrue)
+				So(len(taskQ), ShouldEqual, 0)
+				So(task.Ctx.Status, ShouldEqual, TaskStatus_Error)
+			})
+		})
+
+		Convey("when notify with error status after job interrupted", func() {
+			decider.markInterrupted(task.JobId)
+			w := newTestSlot("127.0.0.1:8081", WorkerStatus_Busy, &task.JobId, task, nil)
+			decider.statusNotify(w, &StatusPayload{TaskStatus: TaskStatus_Error})
+
+			Convey("then task not requeued", func() {
+				So(notified, ShouldBeTrue)
+				So(len(taskQ), ShouldEqual, 0)
+			})
+		})
+	})
+}
+
+func TestDecider_ShouldRequeueTaskAndNotifyLostWhenWorkerExit(t *testing.T) {
+	Convey("given decider", t, func() {
+		lost := false
+		task := &Task{
+			Id:    "fake-task",
+			JobId: "fake-job-id",
+			Ctx: &Context{
+				Status:   TaskStatus_Running,
+				InitData: Text("fake-data"),
+			},
+			FuncId: "fake-func-id",
+			LostHandler: func(*Task) {
+				lost = true
+			},
+		}
+
+		wp := NewWorkerPool()
+		taskQ := make(chan *Task, 1)
+		decider := NewDecider(wp, taskQ)
+
+		Convey("when worker exit", func() {
+			w := newTestSlot("127.0.0.1:8081", WorkerStatus_Busy, &task.JobId, task, nil)
+			decider.exitNotify(w)
+
+			Convey("then task re-dispatched without consuming attempts", func() {
+				So(<-taskQ, ShouldEqual, task)
+				So(lost, ShouldBeTrue)
+				So(task.Attempt, ShouldEqual, 0)
+				So(task.Ctx.Status, ShouldEqual, TaskStatus_Running)
+			})
+		})
+
+		Convey("when worker exit after job interrupted", func() {
+			notified := false
+			task.UpdateHandler = func(*Task) {
+				notified = true
+			}
+			decider.markInterrupted(task.JobId)
+			w := newTestSlot("127.0.0.1:8081", WorkerStatus_Busy, &task.JobId, task, nil)
+			decider.exitNotify(w)
+
+			Convey("then task not re-dispatched and job notified", func() {
+				So(notified, ShouldBeTrue)
+				So(lost, ShouldBeFalse)
+				So(task.Ctx.Status, ShouldEqual, TaskStatus_Interrupted)
+				So(len(taskQ), ShouldEqual, 0)
+			})
+		})
+	})
+}
+
+func TestDecider_ShouldDispatchTaskChosenByPolicy(t *testing.T) {
+	Convey("given decider with priority policy and no worker", t, func() {
+		wp := NewWorkerPool()
+		taskQ := make(chan *Task, 3)
+		policy, _ := NewSchedulePolicy(PriorityPolicy)
+		decider := NewDecider(wp, taskQ, WithSchedulePolicy(policy))
+
+		low0 := &Task{Id: "low-0", JobId: "low", Ctx: &Context{InitData: Text("fake-data")}}
+		low1 := &Task{Id: "low-1", JobId: "low", Ctx: &Context{InitData: Text("fake-data")}}
+		high := &Task{Id: "high", JobId: "high", Priority: 1, Ctx: &Context{InitData: Text("fake-data")}}
+		taskQ <- low0
+		taskQ <- low1
+		taskQ <- high
+		go decider.Start()
+		time.Sleep(100 * time.Millisecond)
+
+		Convey("when worker joined", func() {
+			addr := "127.0.0.1:8081"
+			_ = wp.Add(addr, make(chan *Msg, 1), nil)
+			time.Sleep(100 * time.Millisecond)
+
+			Convey("then task with highest priority assigned", func() {
+				wp.lock.RLock()
+				defer wp.lock.RUnlock()
+				So(wp.pool[addr].slots[0].task, ShouldEqual, high)
+			})
+		})
+
+		close(taskQ)
+	})
+}
+
+func TestDecider_ShouldFailAndRetryTaskWhenTimeout(t *testing.T) {
+	Convey("given decider with task timeout", t, func() {
+		notified := false
+		task := &Task{
+			Id:    "fake-task",
+			JobId: "fake-job-id",
+			Ctx: &Context{
+				Status:   TaskStatus_Running,
+				InitData: Text("fake-data"),
+			},
+			FuncId: "fake-func-id",
+			UpdateHandler: func(*Task) {
+				notified = true
+			},
+			RetryPolicy: NewRetryPolicy(2, time.Millisecond, time.Millisecond, TaskStatus_Error),
+		}
+
+		wp := NewWorkerPool()
+		addr := "127.0.0.1:8081"
+		outputCh := make(chan *Msg, 2)
+		_ = wp.Add(addr, outputCh, nil)
+		taskQ := make(chan *Task, 1)
+		decider := NewDecider(wp, taskQ, WithTaskTimeout(100*time.Millisecond))
+		w, _ := wp.apply(task)
+		w.assign(task, decider.statusNotify, decider.exitNotify)
+		decider.resetTimeout(w, task)
+
+		Convey("when task reports no status before timeout", func() {
+			So((<-outputCh).Cmd, ShouldEqual, CMD_Assign)
+			msg := <-outputCh
+			retried := <-taskQ
+
+			Convey("then task interrupted and retried, stale status ignored", func() {
+				So(msg.Cmd, ShouldEqual, CMD_Interrupt)
+				So(retried, ShouldEqual, task)
+				So(task.Attempt, ShouldEqual, 1)
+				So(notified, ShouldBeFalse)
+
+				err := wp.UpdateStatus(addr, &StatusPayload{TaskId: task.Id, TaskStatus: TaskStatus_Interrupted})
+				So(errors.Cause(err), ShouldEqual, ErrStaleStatus)
+				So(wp.ListWorkers()[0].Failed, ShouldEqual, 1)
+			})
+		})
+	})
+}
+
+func TestDecider_ShouldNotBufferBeyondSizeWhileCapableWorkerBusy(t *testing.T) {
+	Convey("given decider with buffer of 2 and capable worker busy", t, func() {
+		wp := NewWorkerPool()
+		_ = wp.Add("pi", make(chan *Msg, 1), &RegisterPayload{FuncIds: []string{"custom-func-monte_carlo_pi"}, ProtocolVersion: ProtocolVersion})
+		_, _ = wp.apply(&Task{JobId: "running-job", FuncId: "custom-func-monte_carlo_pi"})
+
+		taskQ := make(chan *Task, 5)
+		for i := 0; i < 5; i++ {
+			taskQ <- &Task{Id: "pi-task", JobId: "pi-job", Ctx: &Context{InitData: Text("fake-data")}, FuncId: "custom-func-monte_carlo_pi"}
+		}
+		decider := NewDecider(wp, taskQ, WithPolicyBufferSize(2))
+		go decider.Start()
+
+		Convey("when decider start", func() {
+			time.Sleep(50 * time.Millisecond)
+
+			Convey("then only buffer size of tasks taken from task q", func() {
+				So(len(taskQ), ShouldEqual, 3)
+			})
+		})
+	})
+}
+
+func TestDecider_ShouldParkTasksWithoutCapableWorkerOutOfBuffer(t *testing.T) {
+	Convey("given decider with buffer of 2, worker only capable to mine and pi tasks queued before miner task", t, func() {
+		wp := NewWorkerPool()
+		minerCh := make(chan *Msg, 1)
+		_ = wp.Add("miner", minerCh, &RegisterPayload{FuncIds: []string{"hash-miner"}, ProtocolVersion: ProtocolVersion})
+
+		taskQ := make(chan *Task, 6)
+		for i := 0; i < 5; i++ {
+			taskQ <- &Task{Id: "pi-task", JobId: "pi-job", Ctx: &Context{InitData: Text("fake-data")}, FuncId: "custom-func-monte_carlo_pi"}
+		}
+		minerTask := &Task{Id: "miner-task", JobId: "miner-job", Ctx: &Context{InitData: Text("fake-data")}, FuncId: "hash-miner"}
+		taskQ <- minerTask
+		decider := NewDecider(wp, taskQ, WithPolicyBufferSize(2))
+		go decider.Start()
+		defer close(taskQ)
+
+		Convey("when decider start", func() {
+			msg := <-minerCh
+
+			Convey("then miner task assigned, pi tasks wait for capable worker to join", func() {
+				So(msg.GetAssign().TaskId, ShouldEqual, minerTask.Id)
+
+				piCh := make(chan *Msg, 1)
+				_ = wp.Add("pi", piCh, &RegisterPayload{FuncIds: []string{"custom-func-monte_carlo_pi"}, ProtocolVersion: ProtocolVersion})
+				So((<-piCh).GetAssign().TaskId, ShouldEqual, "pi-task")
+			})
+		})
+	})
+}
+
+func TestDecider_ShouldInterruptJobWhileBufferFull(t *testing.T) {
+	Convey("given decider with buffer of 2 full of tasks of job whose capable worker busy", t, func() {
+		wp := NewWorkerPool()
+		outputCh := make(chan *Msg, 4)
+		_ = wp.Add("pi", outputCh, &RegisterPayload{FuncIds: []string{"custom-func-monte_carlo_pi"}, ProtocolVersion: ProtocolVersion})
+
+		taskQ := make(chan *Task, 5)
+		for i := 0; i < 4; i++ {
+			taskQ <- &Task{
+				Id:            fmt.Sprintf("pi-task-%d", i),
+				JobId:         "pi-job",
+				Ctx:           &Context{Status: TaskStatus_Running, InitData: Text("fake-data")},
+				FuncId:        "custom-func-monte_carlo_pi",
+				UpdateHandler: func(*Task) {},
+			}
+		}
+		otherTask := &Task{Id: "other-task", JobId: "other-job", Ctx: &Context{InitData: Text("fake-data")}, FuncId: "custom-func-monte_carlo_pi"}
+		taskQ <- otherTask
+		decider := NewDecider(wp, taskQ, WithPolicyBufferSize(2))
+		go decider.Start()
+		defer close(taskQ)
+		So((<-outputCh).GetAssign().TaskId, ShouldEqual, "pi-task-0")
+		time.Sleep(50 * time.Millisecond)
+
+		Convey("when job interrupted", func() {
+			decider.InterruptJob("pi-job")
+
+			Convey("then running task interrupted, its queued tasks dropped, other job's task assigned", func() {
+				So((<-outputCh).GetInterrupt().TaskId, ShouldEqual, "pi-task-0")
+				_ = wp.UpdateStatus("pi", &StatusPayload{TaskId: "pi-task-0", TaskStatus: TaskStatus_Interrupted})
+				So((<-outputCh).GetAssign().TaskId, ShouldEqual, otherTask.Id)
+			})
+		})
+	})
+}
+
+func TestDecider_ShouldForgetJobsInterruptedLongAgo(t *testing.T) {
+	Convey("given decider remembers job interrupted long ago", t, func() {
+		decider := NewDecider(NewWorkerPool(), nil)
+		decider.interruptedJobs.Store("old-job", time.Now().Add(-interruptedJobTTL-time.Minute))
+
+		Convey("when another job interrupted", func() {
+			decider.markInterrupted("new-job")
+
+			Convey("then only the recent one is remembered", func() {
+				So(decider.jobInterrupted("old-job"), ShouldBeFalse)
+				So(decider.jobInterrupted("new-job"), ShouldBeTrue)
+			})
+		})
+	})
+}
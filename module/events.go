@@ -0,0 +1,139 @@
+package module
+
+import (
+	"github.com/TD-Hackathon-2022/DCoB-Scheduler/api"
+	"sync"
+	"time"
+)
+
+const (
+	TaskEventType = "task"
+	JobEventType  = "job"
+)
+
+// eventBufferSize bounds events queued for a subscriber, events are dropped for subscriber falls behind,
+// except the event of job ended, which takes place of the oldest one queued
+const eventBufferSize = 64
+
+// Event is a task status change or job update, streamed to subscribers of the job
+type Event struct {
+	Type  string      `json:"type"`
+	JobId string      `json:"jobId"`
+	Time  time.Time   `json:"time"`
+	Task  *TaskUpdate `json:"task,omitempty"`
+	Job   *JobUpdate  `json:"job,omitempty"`
+}
+
+type TaskUpdate struct {
+	TaskId   string      `json:"taskId"`
+	Status   string      `json:"status"`
+	Progress float32     `json:"progress"`
+	Data     interface{} `json:"data,omitempty"`
+}
+
+// JobUpdate is job state and its progress if job is Progressive, result is only given once job ended
+type JobUpdate struct {
+	State    JobState               `json:"state,omitempty"`
+	Progress float64                `json:"progress,omitempty"`
+	Result   map[string]interface{} `json:"result,omitempty"`
+}
+
+func newTaskEvent(task *Task) *Event {
+	data := task.Ctx.IntermediateData
+	if task.Ctx.Status == api.TaskStatus_Finished {
+		data = task.Ctx.FinalData
+	}
+
+	update := &TaskUpdate{TaskId: task.Id, Status: task.Ctx.Status.String(), Progress: task.Ctx.Progress}
+	if len(data.Bytes) > 0 {
+		update.Data, _ = DecodeValue(data)
+	}
+	return &Event{Type: TaskEventType, JobId: task.JobId, Time: time.Now(), Task: update}
+}
+
+// NewJobEvent tells job state, along with result only if job ended, since result of running job may be costly to build
+func NewJobEvent(job Job, state JobState) *Event {
+	update := &JobUpdate{State: state}
+	if p, ok := job.(Progressive); ok {
+		update.Progress = p.Progress()
+	}
+	if state.Terminal() {
+		update.Result = job.GetResult()
+	}
+	return &Event{Type: JobEventType, JobId: job.Id(), Time: time.Now(), Job: update}
+}
+
+// EventHub fans out events to subscribers by job, publishing never blocks
+type EventHub struct {
+	lock sync.RWMutex
+	subs map[string]map[chan *Event]struct{}
+}
+
+// Subscribe returns channel of events of job, cancel must be called once subscriber is gone
+func (h *EventHub) Subscribe(jobId string) (events <-chan *Event, cancel func()) {
+	ch := make(chan *Event, eventBufferSize)
+	h.lock.Lock()
+	if h.subs[jobId] == nil {
+		h.subs[jobId] = make(map[chan *Event]struct{})
+	}
+	h.subs[jobId][ch] = struct{}{}
+	h.lock.Unlock()
+
+	return ch, func() {
+		h.lock.Lock()
+		defer h.lock.Unlock()
+		delete(h.subs[jobId], ch)
+		if len(h.subs[jobId]) == 0 {
+			delete(h.subs, jobId)
+		}
+	}
+}
+
+func (h *EventHub) Publish(e *Event) {
+	if e.Job != nil && e.Job.State.Terminal() {
+		h.publishLast(e)
+		return
+	}
+
+	h.lock.RLock()
+	defer h.lock.RUnlock()
+	for ch := range h.subs[e.JobId] {
+		select {
+		case ch <- e:
+		default:
+			log.Warnf("Event of job %s dropped for slow subscriber", e.JobId)
+		}
+	}
+}
+
+// publishLast delivers event of job ended even to slow subscriber, by dropping the oldest event queued, so that
+// subscriber always knows when to stop, publishers are held off meanwhile so that the room made is not taken
+func (h *EventHub) publishLast(e *Event) {
+	h.lock.Lock()
+	defer h.lock.Unlock()
+	for ch := range h.subs[e.JobId] {
+		for sent := false; !sent; {
+			select {
+			case ch <- e:
+				sent = true
+			default:
+				select {
+				case <-ch:
+					log.Warnf("Event of job %s dropped for slow subscriber", e.JobId)
+				default:
+				}
+			}
+		}
+	}
+}
+
+// subscribed tells whether anyone listens to job, so costly events can be skipped
+func (h *EventHub) subscribed(jobId string) bool {
+	h.lock.RLock()
+	defer h.lock.RUnlock()
+	return len(h.subs[jobId]) > 0
+}
+
+func NewEventHub() *EventHub {
+	return &EventHub{subs: make(map[string]map[chan *Event]struct{})}
+}
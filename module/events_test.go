@@ -0,0 +1,59 @@
+package module
+
+import (
+	. "github.com/smartystreets/goconvey/convey"
+	"testing"
+)
+
+func TestEventHub_ShouldNeverBlockPublisher(t *testing.T) {
+	Convey("given event hub with subscriber never reads", t, func() {
+		hub := NewEventHub()
+		events, cancel := hub.Subscribe("job0")
+		other, cancelOther := hub.Subscribe("job1")
+		defer cancelOther()
+
+		Convey("when publish more events than buffered", func() {
+			for i := 0; i < eventBufferSize+10; i++ {
+				hub.Publish(&Event{Type: JobEventType, JobId: "job0"})
+			}
+
+			Convey("then extra events dropped, and events of other job not received", func() {
+				So(len(events), ShouldEqual, eventBufferSize)
+				So(len(other), ShouldEqual, 0)
+			})
+		})
+
+		Convey("when subscriber cancelled", func() {
+			cancel()
+
+			Convey("then job no longer subscribed", func() {
+				So(hub.subscribed("job0"), ShouldBeFalse)
+				So(hub.subscribed("job1"), ShouldBeTrue)
+			})
+		})
+	})
+}
+
+func TestEventHub_ShouldDeliverEventOfJobEndedToSlowSubscriber(t *testing.T) {
+	Convey("given event hub with subscriber whose buffer is full", t, func() {
+		hub := NewEventHub()
+		events, cancel := hub.Subscribe("job0")
+		defer cancel()
+		for i := 0; i < eventBufferSize; i++ {
+			hub.Publish(&Event{Type: TaskEventType, JobId: "job0"})
+		}
+
+		Convey("when job ended", func() {
+			hub.Publish(&Event{Type: JobEventType, JobId: "job0", Job: &JobUpdate{State: JobSucceeded}})
+
+			Convey("then the oldest event dropped for it, and it is the last one received", func() {
+				So(len(events), ShouldEqual, eventBufferSize)
+				var last *Event
+				for len(events) > 0 {
+					last = <-events
+				}
+				So(last.Job.State, ShouldEqual, JobSucceeded)
+			})
+		})
+	})
+}
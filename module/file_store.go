@@ -0,0 +1,385 @@
+package module
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"github.com/TD-Hackathon-2022/DCoB-Scheduler/api"
+	"github.com/pkg/errors"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+)
+
+// Persistent is implemented by jobs whose state can be saved to and restored from a durable JobStore
+type Persistent interface {
+	Kind() string
+	Snapshot() ([]byte, error)
+	Restore(state []byte) error
+}
+
+var (
+	jobFactoryLock sync.RWMutex
+	jobFactories   = make(map[string]func() Job)
+)
+
+// RegisterJobKind register factory to create an empty job of given kind, which is used to restore job from store
+func RegisterJobKind(kind string, factory func() Job) {
+	jobFactoryLock.Lock()
+	defer jobFactoryLock.Unlock()
+	jobFactories[kind] = factory
+}
+
+func newJobOfKind(kind string) (job Job, exist bool) {
+	jobFactoryLock.RLock()
+	defer jobFactoryLock.RUnlock()
+	factory, exist := jobFactories[kind]
+	if !exist {
+		return nil, false
+	}
+
+	return factory(), true
+}
+
+type jobRecord struct {
+	Id        string                    `json:"id"`
+	Kind      string                    `json:"kind"`
+	Lifecycle JobState                  `json:"lifecycle"`
+	UpdatedAt int64                     `json:"updatedAt"`
+	State     json.RawMessage           `json:"state"`
+	Tasks     map[string]api.TaskStatus `json:"tasks,omitempty"`
+}
+
+const defaultCompactThreshold = 64 << 20
+
+// fileStore is an append-only log of job snapshots along with status of their tasks, the latest record of each job
+// wins when reload, log is compacted to the latest records once grown over threshold
+type fileStore struct {
+	path             string
+	lock             sync.Mutex
+	file             *os.File
+	jobs             sync.Map
+	states           sync.Map
+	tasks            taskStates
+	lastState        map[string][]byte
+	lastLifecycle    map[string]JobState
+	lastTasks        map[string]int
+	lastLine         map[string][]byte
+	size             int64
+	liveSize         int64
+	compactThreshold int64
+	stopCh           chan struct{}
+	wg               sync.WaitGroup
+}
+
+type FileStoreOption func(s *fileStore)
+
+// WithCompactThreshold compacts the log once it grows over threshold bytes and mostly consists of stale records
+func WithCompactThreshold(threshold int64) FileStoreOption {
+	return func(s *fileStore) {
+		if threshold > 0 {
+			s.compactThreshold = threshold
+		}
+	}
+}
+
+func (s *fileStore) Store(job Job) {
+	s.jobs.Store(job.Id(), job)
+	if err := s.persist(job); err != nil {
+		log.Errorf("persist job %s: %v", job.Id(), err)
+	}
+}
+
+func (s *fileStore) Load(jobId string) (job Job, exist bool) {
+	v, exist := s.jobs.Load(jobId)
+	if !exist {
+		return nil, false
+	}
+
+	return v.(Job), true
+}
+
+func (s *fileStore) SetState(jobId string, state JobState) {
+	s.states.Store(jobId, state)
+	job, exist := s.Load(jobId)
+	if !exist {
+		return
+	}
+
+	if err := s.persist(job); err != nil {
+		log.Errorf("persist job %s: %v", jobId, err)
+	}
+}
+
+func (s *fileStore) State(jobId string) (state JobState, exist bool) {
+	v, exist := s.states.Load(jobId)
+	if !exist {
+		return "", false
+	}
+
+	return v.(JobState), true
+}
+
+// SetTaskState keeps status of task in memory, it is written along with the job on next flush
+func (s *fileStore) SetTaskState(jobId, taskId string, status api.TaskStatus) {
+	s.tasks.set(jobId, taskId, status)
+}
+
+func (s *fileStore) TaskStates(jobId string) map[string]api.TaskStatus {
+	return s.tasks.get(jobId)
+}
+
+func (s *fileStore) Range(fn func(job Job) bool) {
+	s.jobs.Range(func(_, v interface{}) bool {
+		return fn(v.(Job))
+	})
+}
+
+func (s *fileStore) Close() error {
+	close(s.stopCh)
+	s.wg.Wait()
+
+	s.flush()
+
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	return s.file.Close()
+}
+
+func (s *fileStore) persist(job Job) error {
+	p, ok := job.(Persistent)
+	if !ok {
+		// not persistent job only lives in memory
+		return nil
+	}
+
+	state, err := p.Snapshot()
+	if err != nil {
+		return errors.Wrap(err, "snapshot")
+	}
+
+	lifecycle, _ := s.State(job.Id())
+	tasks, tasksVersion := s.tasks.versioned(job.Id())
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	if bytes.Equal(s.lastState[job.Id()], state) && s.lastLifecycle[job.Id()] == lifecycle &&
+		s.lastTasks[job.Id()] == tasksVersion {
+		return nil
+	}
+
+	line, err := json.Marshal(&jobRecord{
+		Id:        job.Id(),
+		Kind:      p.Kind(),
+		Lifecycle: lifecycle,
+		UpdatedAt: time.Now().Unix(),
+		State:     state,
+		Tasks:     tasks,
+	})
+	if err != nil {
+		return errors.Wrap(err, "marshal record")
+	}
+
+	line = append(line, '\n')
+	if _, err = s.file.Write(line); err != nil {
+		return errors.Wrap(err, "write record")
+	}
+
+	s.lastState[job.Id()] = state
+	s.lastLifecycle[job.Id()] = lifecycle
+	s.lastTasks[job.Id()] = tasksVersion
+	s.keepLine(job.Id(), line)
+	s.size += int64(len(line))
+	if s.size > s.compactThreshold && s.size > 2*s.liveSize {
+		return errors.Wrap(s.compact(), "compact log")
+	}
+	return nil
+}
+
+// keepLine remembers the latest record of job, which survives compaction
+func (s *fileStore) keepLine(jobId string, line []byte) {
+	s.liveSize += int64(len(line) - len(s.lastLine[jobId]))
+	s.lastLine[jobId] = line
+}
+
+// compact replaces the log with the latest record of each job, caller should hold the lock
+func (s *fileStore) compact() error {
+	tmpPath := s.path + ".tmp"
+	tmp, err := os.OpenFile(tmpPath, os.O_CREATE|os.O_TRUNC|os.O_WRONLY, 0644)
+	if err != nil {
+		return errors.Wrap(err, "create compacted log")
+	}
+
+	w := bufio.NewWriter(tmp)
+	for _, line := range s.lastLine {
+		if _, err = w.Write(line); err != nil {
+			_ = tmp.Close()
+			return errors.Wrap(err, "write compacted log")
+		}
+	}
+	if err = w.Flush(); err == nil {
+		err = tmp.Sync()
+	}
+	if closeErr := tmp.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return errors.Wrap(err, "write compacted log")
+	}
+
+	if err = os.Rename(tmpPath, s.path); err != nil {
+		return errors.Wrap(err, "replace log")
+	}
+
+	// records appended later go to the compacted log
+	if s.file != nil {
+		_ = s.file.Close()
+	}
+	if s.file, err = os.OpenFile(s.path, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0644); err != nil {
+		return errors.Wrap(err, "open log")
+	}
+	s.size = s.liveSize
+	return nil
+}
+
+func (s *fileStore) flush() {
+	s.jobs.Range(func(_, v interface{}) bool {
+		job := v.(Job)
+		if err := s.persist(job); err != nil {
+			log.Errorf("persist job %s: %v", job.Id(), err)
+		}
+		return true
+	})
+
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	if err := s.file.Sync(); err != nil {
+		log.Errorf("sync job store: %v", err)
+	}
+}
+
+func (s *fileStore) flushLoop(interval time.Duration) {
+	defer s.wg.Done()
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-s.stopCh:
+			return
+		case <-ticker.C:
+			s.flush()
+		}
+	}
+}
+
+// reload read all records from log, restore jobs then compact the log with only latest records
+func (s *fileStore) reload() error {
+	records, err := readRecords(s.path)
+	if err != nil {
+		return err
+	}
+
+	for _, record := range records {
+		job, exist := newJobOfKind(record.Kind)
+		if !exist {
+			log.Warnf("Unknown job kind %s of job %s, skip restore", record.Kind, record.Id)
+			continue
+		}
+
+		if err = job.(Persistent).Restore(record.State); err != nil {
+			log.Errorf("restore job %s: %v", record.Id, err)
+			continue
+		}
+
+		// job not finished before restart is no longer running, it can be resumed later
+		if !record.Lifecycle.Terminal() {
+			record.Lifecycle = JobPaused
+		}
+
+		// tasks running before restart are lost along with the connections of their workers
+		for taskId, status := range record.Tasks {
+			if status == api.TaskStatus_Running {
+				record.Tasks[taskId] = api.TaskStatus_Interrupted
+			}
+			s.tasks.set(job.Id(), taskId, record.Tasks[taskId])
+		}
+
+		var line []byte
+		if line, err = json.Marshal(record); err != nil {
+			return errors.Wrap(err, "marshal record")
+		}
+
+		s.jobs.Store(job.Id(), job)
+		s.states.Store(job.Id(), record.Lifecycle)
+		s.lastState[job.Id()] = record.State
+		s.lastLifecycle[job.Id()] = record.Lifecycle
+		_, s.lastTasks[job.Id()] = s.tasks.versioned(job.Id())
+		s.keepLine(job.Id(), append(line, '\n'))
+	}
+
+	return s.compact()
+}
+
+func readRecords(path string) ([]*jobRecord, error) {
+	file, err := os.Open(path)
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, errors.Wrap(err, "open log")
+	}
+	defer file.Close()
+
+	latest := make(map[string]int)
+	records := make([]*jobRecord, 0)
+	scanner := bufio.NewScanner(file)
+	scanner.Buffer(make([]byte, 64*1024), 64*1024*1024)
+	for scanner.Scan() {
+		record := &jobRecord{}
+		if err = json.Unmarshal(scanner.Bytes(), record); err != nil {
+			// the last line may be partially written when crashed
+			log.Warnf("Broken job record skipped: %v", err)
+			continue
+		}
+
+		if idx, exist := latest[record.Id]; exist {
+			records[idx] = record
+			continue
+		}
+
+		latest[record.Id] = len(records)
+		records = append(records, record)
+	}
+
+	return records, errors.Wrap(scanner.Err(), "read log")
+}
+
+// NewFileStore open (or create) job store at given path, reload jobs in it, and snapshot live jobs with given interval
+func NewFileStore(path string, flushInterval time.Duration, opts ...FileStoreOption) (JobStore, error) {
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return nil, errors.Wrap(err, "create store dir")
+	}
+
+	s := &fileStore{
+		path:             path,
+		lastState:        make(map[string][]byte),
+		lastLifecycle:    make(map[string]JobState),
+		lastTasks:        make(map[string]int),
+		lastLine:         make(map[string][]byte),
+		compactThreshold: defaultCompactThreshold,
+		stopCh:           make(chan struct{}),
+	}
+
+	for _, opt := range opts {
+		opt(s)
+	}
+
+	if err := s.reload(); err != nil {
+		return nil, err
+	}
+
+	s.wg.Add(1)
+	go s.flushLoop(flushInterval)
+	return s, nil
+}
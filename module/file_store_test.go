@@ -0,0 +1,126 @@
+package module
+
+import (
+	"encoding/json"
+	. "github.com/TD-Hackathon-2022/DCoB-Scheduler/api"
+	. "github.com/smartystreets/goconvey/convey"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+type fakePersistentJob struct {
+	MockJob
+	Count int
+}
+
+func (f *fakePersistentJob) Kind() string {
+	return "fake-persistent"
+}
+
+func (f *fakePersistentJob) Snapshot() ([]byte, error) {
+	return json.Marshal(map[string]interface{}{"id": f.id, "count": f.Count})
+}
+
+func (f *fakePersistentJob) Restore(state []byte) error {
+	s := struct {
+		Id    string `json:"id"`
+		Count int    `json:"count"`
+	}{}
+	if err := json.Unmarshal(state, &s); err != nil {
+		return err
+	}
+
+	f.id = s.Id
+	f.Count = s.Count
+	return nil
+}
+
+func TestFileStore_ShouldReloadLatestJobStateAfterReopen(t *testing.T) {
+	RegisterJobKind("fake-persistent", func() Job { return &fakePersistentJob{} })
+
+	Convey("given file store with stored job", t, func() {
+		path := filepath.Join(t.TempDir(), "jobs.log")
+		store, err := NewFileStore(path, time.Hour)
+		So(err, ShouldBeNil)
+
+		job := &fakePersistentJob{MockJob: MockJob{id: "job0"}}
+		store.Store(job)
+		store.Store(&MockJob{id: "not-persistent"})
+
+		Convey("when job updated then store reopened", func() {
+			job.Count = 3
+			So(store.Close(), ShouldBeNil)
+
+			reopened, err := NewFileStore(path, time.Hour)
+			So(err, ShouldBeNil)
+			defer reopened.Close()
+
+			Convey("then latest job state restored", func() {
+				j, exist := reopened.Load("job0")
+				So(exist, ShouldBeTrue)
+				So(j.(*fakePersistentJob).Count, ShouldEqual, 3)
+
+				_, exist = reopened.Load("not-persistent")
+				So(exist, ShouldBeFalse)
+			})
+
+			Convey("then log compacted to one record per job", func() {
+				content, err := os.ReadFile(path)
+				So(err, ShouldBeNil)
+				So(strings.Count(string(content), "\n"), ShouldEqual, 1)
+			})
+		})
+	})
+}
+
+func TestFileStore_ShouldReloadTaskStatesAndCompactWhenGrown(t *testing.T) {
+	RegisterJobKind("fake-persistent", func() Job { return &fakePersistentJob{} })
+
+	Convey("given file store with small compact threshold", t, func() {
+		path := filepath.Join(t.TempDir(), "jobs.log")
+		store, err := NewFileStore(path, time.Hour, WithCompactThreshold(512))
+		So(err, ShouldBeNil)
+
+		job := &fakePersistentJob{MockJob: MockJob{id: "job0"}}
+		store.Store(job)
+		store.SetTaskState("job0", "task-1", TaskStatus_Finished)
+		store.SetTaskState("job0", "task-2", TaskStatus_Running)
+
+		Convey("when job updated many times", func() {
+			for i := 1; i <= 50; i++ {
+				job.Count = i
+				store.SetState("job0", JobRunning)
+			}
+
+			Convey("then log compacted without reopen", func() {
+				info, err := os.Stat(path)
+				So(err, ShouldBeNil)
+				So(info.Size(), ShouldBeLessThan, 1024)
+				So(store.Close(), ShouldBeNil)
+
+				reopened, err := NewFileStore(path, time.Hour)
+				So(err, ShouldBeNil)
+				defer reopened.Close()
+				j, _ := reopened.Load("job0")
+				So(j.(*fakePersistentJob).Count, ShouldEqual, 50)
+			})
+		})
+
+		Convey("when store reopened", func() {
+			So(store.Close(), ShouldBeNil)
+			reopened, err := NewFileStore(path, time.Hour)
+			So(err, ShouldBeNil)
+			defer reopened.Close()
+
+			Convey("then task states restored, running task regarded as interrupted", func() {
+				So(reopened.TaskStates("job0"), ShouldResemble, map[string]TaskStatus{
+					"task-1": TaskStatus_Finished,
+					"task-2": TaskStatus_Interrupted,
+				})
+			})
+		})
+	})
+}
@@ -0,0 +1,254 @@
+package module
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"github.com/pkg/errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	funcIndexFile = "index.json"
+	funcBlobDir   = "blobs"
+	funcIdSep     = "@"
+)
+
+var (
+	ErrFuncNotFound = errors.New("func not found")
+	ErrFuncConflict = errors.New("func version already registered with different code")
+	ErrInvalidFunc  = errors.New("invalid func")
+)
+
+var wasmMagic = []byte{0x00, 'a', 's', 'm'}
+
+// Function is an uploaded WASM module, identified by name@version, its code is stored by content hash
+type Function struct {
+	Id        string    `json:"id"`
+	Name      string    `json:"name"`
+	Version   string    `json:"version"`
+	Hash      string    `json:"hash"`
+	Size      int       `json:"size"`
+	CreatedAt time.Time `json:"createdAt"`
+}
+
+// FuncRegistry stores WASM modules under dir, the same code is stored once no matter how many versions refer to it
+type FuncRegistry struct {
+	dir    string
+	lock   sync.RWMutex
+	funcs  map[string]*Function
+	latest map[string]*Function
+	codes  map[string][]byte
+}
+
+func FuncId(name, version string) string {
+	return name + funcIdSep + version
+}
+
+// Register stores code as given version of func, registering the same code again is a no-op,
+// while versions are immutable once registered
+func (r *FuncRegistry) Register(name, version string, code []byte) (*Function, error) {
+	if name == "" || version == "" || strings.Contains(name, funcIdSep) {
+		return nil, errors.Wrapf(ErrInvalidFunc, "name: %q, version: %q", name, version)
+	}
+
+	if !bytes.HasPrefix(code, wasmMagic) {
+		return nil, errors.Wrap(ErrInvalidFunc, "not a WASM module")
+	}
+
+	sum := sha256.Sum256(code)
+	fn := &Function{
+		Id:        FuncId(name, version),
+		Name:      name,
+		Version:   version,
+		Hash:      hex.EncodeToString(sum[:]),
+		Size:      len(code),
+		CreatedAt: time.Now(),
+	}
+
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	if exist, ok := r.funcs[fn.Id]; ok {
+		if exist.Hash != fn.Hash {
+			return nil, errors.Wrapf(ErrFuncConflict, "func: %s", fn.Id)
+		}
+		return exist, nil
+	}
+
+	if err := r.writeBlob(fn.Hash, code); err != nil {
+		return nil, err
+	}
+
+	r.funcs[fn.Id] = fn
+	r.latest[fn.Name] = fn
+	if err := r.writeIndex(); err != nil {
+		delete(r.funcs, fn.Id)
+		r.rebuildLatest()
+		return nil, err
+	}
+
+	r.codes[fn.Hash] = code
+	return fn, nil
+}
+
+// Resolve finds func by id (name@version), or the latest registered version by bare name
+func (r *FuncRegistry) Resolve(funcId string) (*Function, bool) {
+	r.lock.RLock()
+	defer r.lock.RUnlock()
+	if fn, ok := r.funcs[funcId]; ok {
+		return fn, true
+	}
+
+	fn, ok := r.latest[funcId]
+	return fn, ok
+}
+
+// Load returns func with its code, code is read from disk only once
+func (r *FuncRegistry) Load(funcId string) (*Function, []byte, error) {
+	fn, ok := r.Resolve(funcId)
+	if !ok {
+		return nil, nil, errors.Wrapf(ErrFuncNotFound, "func: %s", funcId)
+	}
+
+	code, err := r.Code(fn.Hash)
+	if err != nil {
+		return nil, nil, err
+	}
+	return fn, code, nil
+}
+
+// Code returns code of given hash, which is what worker fetches when it has no such func cached
+func (r *FuncRegistry) Code(hash string) ([]byte, error) {
+	r.lock.RLock()
+	code, cached := r.codes[hash]
+	known := cached
+	for _, fn := range r.funcs {
+		if fn.Hash == hash {
+			known = true
+			break
+		}
+	}
+	r.lock.RUnlock()
+
+	if cached {
+		return code, nil
+	}
+
+	if !known {
+		return nil, errors.Wrapf(ErrFuncNotFound, "func hash: %s", hash)
+	}
+
+	code, err := ioutil.ReadFile(r.blobPath(hash))
+	if err != nil {
+		return nil, errors.Wrapf(err, "read code of func hash %s", hash)
+	}
+
+	if sum := sha256.Sum256(code); hex.EncodeToString(sum[:]) != hash {
+		return nil, errors.Errorf("code of func hash %s corrupted", hash)
+	}
+
+	r.lock.Lock()
+	r.codes[hash] = code
+	r.lock.Unlock()
+	return code, nil
+}
+
+func (r *FuncRegistry) List() []*Function {
+	r.lock.RLock()
+	defer r.lock.RUnlock()
+
+	funcs := make([]*Function, 0, len(r.funcs))
+	for _, fn := range r.funcs {
+		funcs = append(funcs, fn)
+	}
+
+	sort.Slice(funcs, func(a, b int) bool {
+		if funcs[a].Name != funcs[b].Name {
+			return funcs[a].Name < funcs[b].Name
+		}
+		return funcs[a].CreatedAt.Before(funcs[b].CreatedAt)
+	})
+	return funcs
+}
+
+func (r *FuncRegistry) blobPath(hash string) string {
+	return filepath.Join(r.dir, funcBlobDir, hash+".wasm")
+}
+
+func (r *FuncRegistry) writeBlob(hash string, code []byte) error {
+	path := r.blobPath(hash)
+	if _, err := os.Stat(path); err == nil {
+		return nil
+	}
+
+	return errors.Wrap(writeFileAtomic(path, code), "write func code")
+}
+
+func (r *FuncRegistry) writeIndex() error {
+	funcs := make([]*Function, 0, len(r.funcs))
+	for _, fn := range r.funcs {
+		funcs = append(funcs, fn)
+	}
+
+	data, err := json.Marshal(funcs)
+	if err != nil {
+		return errors.Wrap(err, "marshal func index")
+	}
+
+	return errors.Wrap(writeFileAtomic(filepath.Join(r.dir, funcIndexFile), data), "write func index")
+}
+
+func (r *FuncRegistry) rebuildLatest() {
+	r.latest = make(map[string]*Function)
+	for _, fn := range r.funcs {
+		if latest, ok := r.latest[fn.Name]; !ok || fn.CreatedAt.After(latest.CreatedAt) {
+			r.latest[fn.Name] = fn
+		}
+	}
+}
+
+func writeFileAtomic(path string, data []byte) error {
+	tmp := path + ".tmp"
+	if err := ioutil.WriteFile(tmp, data, 0644); err != nil {
+		return err
+	}
+	return os.Rename(tmp, path)
+}
+
+func NewFuncRegistry(dir string) (*FuncRegistry, error) {
+	if err := os.MkdirAll(filepath.Join(dir, funcBlobDir), 0755); err != nil {
+		return nil, errors.Wrap(err, "create func registry dir")
+	}
+
+	r := &FuncRegistry{
+		dir:   dir,
+		funcs: make(map[string]*Function),
+		codes: make(map[string][]byte),
+	}
+
+	data, err := ioutil.ReadFile(filepath.Join(dir, funcIndexFile))
+	if err != nil && !os.IsNotExist(err) {
+		return nil, errors.Wrap(err, "read func index")
+	}
+
+	if len(data) > 0 {
+		funcs := make([]*Function, 0)
+		if err := json.Unmarshal(data, &funcs); err != nil {
+			return nil, errors.Wrap(err, "unmarshal func index")
+		}
+
+		for _, fn := range funcs {
+			r.funcs[fn.Id] = fn
+		}
+	}
+
+	r.rebuildLatest()
+	return r, nil
+}
@@ -0,0 +1,103 @@
+package module
+
+import (
+	"github.com/pkg/errors"
+	. "github.com/smartystreets/goconvey/convey"
+	"io/ioutil"
+	"os"
+	"testing"
+)
+
+var fakeWasm = append([]byte{0x00, 'a', 's', 'm'}, 0x01, 0x00, 0x00, 0x00)
+
+func TestFuncRegistry_ShouldRegisterAndResolveFunc(t *testing.T) {
+	Convey("given func registry", t, func() {
+		dir, _ := ioutil.TempDir("", "func-registry")
+		defer os.RemoveAll(dir)
+		r, err := NewFuncRegistry(dir)
+		So(err, ShouldBeNil)
+
+		Convey("when register two versions of func", func() {
+			v1, err1 := r.Register("pi", "v1", fakeWasm)
+			v2, err2 := r.Register("pi", "v2", append(fakeWasm, 0x01))
+
+			Convey("then resolved by id or latest by name, and code loaded", func() {
+				So(err1, ShouldBeNil)
+				So(err2, ShouldBeNil)
+				So(v1.Id, ShouldEqual, "pi@v1")
+				So(v1.Hash, ShouldNotEqual, v2.Hash)
+
+				fn, _ := r.Resolve("pi@v1")
+				So(fn, ShouldEqual, v1)
+				fn, _ = r.Resolve("pi")
+				So(fn, ShouldEqual, v2)
+
+				_, code, err := r.Load("pi@v1")
+				So(err, ShouldBeNil)
+				So(code, ShouldResemble, fakeWasm)
+				So(len(r.List()), ShouldEqual, 2)
+			})
+		})
+
+		Convey("when register same version with different code", func() {
+			_, _ = r.Register("pi", "v1", fakeWasm)
+			_, errSame := r.Register("pi", "v1", fakeWasm)
+			_, errConflict := r.Register("pi", "v1", append(fakeWasm, 0x01))
+
+			Convey("then only different code conflicts", func() {
+				So(errSame, ShouldBeNil)
+				So(errors.Cause(errConflict), ShouldEqual, ErrFuncConflict)
+			})
+		})
+
+		Convey("when register code which is not WASM", func() {
+			_, err := r.Register("pi", "v1", []byte("function pi() {}"))
+
+			Convey("then rejected", func() {
+				So(errors.Cause(err), ShouldEqual, ErrInvalidFunc)
+			})
+		})
+	})
+}
+
+func TestFuncRegistry_ShouldReloadFuncsFromDir(t *testing.T) {
+	Convey("given func registered", t, func() {
+		dir, _ := ioutil.TempDir("", "func-registry")
+		defer os.RemoveAll(dir)
+		r, _ := NewFuncRegistry(dir)
+		fn, _ := r.Register("pi", "v1", fakeWasm)
+
+		Convey("when reopen registry", func() {
+			reopened, err := NewFuncRegistry(dir)
+
+			Convey("then func and its code restored", func() {
+				So(err, ShouldBeNil)
+				restored, code, err := reopened.Load("pi")
+				So(err, ShouldBeNil)
+				So(restored.Hash, ShouldEqual, fn.Hash)
+				So(code, ShouldResemble, fakeWasm)
+			})
+		})
+	})
+}
+
+func TestFuncRegistry_ShouldFetchCodeByHash(t *testing.T) {
+	Convey("given func registered", t, func() {
+		dir, _ := ioutil.TempDir("", "func-registry")
+		defer os.RemoveAll(dir)
+		r, _ := NewFuncRegistry(dir)
+		fn, _ := r.Register("pi", "v1", fakeWasm)
+		reopened, _ := NewFuncRegistry(dir)
+
+		Convey("when fetch code by hash", func() {
+			code, err := reopened.Code(fn.Hash)
+			_, errUnknown := reopened.Code("unknown-hash")
+
+			Convey("then code of known hash returned", func() {
+				So(err, ShouldBeNil)
+				So(code, ShouldResemble, fakeWasm)
+				So(errors.Cause(errUnknown), ShouldEqual, ErrFuncNotFound)
+			})
+		})
+	})
+}
@@ -1,6 +1,17 @@
 package module
 
-import "sync/atomic"
+import (
+	"context"
+	"github.com/TD-Hackathon-2022/DCoB-Scheduler/api"
+	"github.com/pkg/errors"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
+	"runtime"
+	"sort"
+	"sync"
+	"sync/atomic"
+	"time"
+)
 
 type Spliterator interface {
 	TryAdvance(func(task *Task)) (finished bool)
@@ -12,25 +23,123 @@ type Job interface {
 	GetResult() map[string]interface{}
 }
 
-var poisonTask = &Task{}
+var (
+	ErrJobNotFound      = errors.New("job not found")
+	ErrJobStateConflict = errors.New("job state conflict")
+)
+
+type JobInfo struct {
+	Id    string   `json:"id"`
+	Kind  string   `json:"kind,omitempty"`
+	State JobState `json:"state"`
+	// Tasks counts issued tasks by their latest status
+	Tasks map[string]int `json:"tasks,omitempty"`
+}
+
+// poison task tells decider to interrupt all running tasks of its job
+func newPoisonTask(jobId string) *Task {
+	return &Task{JobId: jobId, poison: true}
+}
+
+type jobControl struct {
+	job         Job
+	ctx         context.Context
+	interruptCh chan struct{}
+	updateCh    chan struct{}
+	reason      JobState
+	once        sync.Once
+	pauseLock   sync.Mutex
+	resumeCh    chan struct{}
+}
+
+func (c *jobControl) pause() (success bool) {
+	c.pauseLock.Lock()
+	defer c.pauseLock.Unlock()
+	if c.resumeCh != nil {
+		return false
+	}
+
+	c.resumeCh = make(chan struct{})
+	return true
+}
+
+func (c *jobControl) resume() (success bool) {
+	c.pauseLock.Lock()
+	defer c.pauseLock.Unlock()
+	if c.resumeCh == nil {
+		return false
+	}
+
+	close(c.resumeCh)
+	c.resumeCh = nil
+	return true
+}
+
+// pausedCh returns channel closed when job resumed, nil if job not paused
+func (c *jobControl) pausedCh() <-chan struct{} {
+	c.pauseLock.Lock()
+	defer c.pauseLock.Unlock()
+	return c.resumeCh
+}
+
+// interrupt stops the job, and it will end with given state
+func (c *jobControl) interrupt(reason JobState) {
+	c.once.Do(func() {
+		c.reason = reason
+		close(c.interruptCh)
+	})
+}
+
+// notifyUpdate wakes up draining job to check whether it is completed
+func (c *jobControl) notifyUpdate() {
+	select {
+	case c.updateCh <- struct{}{}:
+	default:
+	}
+}
 
 type JobRunner struct {
-	jobQ           chan Job
-	store          JobStore
-	currJob        Job
-	taskQ          chan<- *Task
-	interruptJobCh chan struct{}
-	stopCh         chan struct{}
-	stopped        uint32
+	jobQ    chan Job
+	store   JobStore
+	currJob Job
+	taskQ   chan<- *Task
+	lock    sync.RWMutex
+	running map[string]*jobControl
+	// stateLock makes job state transitions compare-and-set
+	stateLock sync.Mutex
+	wg        sync.WaitGroup
+	stopCh    chan struct{}
+	stopped   uint32
+	events    *EventHub
+	traces    sync.Map
+	// interrupt interrupts tasks of ended job out of band, poison task is sent through task q if nil
+	interrupt func(jobId string)
 }
 
 func (j *JobRunner) Submit(job Job) {
+	j.submit(job, "")
+}
+
+// submit queues job if it is in one of from states, empty state stands for new job
+func (j *JobRunner) submit(job Job, from ...JobState) (submitted bool) {
 	select {
 	case <-j.stopCh:
 		// return error if closed
-		return
+		return false
 	default:
+		if !j.transition(job, JobPending, from...) {
+			return false
+		}
+
+		// job span lasts until job ended, spans of its tasks are under it
+		ctx, _ := tracer.Start(context.Background(), "job", trace.WithAttributes(jobIdKey.String(job.Id())))
+		j.traces.Store(job.Id(), ctx)
+		_, span := tracer.Start(ctx, "job.submit")
+		defer span.End()
+
+		j.store.Store(job)
 		j.jobQ <- job
+		return true
 	}
 }
 
@@ -43,41 +152,402 @@ Exit:
 		case <-j.stopCh:
 			break Exit
 		case job := <-j.jobQ:
+			ctl := &jobControl{job: job, ctx: j.traceContext(job.Id()), interruptCh: make(chan struct{}), updateCh: make(chan struct{}, 1)}
+			j.lock.Lock()
 			j.currJob = job
-			j.store.Store(job)
-			for {
-				select {
-				case <-j.interruptJobCh:
-					poisonTask.JobId = j.currJob.Id()
-					j.taskQ <- poisonTask
-					continue Exit
-				default:
-				}
-
-				finished := j.currJob.TryAdvance(func(task *Task) { j.taskQ <- task })
-				if finished {
-					break
-				}
-			}
+			j.running[job.Id()] = ctl
+			j.lock.Unlock()
+
+			j.wg.Add(1)
+			go j.run(ctl)
 		}
 	}
 
+	j.wg.Wait()
 	atomic.StoreUint32(&j.stopped, 1)
 }
 
-func (j JobRunner) InterruptCurrentJob() {
-	j.interruptJobCh <- struct{}{}
+// run advances one job until it reach terminal state, tasks of all running jobs interleave onto task q
+func (j *JobRunner) run(ctl *jobControl) {
+	defer j.wg.Done()
+	defer func() {
+		j.lock.Lock()
+		delete(j.running, ctl.job.Id())
+		j.lock.Unlock()
+	}()
+
+	if d, ok := ctl.job.(Deadlined); ok && !d.Deadline().IsZero() {
+		timer := time.AfterFunc(time.Until(d.Deadline()), func() { ctl.interrupt(JobFailed) })
+		defer timer.Stop()
+	}
+
+	// job cancelled while waiting in job q never runs
+	if !j.transition(ctl.job, JobRunning, JobPending) {
+		state, _ := j.store.State(ctl.job.Id())
+		j.endTrace(ctl, state)
+		if state.Terminal() {
+			retireJobMetrics(ctl.job.Id())
+		}
+		log.Infof("Job %s is %s, skip running", ctl.job.Id(), state)
+		return
+	}
+
+	state := j.advance(ctl)
+	if !state.Terminal() {
+		// job paused right after all tasks issued has nothing to pause
+		j.transition(ctl.job, JobDraining, JobRunning, JobPaused)
+		state = j.drain(ctl)
+	}
+
+	// tasks still running are useless once job ended, interrupt them to free the workers,
+	// except job without completion semantics, whose issued tasks are still awaited
+	if _, ok := ctl.job.(Completable); ok || state != JobSucceeded {
+		j.interruptTasks(ctl.job.Id())
+	}
+	j.transition(ctl.job, state, JobPending, JobRunning, JobPaused, JobDraining)
+	j.endTrace(ctl, state)
+	retireJobMetrics(ctl.job.Id())
+	log.Infof("Job %s ended with state: %s", ctl.job.Id(), state)
 }
 
-func (j *JobRunner) ShutDown() {
-	close(j.stopCh)
+func (j *JobRunner) interruptTasks(jobId string) {
+	if j.interrupt != nil {
+		j.interrupt(jobId)
+		return
+	}
 
-	// if not stopped, always retry to interrupt current job
-	for atomic.LoadUint32(&j.stopped) == 0 {
+	select {
+	case j.taskQ <- newPoisonTask(jobId):
+	case <-j.stopCh:
+	}
+}
+
+// advance issues tasks until all tasks issued (return draining state) or job ended
+func (j *JobRunner) advance(ctl *jobControl) JobState {
+	prioritized, isPrioritized := ctl.job.(Prioritized)
+	verified, isVerified := ctl.job.(Verified)
+	advanceCtx := ctl.ctx
+	send := func(task *Task) {
+		if isPrioritized {
+			task.Priority = prioritized.Priority()
+			task.Weight = prioritized.Weight()
+		}
+
+		if isVerified {
+			if v := verified.Verification(); v.sampled() {
+				task.Replicas = v.Replicas
+				task.Quorum = v.quorum()
+			}
+		}
+
+		handler := task.UpdateHandler
+		task.UpdateHandler = func(t *Task) {
+			handler(t)
+			if t.Ctx != nil {
+				j.store.SetTaskState(ctl.job.Id(), t.Id, t.Ctx.Status)
+			}
+			if t.Ctx == nil || t.Ctx.Status != api.TaskStatus_Running {
+				t.endTrace()
+			}
+			ctl.notifyUpdate()
+			j.publishUpdate(ctl.job, t)
+		}
+
+		startTaskTrace(advanceCtx, task)
+		j.store.SetTaskState(ctl.job.Id(), task.Id, api.TaskStatus_Running)
 		select {
-		case j.interruptJobCh <- struct{}{}:
+		case j.taskQ <- task:
+		case <-ctl.interruptCh:
+			task.endTrace()
+		case <-j.stopCh:
+			task.endTrace()
+		}
+	}
+
+	for {
+		select {
+		case <-ctl.interruptCh:
+			return ctl.reason
+		case <-j.stopCh:
+			return JobCancelled
 		default:
 		}
+
+		if state, done := completedState(ctl.job); done {
+			return state
+		}
+
+		// paused job keeps its state, but no more task issued until resumed
+		if resumeCh := ctl.pausedCh(); resumeCh != nil {
+			select {
+			case <-resumeCh:
+			case <-ctl.interruptCh:
+				return ctl.reason
+			case <-j.stopCh:
+				return JobCancelled
+			}
+			continue
+		}
+
+		var span trace.Span
+		advanceCtx, span = tracer.Start(ctl.ctx, "job.advance")
+		finished := ctl.job.TryAdvance(send)
+		span.End()
+		if finished {
+			return JobDraining
+		}
+	}
+}
+
+// drain waits for results of issued tasks until job completed
+func (j *JobRunner) drain(ctl *jobControl) JobState {
+	if _, ok := ctl.job.(Completable); !ok {
+		return JobSucceeded
+	}
+
+	for {
+		if state, done := completedState(ctl.job); done {
+			return state
+		}
+
+		select {
+		case <-ctl.updateCh:
+		case <-ctl.interruptCh:
+			return ctl.reason
+		case <-j.stopCh:
+			return JobCancelled
+		}
+	}
+}
+
+// transition persists state of job and tells subscribers, only if job is in one of from states,
+// so that concurrent operations never bring ended job back or override each other
+func (j *JobRunner) transition(job Job, to JobState, from ...JobState) (transited bool) {
+	j.stateLock.Lock()
+	current, _ := j.store.State(job.Id())
+	if !containsState(from, current) {
+		j.stateLock.Unlock()
+		return false
+	}
+	j.store.SetState(job.Id(), to)
+	j.stateLock.Unlock()
+
+	if j.events.subscribed(job.Id()) {
+		j.events.Publish(NewJobEvent(job, to))
+	}
+	return true
+}
+
+// traceContext is the context of job span started on submit
+func (j *JobRunner) traceContext(jobId string) context.Context {
+	if ctx, ok := j.traces.Load(jobId); ok {
+		return ctx.(context.Context)
+	}
+	return context.Background()
+}
+
+func (j *JobRunner) endTrace(ctl *jobControl, state JobState) {
+	span := trace.SpanFromContext(ctl.ctx)
+	span.SetAttributes(jobStateKey.String(string(state)))
+	if state == JobFailed {
+		span.SetStatus(codes.Error, "job failed")
+	}
+	span.End()
+	j.traces.Delete(ctl.job.Id())
+}
+
+// publishUpdate tells subscribers the task status, and job result once task ended
+func (j *JobRunner) publishUpdate(job Job, task *Task) {
+	if !j.events.subscribed(job.Id()) {
+		return
+	}
+
+	j.events.Publish(newTaskEvent(task))
+	if task.Ctx.Status != api.TaskStatus_Running {
+		state, _ := j.store.State(job.Id())
+		j.events.Publish(NewJobEvent(job, state))
+	}
+}
+
+// Subscribe streams task status changes and job updates of job, cancel must be called once subscriber is gone
+func (j *JobRunner) Subscribe(jobId string) (events <-chan *Event, cancel func()) {
+	return j.events.Subscribe(jobId)
+}
+
+func completedState(job Job) (state JobState, done bool) {
+	c, ok := job.(Completable)
+	if !ok {
+		return "", false
+	}
+
+	done, err := c.Completed()
+	if !done {
+		return "", false
+	}
+
+	if err != nil {
+		log.Errorf("Job %s failed: %v", job.Id(), err)
+		return JobFailed, true
+	}
+
+	return JobSucceeded, true
+}
+
+func (j *JobRunner) InterruptCurrentJob() {
+	j.lock.RLock()
+	currJob := j.currJob
+	j.lock.RUnlock()
+
+	if currJob != nil {
+		j.InterruptJob(currJob.Id())
+	}
+}
+
+func (j *JobRunner) InterruptJob(jobId string) (interrupted bool) {
+	j.lock.RLock()
+	ctl, exist := j.running[jobId]
+	j.lock.RUnlock()
+
+	if !exist {
+		return false
+	}
+
+	ctl.interrupt(JobCancelled)
+	return true
+}
+
+func (j *JobRunner) runningControl(jobId string) (ctl *jobControl, exist bool) {
+	j.lock.RLock()
+	defer j.lock.RUnlock()
+	ctl, exist = j.running[jobId]
+	return
+}
+
+func (j *JobRunner) CancelJob(jobId string) error {
+	state, exist := j.store.State(jobId)
+	if !exist {
+		return ErrJobNotFound
+	}
+
+	if state.Terminal() {
+		return errors.Wrapf(ErrJobStateConflict, "job %s already %s", jobId, state)
+	}
+
+	if j.InterruptJob(jobId) {
+		return nil
+	}
+
+	// job not running, e.g. waiting in job q, or paused before restart
+	job, exist := j.store.Load(jobId)
+	if !exist {
+		return ErrJobNotFound
+	}
+
+	if !j.transition(job, JobCancelled, JobPending, JobPaused) {
+		// job started or ended meanwhile
+		if j.InterruptJob(jobId) {
+			return nil
+		}
+		state, _ = j.store.State(jobId)
+		return errors.Wrapf(ErrJobStateConflict, "job %s already %s", jobId, state)
+	}
+	return nil
+}
+
+func (j *JobRunner) PauseJob(jobId string) error {
+	state, exist := j.store.State(jobId)
+	if !exist {
+		return ErrJobNotFound
+	}
+
+	conflict := errors.Wrapf(ErrJobStateConflict, "job %s is %s, only running job can be paused", jobId, state)
+	ctl, running := j.runningControl(jobId)
+	if !running || !ctl.pause() {
+		return conflict
+	}
+
+	// job drained or ended meanwhile
+	if !j.transition(ctl.job, JobPaused, JobRunning) {
+		ctl.resume()
+		return conflict
+	}
+	return nil
+}
+
+func (j *JobRunner) ResumeJob(jobId string) error {
+	state, exist := j.store.State(jobId)
+	if !exist {
+		return ErrJobNotFound
+	}
+
+	conflict := errors.Wrapf(ErrJobStateConflict, "job %s is %s, only paused job can be resumed", jobId, state)
+	if state != JobPaused {
+		return conflict
+	}
+
+	ctl, running := j.runningControl(jobId)
+	if !running {
+		// job restored from store, run it again
+		job, exist := j.store.Load(jobId)
+		if !exist {
+			return ErrJobNotFound
+		}
+
+		if !j.submit(job, JobPaused) {
+			return conflict
+		}
+		return nil
+	}
+
+	if !j.transition(ctl.job, JobRunning, JobPaused) {
+		return conflict
+	}
+	ctl.resume()
+	return nil
+}
+
+// ListJobs returns all jobs in store, filtered by given states if any
+func (j *JobRunner) ListJobs(states ...JobState) []*JobInfo {
+	jobs := make([]*JobInfo, 0)
+	j.store.Range(func(job Job) bool {
+		state, _ := j.store.State(job.Id())
+		if len(states) > 0 && !containsState(states, state) {
+			return true
+		}
+
+		info := &JobInfo{Id: job.Id(), State: state}
+		if p, ok := job.(Persistent); ok {
+			info.Kind = p.Kind()
+		}
+		for _, status := range j.store.TaskStates(job.Id()) {
+			if info.Tasks == nil {
+				info.Tasks = make(map[string]int)
+			}
+			info.Tasks[status.String()]++
+		}
+		jobs = append(jobs, info)
+		return true
+	})
+
+	sort.Slice(jobs, func(a, b int) bool { return jobs[a].Id < jobs[b].Id })
+	return jobs
+}
+
+func containsState(states []JobState, state JobState) bool {
+	for _, s := range states {
+		if s == state {
+			return true
+		}
+	}
+	return false
+}
+
+func (j *JobRunner) ShutDown() {
+	close(j.stopCh)
+
+	// wait until all running jobs interrupted
+	for atomic.LoadUint32(&j.stopped) == 0 {
+		runtime.Gosched()
 	}
 }
 
@@ -89,12 +559,43 @@ func (j *JobRunner) GetJobById(jobId string) (job Job, exist bool) {
 	return v, true
 }
 
-func NewJobRunner(taskQ chan<- *Task, store JobStore) *JobRunner {
-	return &JobRunner{
-		jobQ:           make(chan Job, 16),
-		store:          store,
-		taskQ:          taskQ,
-		interruptJobCh: make(chan struct{}),
-		stopCh:         make(chan struct{}),
+func (j *JobRunner) GetJobState(jobId string) (state JobState, exist bool) {
+	return j.store.State(jobId)
+}
+
+const defaultJobQueueCapacity = 16
+
+type JobRunnerOption func(j *JobRunner)
+
+// WithJobQueueCapacity bounds jobs submitted but not yet started, submitting blocks once full
+func WithJobQueueCapacity(capacity int) JobRunnerOption {
+	return func(j *JobRunner) {
+		if capacity > 0 {
+			j.jobQ = make(chan Job, capacity)
+		}
+	}
+}
+
+// WithJobInterrupter interrupts tasks of ended job by calling interrupt, e.g. Decider.InterruptJob,
+// rather than sending poison task which waits behind queued tasks
+func WithJobInterrupter(interrupt func(jobId string)) JobRunnerOption {
+	return func(j *JobRunner) {
+		j.interrupt = interrupt
+	}
+}
+
+func NewJobRunner(taskQ chan<- *Task, store JobStore, opts ...JobRunnerOption) *JobRunner {
+	j := &JobRunner{
+		jobQ:    make(chan Job, defaultJobQueueCapacity),
+		store:   store,
+		taskQ:   taskQ,
+		running: make(map[string]*jobControl),
+		stopCh:  make(chan struct{}),
+		events:  NewEventHub(),
+	}
+
+	for _, opt := range opts {
+		opt(j)
 	}
+	return j
 }
@@ -0,0 +1,403 @@
+package job
+
+import (
+	"bytes"
+	"encoding/json"
+	"github.com/TD-Hackathon-2022/DCoB-Scheduler/api"
+	"github.com/TD-Hackathon-2022/DCoB-Scheduler/module"
+	"github.com/pkg/errors"
+	"math/rand"
+	"sort"
+	"strconv"
+	"sync"
+)
+
+const genericKind = "Generic"
+
+var ErrInvalidJobSpec = errors.New("invalid job spec")
+
+func init() {
+	module.RegisterJobKind(genericKind, func() module.Job {
+		return &GenericJob{jobAttr: newJobAttr(), done: make(map[int]bool), running: make(map[int]float32)}
+	})
+}
+
+// JobSpec defines a job without Go code: registered func runs once per input, results are folded by reducer
+type JobSpec struct {
+	Func    string    `json:"func"`
+	Inputs  InputSpec `json:"inputs"`
+	Reducer string    `json:"reducer"`
+}
+
+// InputSpec generates task inputs, exactly one of explicit values, integer range or parameter sweep should be given
+type InputSpec struct {
+	Values []json.RawMessage            `json:"values,omitempty"`
+	Range  *RangeSpec                   `json:"range,omitempty"`
+	Sweep  map[string][]json.RawMessage `json:"sweep,omitempty"`
+}
+
+// RangeSpec generates integers in [from, to) by step, step defaults to 1
+type RangeSpec struct {
+	From int64 `json:"from"`
+	To   int64 `json:"to"`
+	Step int64 `json:"step,omitempty"`
+}
+
+func (s *JobSpec) Validate() error {
+	if s.Func == "" {
+		return errors.Wrap(ErrInvalidJobSpec, "func required")
+	}
+
+	if _, err := newReducer(s.Reducer); err != nil {
+		return errors.Wrap(ErrInvalidJobSpec, err.Error())
+	}
+
+	return s.Inputs.validate()
+}
+
+func (s *InputSpec) validate() error {
+	given := 0
+	if s.Values != nil {
+		given++
+	}
+	if s.Range != nil {
+		given++
+	}
+	if s.Sweep != nil {
+		given++
+	}
+
+	if given != 1 {
+		return errors.Wrap(ErrInvalidJobSpec, "exactly one of values, range or sweep required")
+	}
+
+	if r := s.Range; r != nil && r.Step < 0 {
+		return errors.Wrapf(ErrInvalidJobSpec, "negative range step: %d", r.Step)
+	}
+
+	for param, values := range s.Sweep {
+		if len(values) == 0 {
+			return errors.Wrapf(ErrInvalidJobSpec, "no value to sweep of param: %s", param)
+		}
+	}
+
+	if s.count() == 0 {
+		return errors.Wrap(ErrInvalidJobSpec, "no input")
+	}
+	return nil
+}
+
+func (s *InputSpec) count() int {
+	switch {
+	case s.Values != nil:
+		return len(s.Values)
+	case s.Range != nil:
+		step := s.Range.step()
+		if s.Range.To <= s.Range.From {
+			return 0
+		}
+		return int((s.Range.To - s.Range.From + step - 1) / step)
+	default:
+		if len(s.Sweep) == 0 {
+			return 0
+		}
+
+		cnt := 1
+		for _, values := range s.Sweep {
+			cnt *= len(values)
+		}
+		return cnt
+	}
+}
+
+// input returns the index-th input as task init data, string values are passed as text, others as compact JSON
+func (s *InputSpec) input(index int) (module.Data, error) {
+	switch {
+	case s.Values != nil:
+		return rawInput(s.Values[index]), nil
+	case s.Range != nil:
+		return module.JSON(s.Range.From + int64(index)*s.Range.step())
+	default:
+		// cartesian product of sweep, the last param in name order varies fastest
+		params := make([]string, 0, len(s.Sweep))
+		for param := range s.Sweep {
+			params = append(params, param)
+		}
+		sort.Strings(params)
+
+		combination := make(map[string]json.RawMessage, len(params))
+		for i := len(params) - 1; i >= 0; i-- {
+			values := s.Sweep[params[i]]
+			combination[params[i]] = values[index%len(values)]
+			index /= len(values)
+		}
+
+		return module.JSON(combination)
+	}
+}
+
+func (r *RangeSpec) step() int64 {
+	if r.Step == 0 {
+		return 1
+	}
+	return r.Step
+}
+
+func rawInput(value json.RawMessage) module.Data {
+	var str string
+	if err := json.Unmarshal(value, &str); err == nil {
+		return module.Text(str)
+	}
+
+	compact := &bytes.Buffer{}
+	if err := json.Compact(compact, value); err != nil {
+		return module.Data{ContentType: api.ContentType_Json, Bytes: value}
+	}
+	return module.Data{ContentType: api.ContentType_Json, Bytes: compact.Bytes()}
+}
+
+// GenericJob issues a task per input of spec, each task is re-issued after restart until it reports back
+type GenericJob struct {
+	jobAttr
+	id          string
+	spec        *JobSpec
+	total       int
+	lock        sync.Mutex
+	next        int
+	watermark   int
+	done        map[int]bool
+	running     map[int]float32
+	finishedCnt uint64
+	failedCnt   uint64
+	reducer     module.Reducer
+}
+
+func (h *GenericJob) Id() string {
+	return h.id
+}
+
+func (h *GenericJob) Kind() string {
+	return genericKind
+}
+
+func (h *GenericJob) GetResult() map[string]interface{} {
+	h.lock.Lock()
+	defer h.lock.Unlock()
+	return map[string]interface{}{
+		"result":   h.reducer.Result(),
+		"total":    h.total,
+		"finished": h.finishedCnt,
+		"failed":   h.failedCnt,
+		"progress": h.progress(),
+	}
+}
+
+// Progress counts reported tasks as done, and running tasks by progress they reported
+func (h *GenericJob) Progress() float64 {
+	h.lock.Lock()
+	defer h.lock.Unlock()
+	return h.progress()
+}
+
+func (h *GenericJob) progress() float64 {
+	done := float64(h.finishedCnt + h.failedCnt)
+	for _, p := range h.running {
+		done += float64(p)
+	}
+	return done / float64(h.total)
+}
+
+type genericJobState struct {
+	Id          string          `json:"id"`
+	Spec        *JobSpec        `json:"spec"`
+	Watermark   int             `json:"watermark"`
+	Done        []int           `json:"done,omitempty"`
+	FinishedCnt uint64          `json:"finishedCnt"`
+	FailedCnt   uint64          `json:"failedCnt"`
+	Reducer     json.RawMessage `json:"reducer"`
+	Attr        *jobAttrState   `json:"attr,omitempty"`
+}
+
+func (h *GenericJob) Snapshot() ([]byte, error) {
+	h.lock.Lock()
+	defer h.lock.Unlock()
+
+	reducerState, err := h.reducer.Snapshot()
+	if err != nil {
+		return nil, err
+	}
+
+	done := make([]int, 0, len(h.done))
+	for index := range h.done {
+		done = append(done, index)
+	}
+	sort.Ints(done)
+
+	return json.Marshal(&genericJobState{
+		Id:          h.id,
+		Spec:        h.spec,
+		Watermark:   h.watermark,
+		Done:        done,
+		FinishedCnt: h.finishedCnt,
+		FailedCnt:   h.failedCnt,
+		Reducer:     reducerState,
+		Attr:        h.jobAttr.snapshot(),
+	})
+}
+
+// Restore resumes issuing from the first input not reported back, tasks running before restart are issued again
+func (h *GenericJob) Restore(state []byte) error {
+	s := &genericJobState{}
+	if err := json.Unmarshal(state, s); err != nil {
+		return err
+	}
+
+	if s.Spec == nil {
+		return errors.Wrap(ErrInvalidJobSpec, "no spec")
+	}
+
+	r, err := restoreReducer(s.Spec.Reducer, s.Reducer)
+	if err != nil {
+		return err
+	}
+
+	h.lock.Lock()
+	defer h.lock.Unlock()
+	h.jobAttr.restore(s.Attr)
+	h.id = s.Id
+	h.spec = s.Spec
+	h.total = s.Spec.Inputs.count()
+	h.watermark = s.Watermark
+	h.next = s.Watermark
+	h.running = make(map[int]float32)
+	h.done = make(map[int]bool, len(s.Done))
+	for _, index := range s.Done {
+		h.done[index] = true
+	}
+	h.finishedCnt = s.FinishedCnt
+	h.failedCnt = s.FailedCnt
+	h.reducer = r
+	return nil
+}
+
+func (h *GenericJob) TryAdvance(fn func(task *module.Task)) (finished bool) {
+	h.lock.Lock()
+	for h.next < h.total && h.done[h.next] {
+		h.next++
+	}
+
+	if h.next >= h.total {
+		h.lock.Unlock()
+		return true
+	}
+
+	index := h.next
+	h.next++
+	h.lock.Unlock()
+
+	input, err := h.spec.Inputs.input(index)
+	if err != nil {
+		log.Errorf("Generic job %s failed to generate input %d: %v", h.id, index, err)
+		h.report(index, func() error { return err })
+		return h.issuedAll()
+	}
+
+	task := &module.Task{
+		Id:    h.id + "-task-" + strconv.Itoa(index),
+		JobId: h.id,
+		Ctx: &module.Context{
+			InitData: input,
+		},
+		FuncId:        h.spec.Func,
+		MinCores:      h.minCores,
+		NeedsWasm:     true,
+		UpdateHandler: func(task *module.Task) { h.handleUpdate(index, task) },
+		LostHandler:   h.handleLost,
+		RetryPolicy:   h.retry,
+	}
+
+	fn(task)
+	return h.issuedAll()
+}
+
+// Completed once every input is reported back, job fails if any task failed since its result is partial
+func (h *GenericJob) Completed() (done bool, err error) {
+	h.lock.Lock()
+	defer h.lock.Unlock()
+	if h.watermark < h.total {
+		return false, nil
+	}
+
+	if h.failedCnt > 0 {
+		return true, errors.Errorf("%d of %d tasks failed", h.failedCnt, h.total)
+	}
+	return true, nil
+}
+
+func (h *GenericJob) issuedAll() bool {
+	h.lock.Lock()
+	defer h.lock.Unlock()
+	return h.next >= h.total
+}
+
+func (h *GenericJob) handleUpdate(index int, task *module.Task) {
+	switch task.Ctx.Status {
+	case api.TaskStatus_Running:
+		h.lock.Lock()
+		if index >= h.watermark && !h.done[index] {
+			h.running[index] = task.Ctx.Progress
+		}
+		h.lock.Unlock()
+	case api.TaskStatus_Finished:
+		h.report(index, func() error { return h.reducer.Add(index, task.Ctx.FinalData) })
+	case api.TaskStatus_Error, api.TaskStatus_Interrupted:
+		h.report(index, func() error { return errors.Errorf("task %s", task.Ctx.Status) })
+	}
+}
+
+// report marks input as done, task counts as failed if reduce returns error, duplicated report is ignored
+func (h *GenericJob) report(index int, reduce func() error) {
+	h.lock.Lock()
+	defer h.lock.Unlock()
+	if index < h.watermark || h.done[index] {
+		return
+	}
+
+	if err := reduce(); err != nil {
+		h.failedCnt++
+		log.Warnf("Generic job %s input %d failed: %v", h.id, index, err)
+	} else {
+		h.finishedCnt++
+	}
+
+	delete(h.running, index)
+	h.done[index] = true
+	for h.done[h.watermark] {
+		delete(h.done, h.watermark)
+		h.watermark++
+	}
+}
+
+func (h *GenericJob) handleLost(task *module.Task) {
+	log.Warnf("Generic job task lost: [%s]", task.Id)
+}
+
+// NewGenericJob validates spec and builds job of it, options like priority still apply, funcId option is ignored
+func NewGenericJob(spec *JobSpec, opts ...Option) (module.Job, error) {
+	if err := spec.Validate(); err != nil {
+		return nil, err
+	}
+
+	r, _ := newReducer(spec.Reducer)
+	h := &GenericJob{
+		jobAttr: newJobAttr(opts...),
+		spec:    spec,
+		total:   spec.Inputs.count(),
+		done:    make(map[int]bool),
+		running: make(map[int]float32),
+		reducer: r,
+	}
+
+	h.id = genericKind + "-" + strconv.Itoa(rand.Int())
+	return h, nil
+}
@@ -0,0 +1,179 @@
+package job
+
+import (
+	"encoding/json"
+	"github.com/TD-Hackathon-2022/DCoB-Scheduler/api"
+	"github.com/TD-Hackathon-2022/DCoB-Scheduler/module"
+	"github.com/pkg/errors"
+	. "github.com/smartystreets/goconvey/convey"
+	"testing"
+)
+
+func parseSpec(spec string) *JobSpec {
+	s := &JobSpec{}
+	if err := json.Unmarshal([]byte(spec), s); err != nil {
+		panic(err)
+	}
+	return s
+}
+
+func issueAll(j module.Job) []*module.Task {
+	tasks := make([]*module.Task, 0)
+	for !j.TryAdvance(func(task *module.Task) { tasks = append(tasks, task) }) {
+	}
+	return tasks
+}
+
+func finish(task *module.Task, result string) {
+	task.Ctx.Status = api.TaskStatus_Finished
+	task.Ctx.FinalData = module.Text(result)
+	task.UpdateHandler(task)
+}
+
+func TestGenericJob_ShouldGenerateInputs(t *testing.T) {
+	Convey("given specs of each input generator", t, func() {
+		values := parseSpec(`{"func": "f@v1", "reducer": "collect", "inputs": {"values": ["a", 1, {"k": 2}]}}`)
+		ranges := parseSpec(`{"func": "f@v1", "reducer": "sum", "inputs": {"range": {"from": 1, "to": 8, "step": 3}}}`)
+		sweep := parseSpec(`{"func": "f@v1", "reducer": "max", "inputs": {"sweep": {"b": [1, 2], "a": ["x", "y"]}}}`)
+
+		Convey("when issue all tasks", func() {
+			inputsOf := func(spec *JobSpec) []string {
+				j, err := NewGenericJob(spec)
+				So(err, ShouldBeNil)
+
+				inputs := make([]string, 0)
+				for _, task := range issueAll(j) {
+					So(task.FuncId, ShouldEqual, "f@v1")
+					So(task.NeedsWasm, ShouldBeTrue)
+					inputs = append(inputs, string(task.Ctx.InitData.Bytes))
+				}
+				return inputs
+			}
+
+			Convey("then inputs generated in order", func() {
+				So(inputsOf(values), ShouldResemble, []string{"a", "1", `{"k":2}`})
+				So(inputsOf(ranges), ShouldResemble, []string{"1", "4", "7"})
+				So(inputsOf(sweep), ShouldResemble, []string{
+					`{"a":"x","b":1}`, `{"a":"x","b":2}`, `{"a":"y","b":1}`, `{"a":"y","b":2}`,
+				})
+			})
+		})
+	})
+}
+
+func TestGenericJob_ShouldRejectInvalidSpec(t *testing.T) {
+	Convey("given invalid specs", t, func() {
+		specs := []string{
+			`{"reducer": "sum", "inputs": {"values": [1]}}`,
+			`{"func": "f", "reducer": "median", "inputs": {"values": [1]}}`,
+			`{"func": "f", "reducer": "sum", "inputs": {}}`,
+			`{"func": "f", "reducer": "sum", "inputs": {"values": [1], "range": {"from": 0, "to": 1}}}`,
+			`{"func": "f", "reducer": "sum", "inputs": {"range": {"from": 5, "to": 1}}}`,
+			`{"func": "f", "reducer": "sum", "inputs": {"sweep": {"a": []}}}`,
+		}
+
+		Convey("then job not created", func() {
+			for _, spec := range specs {
+				_, err := NewGenericJob(parseSpec(spec))
+				So(errors.Cause(err), ShouldEqual, ErrInvalidJobSpec)
+			}
+		})
+	})
+}
+
+func TestGenericJob_ShouldReduceResults(t *testing.T) {
+	Convey("given generic job of 3 inputs", t, func() {
+		results := []string{"2.5", "-1", "4"}
+		run := func(reducer string) (module.Job, []*module.Task) {
+			j, err := NewGenericJob(parseSpec(`{"func": "f", "reducer": "` + reducer + `", "inputs": {"range": {"from": 0, "to": 3}}}`))
+			So(err, ShouldBeNil)
+			return j, issueAll(j)
+		}
+
+		Convey("when tasks finish out of order", func() {
+			reduce := func(reducer string) interface{} {
+				j, tasks := run(reducer)
+				for _, i := range []int{2, 0, 1} {
+					done, _ := j.(module.Completable).Completed()
+					So(done, ShouldBeFalse)
+					finish(tasks[i], results[i])
+				}
+
+				done, err := j.(module.Completable).Completed()
+				So(done, ShouldBeTrue)
+				So(err, ShouldBeNil)
+				return j.GetResult()["result"]
+			}
+
+			Convey("then results reduced by reducer in input order", func() {
+				So(reduce(SumReducer), ShouldEqual, 5.5)
+				So(reduce(MinReducer), ShouldEqual, -1)
+				So(reduce(MaxReducer), ShouldEqual, 4)
+				So(reduce(ConcatReducer), ShouldEqual, "2.5-14")
+				So(reduce(CollectReducer), ShouldResemble, []interface{}{"2.5", "-1", "4"})
+			})
+		})
+
+		Convey("when tasks report progress", func() {
+			j, tasks := run(SumReducer)
+			finish(tasks[0], "1")
+			tasks[1].Ctx.Status = api.TaskStatus_Running
+			tasks[1].Ctx.Progress = 0.5
+			tasks[1].UpdateHandler(tasks[1])
+
+			Convey("then job progress counts partial progress of running tasks", func() {
+				So(j.GetResult()["progress"], ShouldAlmostEqual, 0.5)
+				So(j.(module.Progressive).Progress(), ShouldAlmostEqual, 0.5)
+			})
+		})
+
+		Convey("when a task fails", func() {
+			j, tasks := run(SumReducer)
+			finish(tasks[0], "1")
+			finish(tasks[1], "not a number")
+			tasks[2].Ctx.Status = api.TaskStatus_Error
+			tasks[2].UpdateHandler(tasks[2])
+
+			Convey("then job completes with error", func() {
+				done, err := j.(module.Completable).Completed()
+				So(done, ShouldBeTrue)
+				So(err, ShouldNotBeNil)
+				So(j.GetResult()["failed"], ShouldEqual, 2)
+				So(j.GetResult()["result"], ShouldEqual, 1)
+			})
+		})
+	})
+}
+
+func TestGenericJob_ShouldReissueUnreportedTasksAfterRestore(t *testing.T) {
+	Convey("given generic job with input 0 and 2 reported", t, func() {
+		j, err := NewGenericJob(parseSpec(`{"func": "f", "reducer": "collect", "inputs": {"values": ["a", "b", "c", "d"]}}`))
+		So(err, ShouldBeNil)
+		tasks := issueAll(j)
+		finish(tasks[0], "A")
+		finish(tasks[2], "C")
+
+		Convey("when restored from snapshot", func() {
+			state, err := j.(module.Persistent).Snapshot()
+			So(err, ShouldBeNil)
+
+			restored := &GenericJob{}
+			So(restored.Restore(state), ShouldBeNil)
+			reissued := issueAll(restored)
+
+			Convey("then only unreported inputs issued again", func() {
+				So(restored.Id(), ShouldEqual, j.Id())
+				So(len(reissued), ShouldEqual, 2)
+				So(reissued[0].Ctx.InitData, ShouldResemble, module.Text("b"))
+				So(reissued[1].Ctx.InitData, ShouldResemble, module.Text("d"))
+
+				finish(reissued[1], "D")
+				finish(reissued[0], "B")
+				done, err := restored.Completed()
+				So(done, ShouldBeTrue)
+				So(err, ShouldBeNil)
+				So(restored.GetResult()["result"], ShouldResemble, []interface{}{"A", "B", "C", "D"})
+			})
+		})
+	})
+}
@@ -1,25 +1,88 @@
 package job
 
 import (
-	"encoding/base64"
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
 	"github.com/TD-Hackathon-2022/DCoB-Scheduler/api"
 	"github.com/TD-Hackathon-2022/DCoB-Scheduler/comm"
 	"github.com/TD-Hackathon-2022/DCoB-Scheduler/module"
+	"github.com/pkg/errors"
+	"math"
+	"math/bits"
 	"math/rand"
 	"strconv"
-	"sync"
 	"sync/atomic"
 )
 
 var log = comm.GetLogger()
 
+const hashMinerKind = "HashMiner"
+
+func init() {
+	module.RegisterJobKind(hashMinerKind, func() module.Job {
+		return &HashMiner{jobAttr: newJobAttr(), hashes: newHashReducer(0)}
+	})
+}
+
 type HashMiner struct {
+	jobAttr
 	id         string
 	taskCnt    uint64
+	failedCnt  uint64
 	funcId     string
 	difficulty int
-	resultLock sync.Mutex
-	resultMap  map[string]string
+	hashes     *module.FirstNReducer
+}
+
+// decodeHash decodes hash reported by worker into hex
+func decodeHash(data module.Data) (interface{}, error) {
+	b, err := module.DecodeBytes(data)
+	if err != nil {
+		return nil, err
+	}
+	return hex.EncodeToString(b.([]byte)), nil
+}
+
+// verifyProof checks proof reported by worker: preimage followed by its sha256 digest, which should start with
+// difficulty bits of zero
+func verifyProof(data module.Data, difficulty int) error {
+	b, err := module.DecodeBytes(data)
+	if err != nil {
+		return err
+	}
+
+	proof := b.([]byte)
+	if len(proof) <= sha256.Size {
+		return errors.Errorf("proof too short: %d bytes", len(proof))
+	}
+
+	preimage, digest := proof[:len(proof)-sha256.Size], proof[len(proof)-sha256.Size:]
+	if sum := sha256.Sum256(preimage); !bytes.Equal(sum[:], digest) {
+		return errors.Errorf("digest mismatch, expected: %x", sum)
+	}
+
+	if zeros := leadingZeroBits(digest); zeros < difficulty {
+		return errors.Errorf("digest has %d leading zero bits, difficulty: %d", zeros, difficulty)
+	}
+	return nil
+}
+
+func leadingZeroBits(b []byte) int {
+	zeros := 0
+	for _, x := range b {
+		if x != 0 {
+			return zeros + bits.LeadingZeros8(x)
+		}
+		zeros += 8
+	}
+	return zeros
+}
+
+// newHashReducer keeps hashes found until target reached, all of them if no target
+func newHashReducer(target float64) *module.FirstNReducer {
+	return module.NewFirstNReducer(int(math.Ceil(target)), decodeHash)
 }
 
 func (h *HashMiner) Id() string {
@@ -27,49 +90,170 @@ func (h *HashMiner) Id() string {
 }
 
 func (h *HashMiner) GetResult() map[string]interface{} {
-	res := make(map[string]interface{})
-	h.resultLock.Lock()
-	defer h.resultLock.Unlock()
-	for k, v := range h.resultMap {
-		res[k] = v
+	return map[string]interface{}{"hashes": h.hashes.Result()}
+}
+
+// HashCount is the number of hashes found so far
+func (h *HashMiner) HashCount() int {
+	return h.hashes.Len()
+}
+
+type hashMinerState struct {
+	Id         string          `json:"id"`
+	TaskCnt    uint64          `json:"taskCnt"`
+	FailedCnt  uint64          `json:"failedCnt"`
+	FuncId     string          `json:"funcId"`
+	Difficulty int             `json:"difficulty"`
+	Target     float64         `json:"target,omitempty"`
+	Hashes     json.RawMessage `json:"hashes"`
+	Attr       *jobAttrState   `json:"attr,omitempty"`
+}
+
+func (h *HashMiner) Kind() string {
+	return hashMinerKind
+}
+
+func (h *HashMiner) Snapshot() ([]byte, error) {
+	hashes, err := h.hashes.Snapshot()
+	if err != nil {
+		return nil, err
 	}
 
-	return res
+	return json.Marshal(&hashMinerState{
+		Id:         h.id,
+		TaskCnt:    atomic.LoadUint64(&h.taskCnt),
+		FailedCnt:  atomic.LoadUint64(&h.failedCnt),
+		FuncId:     h.funcId,
+		Difficulty: h.difficulty,
+		Target:     h.target,
+		Hashes:     hashes,
+		Attr:       h.jobAttr.snapshot(),
+	})
+}
+
+// Restore regards tasks running before restart as failed, since their results will never be reported
+func (h *HashMiner) Restore(state []byte) error {
+	s := &hashMinerState{}
+	if err := json.Unmarshal(state, s); err != nil {
+		return err
+	}
+
+	hashes := newHashReducer(s.Target)
+	if len(s.Hashes) > 0 {
+		if err := hashes.Restore(s.Hashes); err != nil {
+			return err
+		}
+	}
+
+	h.jobAttr.restore(s.Attr)
+	h.id = s.Id
+	h.taskCnt = s.TaskCnt
+	h.failedCnt = s.FailedCnt
+	if reported := uint64(hashes.Len()) + s.FailedCnt; reported < s.TaskCnt {
+		h.failedCnt = s.TaskCnt - uint64(hashes.Len())
+	}
+	h.funcId = s.FuncId
+	h.difficulty = s.Difficulty
+	h.target = s.Target
+	h.hashes = hashes
+	return nil
 }
 
 func (h *HashMiner) TryAdvance(fn func(task *module.Task)) (finished bool) {
+	if h.issuedAll() {
+		return true
+	}
+
+	index := atomic.AddUint64(&h.taskCnt, 1)
 	task := &module.Task{
-		Id:    h.id + "-task-" + strconv.FormatUint(atomic.AddUint64(&h.taskCnt, 1), 10),
+		Id:    h.id + "-task-" + strconv.FormatUint(index, 10),
 		JobId: h.id,
 		Ctx: &module.Context{
-			InitData: strconv.Itoa(h.difficulty),
+			InitData: module.Text(strconv.Itoa(h.difficulty)),
 		},
 		FuncId:        h.funcId,
-		UpdateHandler: h.handleUpdate,
+		MinCores:      h.minCores,
+		UpdateHandler: func(task *module.Task) { h.handleUpdate(int(index), task) },
+		LostHandler:   h.handleLost,
+		RetryPolicy:   h.retry,
+	}
+	if h.proofCheck {
+		task.Verify = h.verify
 	}
 
 	fn(task)
-	return false
+	return h.issuedAll()
 }
 
-func (h *HashMiner) handleUpdate(task *module.Task) {
-	if task.Ctx.Status == api.TaskStatus_Finished {
-		h.resultLock.Lock()
-		defer h.resultLock.Unlock()
-		finalData := task.Ctx.FinalData.(string)
-		h.resultMap[task.Id] = finalData
-		result, _ := base64.StdEncoding.DecodeString(finalData)
-		log.Infof("Miner received result: [%s] : %x", task.Id, result)
+func (h *HashMiner) Completed() (done bool, err error) {
+	if h.targetReached() {
+		return true, nil
 	}
+
+	if h.maxTasks == 0 {
+		return false, nil
+	}
+
+	reported := uint64(h.hashes.Len()) + atomic.LoadUint64(&h.failedCnt)
+	if reported < h.maxTasks {
+		return false, nil
+	}
+
+	if h.target > 0 {
+		return true, errors.Errorf("only %d of %d hashes found", h.hashes.Len(), int(h.target))
+	}
+	return true, nil
+}
+
+func (h *HashMiner) issuedAll() bool {
+	return (h.maxTasks > 0 && atomic.LoadUint64(&h.taskCnt) >= h.maxTasks) || h.targetReached()
+}
+
+// Progress is share of target hashes found, or share of max tasks reported if no target
+func (h *HashMiner) Progress() float64 {
+	if h.target > 0 {
+		return math.Min(float64(h.hashes.Len())/h.target, 1)
+	}
+	if h.maxTasks > 0 {
+		return math.Min(float64(uint64(h.hashes.Len())+atomic.LoadUint64(&h.failedCnt))/float64(h.maxTasks), 1)
+	}
+	return 0
+}
+
+func (h *HashMiner) targetReached() bool {
+	return h.target > 0 && h.hashes.Full()
+}
+
+func (h *HashMiner) handleUpdate(index int, task *module.Task) {
+	switch task.Ctx.Status {
+	case api.TaskStatus_Finished:
+		if err := h.hashes.Add(index, task.Ctx.FinalData); err != nil {
+			atomic.AddUint64(&h.failedCnt, 1)
+			log.Warnf("Miner received bad result: [%s] : %v", task.Id, err)
+			return
+		}
+		log.Infof("Miner received result: [%s] : %v", task.Id, task.Ctx.FinalData)
+	case api.TaskStatus_Error, api.TaskStatus_Interrupted:
+		atomic.AddUint64(&h.failedCnt, 1)
+	}
+}
+
+func (h *HashMiner) verify(task *module.Task) error {
+	return verifyProof(task.Ctx.FinalData, h.difficulty)
+}
+
+func (h *HashMiner) handleLost(task *module.Task) {
+	log.Warnf("Miner task lost: [%s]", task.Id)
 }
 
-func NewHashMiner(difficulty int) module.Job {
+func NewHashMiner(difficulty int, opts ...Option) module.Job {
 	h := &HashMiner{
+		jobAttr:    newJobAttr(opts...),
 		funcId:     "hash-miner",
 		difficulty: difficulty,
-		resultMap:  make(map[string]string),
 	}
+	h.hashes = newHashReducer(h.target)
 
-	h.id = "HashMiner-" + strconv.Itoa(rand.Int())
+	h.id = hashMinerKind + "-" + strconv.Itoa(rand.Int())
 	return h
 }
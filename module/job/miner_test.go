@@ -6,6 +6,14 @@ import (
 	. "github.com/smartystreets/goconvey/convey"
 	"strings"
 	"testing"
+	"time"
+)
+
+// fakeHash is proof of difficulty 2 base64 encoded as reported by worker: "blockChain0" followed by its sha256,
+// fakeHashHex is how it appears in result
+const (
+	fakeHash    = "YmxvY2tDaGFpbjAt+V7q413KTVusz9LJyzjuaVxKmjEbCkNtg0dcEgr9iw=="
+	fakeHashHex = "626c6f636b436861696e302df95eeae35dca4d5baccfd2c9cb38ee695c4a9a311b0a436d83475c120afd8b"
 )
 
 func TestHashMiner_ShouldCreateTaskAndOutputResult(t *testing.T) {
@@ -24,7 +32,7 @@ func TestHashMiner_ShouldCreateTaskAndOutputResult(t *testing.T) {
 			// finish task
 			for _, task := range tasks {
 				task.Ctx.Status = api.TaskStatus_Finished
-				task.Ctx.FinalData = "006c6f636b436861696ee3b0c44298fc1c149afbf4c8996fb92427ae41e4649b934ca495991b7852b855"
+				task.Ctx.FinalData = module.Text(fakeHash)
 				task.UpdateHandler(task)
 			}
 
@@ -32,10 +40,148 @@ func TestHashMiner_ShouldCreateTaskAndOutputResult(t *testing.T) {
 				So(strings.Contains(tasks[0].Id, "-task-1"), ShouldBeTrue)
 				So(strings.Contains(tasks[1].Id, "-task-2"), ShouldBeTrue)
 
-				res := miner.GetResult()
-				So(res[tasks[0].Id], ShouldEqual, "006c6f636b436861696ee3b0c44298fc1c149afbf4c8996fb92427ae41e4649b934ca495991b7852b855")
-				So(res[tasks[1].Id], ShouldEqual, "006c6f636b436861696ee3b0c44298fc1c149afbf4c8996fb92427ae41e4649b934ca495991b7852b855")
-				So(len(res), ShouldEqual, 2)
+				hashes := miner.GetResult()["hashes"].([]module.Entry)
+				So(hashes, ShouldResemble, []module.Entry{{Index: 1, Value: fakeHashHex}, {Index: 2, Value: fakeHashHex}})
+			})
+		})
+	})
+}
+
+func TestHashMiner_ShouldRestoreFromSnapshot(t *testing.T) {
+	Convey("given bounded hash miner with result and a task still running", t, func() {
+		deadline := time.Now().Add(time.Hour).UTC().Round(0)
+		miner := NewHashMiner(2, WithMaxTasks(2), WithTarget(2), WithDeadline(deadline), WithPriority(5),
+			WithVerification(0.5, 3, 2), WithProofCheck()).(*HashMiner)
+		miner.TryAdvance(func(task *module.Task) {
+			task.Ctx.Status = api.TaskStatus_Finished
+			task.Ctx.FinalData = module.Text(fakeHash)
+			task.UpdateHandler(task)
+		})
+		miner.TryAdvance(func(*module.Task) {})
+
+		Convey("when snapshot then restore", func() {
+			state, err := miner.Snapshot()
+			So(err, ShouldBeNil)
+
+			restored := &HashMiner{}
+			err = restored.Restore(state)
+			So(err, ShouldBeNil)
+
+			Convey("then get same job", func() {
+				So(restored.Id(), ShouldEqual, miner.Id())
+				So(restored.difficulty, ShouldEqual, 2)
+				So(restored.taskCnt, ShouldEqual, 2)
+				So(restored.GetResult(), ShouldResemble, miner.GetResult())
+				So(restored.jobAttr, ShouldResemble, miner.jobAttr)
+			})
+
+			Convey("then task running before restart regarded as failed", func() {
+				So(restored.failedCnt, ShouldEqual, 1)
+				So(restored.TryAdvance(func(*module.Task) {}), ShouldBeTrue)
+				done, err := restored.Completed()
+				So(done, ShouldBeTrue)
+				So(err, ShouldNotBeNil)
+			})
+		})
+	})
+}
+
+func TestHashMiner_ShouldCompleteWhenTargetReached(t *testing.T) {
+	Convey("given hash miner with target and max tasks", t, func() {
+		miner := NewHashMiner(2, WithTarget(1), WithMaxTasks(3)).(*HashMiner)
+		tasks := make([]*module.Task, 0, 3)
+		fn := func(task *module.Task) {
+			tasks = append(tasks, task)
+		}
+
+		Convey("when one hash found", func() {
+			issuedAll := miner.TryAdvance(fn)
+			doneBefore, _ := miner.Completed()
+			tasks[0].Ctx.Status = api.TaskStatus_Finished
+			tasks[0].Ctx.FinalData = module.Text(fakeHash)
+			tasks[0].UpdateHandler(tasks[0])
+
+			Convey("then job completed and stops issuing tasks", func() {
+				done, err := miner.Completed()
+				So(issuedAll, ShouldBeFalse)
+				So(doneBefore, ShouldBeFalse)
+				So(done, ShouldBeTrue)
+				So(err, ShouldBeNil)
+				So(miner.TryAdvance(fn), ShouldBeTrue)
+				So(len(tasks), ShouldEqual, 1)
+			})
+		})
+
+		Convey("when all tasks failed", func() {
+			for !miner.TryAdvance(fn) {
+			}
+			for _, task := range tasks {
+				task.Ctx.Status = api.TaskStatus_Error
+				task.UpdateHandler(task)
+			}
+
+			Convey("then job completed with error", func() {
+				done, err := miner.Completed()
+				So(len(tasks), ShouldEqual, 3)
+				So(done, ShouldBeTrue)
+				So(err, ShouldNotBeNil)
+			})
+		})
+	})
+}
+
+func TestHashMiner_ShouldVerifyProof(t *testing.T) {
+	Convey("given task of hash miner without proof check", t, func() {
+		var task *module.Task
+		NewHashMiner(2).TryAdvance(func(t *module.Task) {
+			task = t
+		})
+
+		Convey("then result is not verified, since baseline workers report digest only", func() {
+			So(task.Verify, ShouldBeNil)
+		})
+	})
+
+	Convey("given task of hash miner with proof check", t, func() {
+		var task *module.Task
+		NewHashMiner(2, WithProofCheck()).TryAdvance(func(t *module.Task) {
+			task = t
+		})
+		task.Ctx.Status = api.TaskStatus_Finished
+
+		Convey("when proof is valid", func() {
+			task.Ctx.FinalData = module.Text(fakeHash)
+
+			Convey("then accepted", func() {
+				So(task.Verify(task), ShouldBeNil)
+			})
+		})
+
+		Convey("when digest is not sha256 of preimage", func() {
+			task.Ctx.FinalData = module.Text("AGxvY2tDaGFpbuOwxEKY/BwUmvv0yJlvuSQnrkHkZJuTTKSVmRt4UrhV")
+
+			Convey("then rejected", func() {
+				So(task.Verify(task), ShouldNotBeNil)
+			})
+		})
+
+		Convey("when digest has not enough leading zeros", func() {
+			miner := NewHashMiner(3, WithProofCheck())
+			miner.TryAdvance(func(t *module.Task) {
+				task = t
+			})
+			task.Ctx.FinalData = module.Text(fakeHash)
+
+			Convey("then rejected", func() {
+				So(task.Verify(task), ShouldNotBeNil)
+			})
+		})
+
+		Convey("when proof has no preimage", func() {
+			task.Ctx.FinalData = module.Text("47DEQpj8HBSa+/TImW+5JCeuQeRkm5NMpJWZG3hSuFU=")
+
+			Convey("then rejected", func() {
+				So(task.Verify(task), ShouldNotBeNil)
 			})
 		})
 	})
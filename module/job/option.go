@@ -0,0 +1,170 @@
+package job
+
+import (
+	"github.com/TD-Hackathon-2022/DCoB-Scheduler/module"
+	"time"
+)
+
+type jobAttr struct {
+	priority int
+	weight   int
+	maxTasks uint64
+	target   float64
+	deadline time.Time
+	minCores int
+	funcId   string
+	retry    *module.RetryPolicy
+	verify   *module.Verification
+	// proofCheck rejects result which is not a valid proof, e.g. preimage followed by digest for HashMiner,
+	// or number of points in circle too unlikely for built-in func of CalPi
+	proofCheck bool
+}
+
+func (a *jobAttr) Priority() int {
+	return a.priority
+}
+
+func (a *jobAttr) Weight() int {
+	return a.weight
+}
+
+func (a *jobAttr) Deadline() time.Time {
+	return a.deadline
+}
+
+func (a *jobAttr) Verification() *module.Verification {
+	return a.verify
+}
+
+// jobAttrState is how jobAttr is saved in snapshot of job, so that restored job keeps its bounds and policies
+type jobAttrState struct {
+	Priority     int                  `json:"priority,omitempty"`
+	Weight       int                  `json:"weight,omitempty"`
+	MaxTasks     uint64               `json:"maxTasks,omitempty"`
+	Target       float64              `json:"target,omitempty"`
+	Deadline     *time.Time           `json:"deadline,omitempty"`
+	MinCores     int                  `json:"minCores,omitempty"`
+	FuncId       string               `json:"funcId,omitempty"`
+	Retry        *module.RetryPolicy  `json:"retry,omitempty"`
+	Verification *module.Verification `json:"verification,omitempty"`
+	ProofCheck   bool                 `json:"proofCheck,omitempty"`
+}
+
+func (a *jobAttr) snapshot() *jobAttrState {
+	s := &jobAttrState{
+		Priority:     a.priority,
+		Weight:       a.weight,
+		MaxTasks:     a.maxTasks,
+		Target:       a.target,
+		MinCores:     a.minCores,
+		FuncId:       a.funcId,
+		Retry:        a.retry,
+		Verification: a.verify,
+		ProofCheck:   a.proofCheck,
+	}
+	if !a.deadline.IsZero() {
+		s.Deadline = &a.deadline
+	}
+	return s
+}
+
+// restore overrides attributes by saved ones, snapshot saved without attributes keeps the defaults
+func (a *jobAttr) restore(s *jobAttrState) {
+	if s == nil {
+		return
+	}
+
+	*a = newJobAttr(WithPriority(s.Priority), WithWeight(s.Weight), WithMaxTasks(s.MaxTasks), WithTarget(s.Target),
+		WithMinCores(s.MinCores), WithFunc(s.FuncId), WithRetryPolicy(s.Retry))
+	if s.Deadline != nil {
+		a.deadline = *s.Deadline
+	}
+	a.verify = s.Verification
+	a.proofCheck = s.ProofCheck
+}
+
+type Option func(a *jobAttr)
+
+func WithPriority(priority int) Option {
+	return func(a *jobAttr) {
+		a.priority = priority
+	}
+}
+
+func WithWeight(weight int) Option {
+	return func(a *jobAttr) {
+		if weight > 0 {
+			a.weight = weight
+		}
+	}
+}
+
+// WithMaxTasks bounds the total number of tasks issued by job
+func WithMaxTasks(maxTasks uint64) Option {
+	return func(a *jobAttr) {
+		a.maxTasks = maxTasks
+	}
+}
+
+// WithTarget sets the goal of job: number of hashes found for HashMiner, precision of pi for CalPi
+func WithTarget(target float64) Option {
+	return func(a *jobAttr) {
+		a.target = target
+	}
+}
+
+func WithDeadline(deadline time.Time) Option {
+	return func(a *jobAttr) {
+		a.deadline = deadline
+	}
+}
+
+// WithMinCores only places tasks of job on workers advertised at least given cores
+func WithMinCores(cores int) Option {
+	return func(a *jobAttr) {
+		a.minCores = cores
+	}
+}
+
+// WithFunc runs tasks of job with given func, e.g. a WASM func uploaded to registry referred by name@version
+func WithFunc(funcId string) Option {
+	return func(a *jobAttr) {
+		a.funcId = funcId
+	}
+}
+
+// WithRetryPolicy retries failed tasks of job by given policy instead of the default one
+func WithRetryPolicy(policy *module.RetryPolicy) Option {
+	return func(a *jobAttr) {
+		if policy != nil {
+			a.retry = policy
+		}
+	}
+}
+
+// WithVerification runs given share of tasks on replicas distinct workers, result is accepted once quorum of them
+// agree, quorum 0 means majority
+func WithVerification(share float64, replicas, quorum int) Option {
+	return func(a *jobAttr) {
+		if share > 0 && replicas > 1 {
+			a.verify = &module.Verification{Share: share, Replicas: replicas, Quorum: quorum}
+		}
+	}
+}
+
+// WithProofCheck rejects result which is not a valid proof, only for workers report proofs, e.g. preimage followed by
+// digest of HashMiner, otherwise every result is rejected and its worker penalized, CalPi of built-in func rejects
+// number of points too unlikely for its sample count
+func WithProofCheck() Option {
+	return func(a *jobAttr) {
+		a.proofCheck = true
+	}
+}
+
+func newJobAttr(opts ...Option) jobAttr {
+	a := jobAttr{weight: 1, retry: module.DefaultRetryPolicy()}
+	for _, opt := range opts {
+		opt(&a)
+	}
+	return a
+}
@@ -1,23 +1,45 @@
 package job
 
 import (
-	"encoding/base64"
+	"encoding/json"
 	"github.com/TD-Hackathon-2022/DCoB-Scheduler/api"
 	"github.com/TD-Hackathon-2022/DCoB-Scheduler/module"
-	"io/ioutil"
+	"github.com/pkg/errors"
+	"math"
 	"math/rand"
-	"os"
 	"strconv"
 	"sync/atomic"
 )
 
-const total = 1000000
+const (
+	total           = 1000000
+	calPiKind       = "CalPi"
+	defaultPiFuncId = "custom-func-monte_carlo_pi"
+	// sampleTolerance is how many standard deviations a sample may fall from the expectation
+	sampleTolerance = 5
+)
+
+var (
+	// points fall in circle follow binomial distribution of total trials with probability pi/4
+	circleRatio = math.Pi / 4
+	sampleSigma = math.Sqrt(total * circleRatio * (1 - circleRatio))
+)
+
+func init() {
+	module.RegisterJobKind(calPiKind, func() module.Job {
+		return &CalPi{jobAttr: newJobAttr(), samples: module.NewStatsReducer(module.DecodeNumber)}
+	})
+}
 
 type CalPi struct {
-	id      string
-	taskCnt uint64
-	funcId  string
-	sumCnt  uint64
+	jobAttr
+	id        string
+	taskCnt   uint64
+	failedCnt uint64
+	lostCnt   uint64
+	funcId    string
+	// samples are numbers of points fell in circle reported by each task
+	samples *module.StatsReducer
 }
 
 func (h *CalPi) Id() string {
@@ -25,53 +47,195 @@ func (h *CalPi) Id() string {
 }
 
 func (h *CalPi) GetResult() map[string]interface{} {
-	return map[string]interface{}{"pi": h.getPi()}
+	return map[string]interface{}{"pi": h.getPi(), "samples": h.samples.Stats()}
 }
 
-func (h *CalPi) TryAdvance(fn func(task *module.Task)) (finished bool) {
-	file, err := os.Open("./custom_func/monte_carlo_pi_bg.wasm")
+type calPiState struct {
+	Id        string          `json:"id"`
+	TaskCnt   uint64          `json:"taskCnt"`
+	FailedCnt uint64          `json:"failedCnt"`
+	LostCnt   uint64          `json:"lostCnt"`
+	FuncId    string          `json:"funcId"`
+	Samples   json.RawMessage `json:"samples"`
+	Attr      *jobAttrState   `json:"attr,omitempty"`
+}
+
+func (h *CalPi) Kind() string {
+	return calPiKind
+}
+
+func (h *CalPi) Snapshot() ([]byte, error) {
+	samples, err := h.samples.Snapshot()
 	if err != nil {
-		panic(err)
+		return nil, err
 	}
 
-	b, err := ioutil.ReadAll(file)
-	if err != nil {
-		panic(err)
+	return json.Marshal(&calPiState{
+		Id:        h.id,
+		TaskCnt:   atomic.LoadUint64(&h.taskCnt),
+		FailedCnt: atomic.LoadUint64(&h.failedCnt),
+		LostCnt:   atomic.LoadUint64(&h.lostCnt),
+		FuncId:    h.funcId,
+		Samples:   samples,
+		Attr:      h.jobAttr.snapshot(),
+	})
+}
+
+// Restore regards tasks running before restart as failed, since their results will never be reported
+func (h *CalPi) Restore(state []byte) error {
+	s := &calPiState{}
+	if err := json.Unmarshal(state, s); err != nil {
+		return err
+	}
+
+	if len(s.Samples) > 0 {
+		if err := h.samples.Restore(s.Samples); err != nil {
+			return err
+		}
 	}
 
+	failedCnt := s.FailedCnt
+	if reported := h.samples.Stats().Count + failedCnt; reported < s.TaskCnt {
+		failedCnt = s.TaskCnt - h.samples.Stats().Count
+	}
+
+	h.jobAttr.restore(s.Attr)
+	h.id = s.Id
+	h.funcId = s.FuncId
+	atomic.StoreUint64(&h.taskCnt, s.TaskCnt)
+	atomic.StoreUint64(&h.failedCnt, failedCnt)
+	atomic.StoreUint64(&h.lostCnt, s.LostCnt)
+	return nil
+}
+
+func (h *CalPi) TryAdvance(fn func(task *module.Task)) (finished bool) {
+	if h.issuedAll() {
+		return true
+	}
+
+	// code of func is shipped by scheduler from func registry, no input needed
 	task := &module.Task{
-		Id:    h.id + "-task-" + strconv.FormatUint(atomic.AddUint64(&h.taskCnt, 1), 10),
-		JobId: h.id,
-		Ctx: &module.Context{
-			InitData: base64.StdEncoding.EncodeToString(b),
-		},
+		Id:            h.id + "-task-" + strconv.FormatUint(atomic.AddUint64(&h.taskCnt, 1), 10),
+		JobId:         h.id,
+		Ctx:           &module.Context{},
 		FuncId:        h.funcId,
+		MinCores:      h.minCores,
+		NeedsWasm:     true,
 		UpdateHandler: h.handleUpdate,
+		LostHandler:   h.handleLost,
+		RetryPolicy:   h.retry,
+		Equivalent:    equivalentSamples,
+	}
+	if h.proofCheck && h.funcId == defaultPiFuncId {
+		// number of points is only known of built-in func, func given by WithFunc may run any
+		task.Verify = verifySample
 	}
 
 	fn(task)
-	return false
+	return h.issuedAll()
+}
+
+func (h *CalPi) Completed() (done bool, err error) {
+	if h.targetReached() {
+		return true, nil
+	}
+
+	if h.maxTasks == 0 {
+		return false, nil
+	}
+
+	if h.samples.Stats().Count+atomic.LoadUint64(&h.failedCnt) < h.maxTasks {
+		return false, nil
+	}
+
+	if h.target > 0 {
+		return true, errors.Errorf("pi %f not within precision %f", h.getPi(), h.target)
+	}
+	return true, nil
+}
+
+func (h *CalPi) issuedAll() bool {
+	return (h.maxTasks > 0 && atomic.LoadUint64(&h.taskCnt) >= h.maxTasks) || h.targetReached()
+}
+
+// Progress is share of max tasks reported, precision target gives no clue how far it is
+func (h *CalPi) Progress() float64 {
+	if h.maxTasks == 0 {
+		return 0
+	}
+	return math.Min(float64(h.samples.Stats().Count+atomic.LoadUint64(&h.failedCnt))/float64(h.maxTasks), 1)
+}
+
+func (h *CalPi) targetReached() bool {
+	if h.target <= 0 || h.samples.Stats().Count == 0 {
+		return false
+	}
+
+	return math.Abs(h.getPi()-math.Pi) <= h.target
 }
 
 func (h *CalPi) handleUpdate(task *module.Task) {
-	if task.Ctx.Status == api.TaskStatus_Finished {
-		finalData := task.Ctx.FinalData.(string)
-		cnt, _ := strconv.ParseFloat(finalData, 32)
-		atomic.AddUint64(&h.sumCnt, uint64(cnt))
-		log.Infof("CalPi received result: [%s] : %d, new pi calculated as: %f", task.Id, uint64(cnt), h.getPi())
+	switch task.Ctx.Status {
+	case api.TaskStatus_Finished:
+		if err := h.samples.Add(0, task.Ctx.FinalData); err != nil {
+			atomic.AddUint64(&h.failedCnt, 1)
+			log.Warnf("CalPi received bad result: [%s] : %v", task.Id, err)
+			return
+		}
+		log.Infof("CalPi received result: [%s] : %v, new pi calculated as: %f", task.Id, task.Ctx.FinalData, h.getPi())
+	case api.TaskStatus_Error, api.TaskStatus_Interrupted:
+		atomic.AddUint64(&h.failedCnt, 1)
+	}
+}
+
+// verifySample rejects number of points in circle too unlikely for a fair run
+func verifySample(task *module.Task) error {
+	n, err := module.DecodeNumber(task.Ctx.FinalData)
+	if err != nil {
+		return err
+	}
+
+	if math.Abs(n-total*circleRatio) > sampleTolerance*sampleSigma {
+		return errors.Errorf("%v of %d points in circle is implausible", n, total)
+	}
+	return nil
+}
+
+// equivalentSamples tolerates difference of independent random runs, which is never exactly reproducible
+func equivalentSamples(a, b module.Data) bool {
+	x, err := module.DecodeNumber(a)
+	if err != nil {
+		return false
+	}
+	y, err := module.DecodeNumber(b)
+	if err != nil {
+		return false
 	}
+
+	// difference of two independent samples has sigma of sqrt(2) times one's
+	return math.Abs(x-y) <= sampleTolerance*math.Sqrt2*sampleSigma
 }
 
-func NewCalPi() module.Job {
+func (h *CalPi) handleLost(task *module.Task) {
+	lost := atomic.AddUint64(&h.lostCnt, 1)
+	log.Warnf("CalPi task lost: [%s], total lost: %d", task.Id, lost)
+}
+
+func NewCalPi(opts ...Option) module.Job {
 	h := &CalPi{
-		funcId: "custom-func-monte_carlo_pi",
+		jobAttr: newJobAttr(opts...),
+		funcId:  defaultPiFuncId,
+		samples: module.NewStatsReducer(module.DecodeNumber),
 	}
 
-	h.id = "CalPi-" + strconv.Itoa(rand.Int())
+	if h.jobAttr.funcId != "" {
+		h.funcId = h.jobAttr.funcId
+	}
+	h.id = calPiKind + "-" + strconv.Itoa(rand.Int())
 	return h
 }
 
 func (h *CalPi) getPi() float64 {
-	totalTried := atomic.LoadUint64(&h.taskCnt) * total
-	return 4 * (float64(atomic.LoadUint64(&h.sumCnt)) / float64(totalTried))
+	// only count tasks that reported back, lost or running tasks have no samples
+	return 4 * h.samples.Stats().Mean / total
 }
@@ -0,0 +1,127 @@
+package job
+
+import (
+	"github.com/TD-Hackathon-2022/DCoB-Scheduler/api"
+	"github.com/TD-Hackathon-2022/DCoB-Scheduler/module"
+	. "github.com/smartystreets/goconvey/convey"
+	"testing"
+)
+
+func TestCalPi_ShouldOnlyCountFinishedTasks(t *testing.T) {
+	Convey("given cal pi job with two issued tasks", t, func() {
+		calPi := NewCalPi().(*CalPi)
+		calPi.taskCnt = 2
+
+		Convey("when one task finished and another lost", func() {
+			finished := &module.Task{Id: "task-1", Ctx: &module.Context{Status: api.TaskStatus_Finished, FinalData: module.Text("785398")}}
+			calPi.handleUpdate(finished)
+			calPi.handleLost(&module.Task{Id: "task-2", Ctx: &module.Context{}})
+
+			Convey("then pi calculated by finished task only", func() {
+				So(calPi.GetResult()["pi"], ShouldAlmostEqual, 3.141592, 0.0001)
+				So(calPi.lostCnt, ShouldEqual, 1)
+			})
+		})
+
+		Convey("when task reports undecodable result", func() {
+			bad := &module.Task{Id: "task-1", Ctx: &module.Context{Status: api.TaskStatus_Finished, FinalData: module.Text("oops")}}
+			calPi.handleUpdate(bad)
+
+			Convey("then task counted as failed", func() {
+				So(calPi.failedCnt, ShouldEqual, 1)
+				So(calPi.GetResult()["pi"], ShouldEqual, 0)
+			})
+		})
+	})
+}
+
+func TestCalPi_ShouldIssueTaskOfWasmFunc(t *testing.T) {
+	Convey("given cal pi job with uploaded func", t, func() {
+		calPi := NewCalPi(WithFunc("monte_carlo_pi@v2"), WithMaxTasks(1))
+
+		Convey("when advance", func() {
+			var issued *module.Task
+			finished := calPi.TryAdvance(func(task *module.Task) { issued = task })
+
+			Convey("then task refers to func without carrying code", func() {
+				So(finished, ShouldBeTrue)
+				So(issued.FuncId, ShouldEqual, "monte_carlo_pi@v2")
+				So(issued.NeedsWasm, ShouldBeTrue)
+				So(issued.Ctx.InitData, ShouldResemble, module.Data{})
+			})
+		})
+	})
+}
+
+func TestCalPi_ShouldVerifySampleOnlyIfAskedForBuiltinFunc(t *testing.T) {
+	Convey("given task of calPi asks for proof check", t, func() {
+		var task *module.Task
+		NewCalPi(WithProofCheck()).TryAdvance(func(t *module.Task) {
+			task = t
+		})
+		task.Ctx.Status = api.TaskStatus_Finished
+
+		Convey("when sample is plausible", func() {
+			task.Ctx.FinalData = module.Text("785398")
+
+			Convey("then accepted", func() {
+				So(task.Verify(task), ShouldBeNil)
+			})
+		})
+
+		Convey("when sample is far from expectation", func() {
+			task.Ctx.FinalData = module.Text("1000000")
+
+			Convey("then rejected", func() {
+				So(task.Verify(task), ShouldNotBeNil)
+			})
+		})
+
+		Convey("when samples of replicas compared", func() {
+			Convey("then close samples are equivalent", func() {
+				So(task.Equivalent(module.Text("785398"), module.Text("786012")), ShouldBeTrue)
+				So(task.Equivalent(module.Text("785398"), module.Text("700000")), ShouldBeFalse)
+				So(task.Equivalent(module.Text("785398"), module.Text("oops")), ShouldBeFalse)
+			})
+		})
+
+		Convey("when job asks for no check or runs other func", func() {
+			var unchecked, otherFunc *module.Task
+			NewCalPi().TryAdvance(func(t *module.Task) { unchecked = t })
+			NewCalPi(WithProofCheck(), WithFunc("pi@v2")).TryAdvance(func(t *module.Task) { otherFunc = t })
+
+			Convey("then sample is never verified", func() {
+				So(unchecked.Verify, ShouldBeNil)
+				So(otherFunc.Verify, ShouldBeNil)
+			})
+		})
+	})
+}
+
+func TestCalPi_ShouldRestoreFromSnapshot(t *testing.T) {
+	Convey("given bounded calPi with a sample and a task still running", t, func() {
+		calPi := NewCalPi(WithMaxTasks(2), WithTarget(1e-9), WithFunc("pi@1")).(*CalPi)
+		calPi.TryAdvance(func(task *module.Task) {
+			task.Ctx.Status = api.TaskStatus_Finished
+			task.Ctx.FinalData = module.Text("785398")
+			task.UpdateHandler(task)
+		})
+		calPi.TryAdvance(func(*module.Task) {})
+
+		Convey("when snapshot then restore", func() {
+			state, err := calPi.Snapshot()
+			So(err, ShouldBeNil)
+
+			restored := &CalPi{jobAttr: newJobAttr(), samples: module.NewStatsReducer(module.DecodeNumber)}
+			So(restored.Restore(state), ShouldBeNil)
+
+			Convey("then bounds kept and running task regarded as failed", func() {
+				So(restored.jobAttr, ShouldResemble, calPi.jobAttr)
+				So(restored.funcId, ShouldEqual, "pi@1")
+				So(restored.failedCnt, ShouldEqual, 1)
+				done, _ := restored.Completed()
+				So(done, ShouldBeTrue)
+			})
+		})
+	})
+}
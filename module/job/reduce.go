@@ -0,0 +1,67 @@
+package job
+
+import (
+	"github.com/TD-Hackathon-2022/DCoB-Scheduler/module"
+	"github.com/pkg/errors"
+	"strings"
+)
+
+const (
+	SumReducer     = "sum"
+	ConcatReducer  = "concat"
+	MinReducer     = "min"
+	MaxReducer     = "max"
+	CollectReducer = "collect"
+)
+
+// specReducer presents result of module reducer as what reducer of JobSpec promises
+type specReducer struct {
+	module.Reducer
+	present func() interface{}
+}
+
+func (r *specReducer) Result() interface{} {
+	return r.present()
+}
+
+func newReducer(name string) (module.Reducer, error) {
+	switch name {
+	case SumReducer, MinReducer, MaxReducer:
+		stats := module.NewStatsReducer(module.DecodeNumber)
+		return &specReducer{Reducer: stats, present: func() interface{} {
+			s := stats.Stats()
+			switch {
+			case name == SumReducer:
+				return s.Sum
+			case s.Count == 0:
+				return nil
+			case name == MinReducer:
+				return s.Min
+			default:
+				return s.Max
+			}
+		}}, nil
+	case ConcatReducer:
+		collect := module.NewCollectReducer(module.DecodeString)
+		return &specReducer{Reducer: collect, present: func() interface{} {
+			sb := strings.Builder{}
+			for _, v := range collect.Values() {
+				sb.WriteString(v.(string))
+			}
+			return sb.String()
+		}}, nil
+	case CollectReducer:
+		return module.NewCollectReducer(module.DecodeValue), nil
+	default:
+		return nil, errors.Errorf("unknown reducer: %s", name)
+	}
+}
+
+func restoreReducer(name string, state []byte) (module.Reducer, error) {
+	r, err := newReducer(name)
+	if err != nil || len(state) == 0 {
+		return r, err
+	}
+
+	return r, r.Restore(state)
+}
@@ -1,9 +1,12 @@
 package module
 
 import (
+	"github.com/TD-Hackathon-2022/DCoB-Scheduler/api"
+	"github.com/pkg/errors"
 	. "github.com/smartystreets/goconvey/convey"
 	"github.com/stretchr/testify/mock"
 	"runtime"
+	"sync/atomic"
 	"testing"
 	"time"
 )
@@ -84,9 +87,325 @@ func TestJobRunner_InterruptCurrentJob(t *testing.T) {
 
 			Convey("then job q should contains that job", func() {
 				task := <-taskQ
-				So(task, ShouldEqual, poisonTask)
+				So(task.poison, ShouldBeTrue)
 				So(task.JobId, ShouldEqual, job.id)
 			})
 		})
 	})
 }
+
+func TestJobRunner_ShouldRunJobsConcurrently(t *testing.T) {
+	Convey("given job runner", t, func() {
+		taskQ := make(chan *Task)
+		runner := NewJobRunner(taskQ, &simpleStore{})
+		go runner.Start()
+		defer runner.ShutDown()
+		// drain task q so that running jobs can be interrupted when shut down
+		defer func() {
+			go func() {
+				for range taskQ {
+				}
+			}()
+		}()
+
+		Convey("when submit two endless jobs then interrupt one", func() {
+			endless := func(id string) *MockJob {
+				job := &MockJob{id: id}
+				job.Mock.On("TryAdvance", mock.Anything).Maybe().Return(false).Run(func(args mock.Arguments) {
+					args.Get(0).(func(*Task))(&Task{JobId: id})
+				})
+				return job
+			}
+			runner.Submit(endless("job0"))
+			runner.Submit(endless("job1"))
+
+			seen := make(map[string]bool)
+			for len(seen) < 2 {
+				seen[(<-taskQ).JobId] = true
+			}
+			interrupted := runner.InterruptJob("job0")
+
+			poisoned := false
+			job1Tasks := 0
+			for !poisoned || job1Tasks == 0 {
+				task := <-taskQ
+				if task.poison {
+					poisoned = task.JobId == "job0"
+				} else if task.JobId == "job1" {
+					job1Tasks++
+				}
+			}
+
+			Convey("then another job keeps sending tasks", func() {
+				So(interrupted, ShouldBeTrue)
+				So(poisoned, ShouldBeTrue)
+				So(job1Tasks, ShouldBeGreaterThan, 0)
+			})
+		})
+	})
+}
+
+type fakeBoundedJob struct {
+	MockJob
+	total    int
+	issued   int
+	reported int32
+	deadline time.Time
+}
+
+func (f *fakeBoundedJob) TryAdvance(fn func(task *Task)) bool {
+	f.issued++
+	fn(&Task{JobId: f.id, UpdateHandler: func(*Task) { atomic.AddInt32(&f.reported, 1) }})
+	return f.issued >= f.total
+}
+
+func (f *fakeBoundedJob) Completed() (bool, error) {
+	return int(atomic.LoadInt32(&f.reported)) >= f.total, nil
+}
+
+func (f *fakeBoundedJob) Deadline() time.Time {
+	return f.deadline
+}
+
+func TestJobRunner_ShouldDrainBoundedJobUntilCompleted(t *testing.T) {
+	Convey("given job runner", t, func() {
+		taskQ := make(chan *Task, 4)
+		store := &simpleStore{}
+		runner := NewJobRunner(taskQ, store)
+		go runner.Start()
+		defer runner.ShutDown()
+
+		Convey("when submit bounded job and all tasks issued", func() {
+			job := &fakeBoundedJob{MockJob: MockJob{id: "job0"}, total: 2}
+			runner.Submit(job)
+			tasks := []*Task{<-taskQ, <-taskQ}
+			time.Sleep(100 * time.Millisecond)
+			drainingState, _ := runner.GetJobState(job.id)
+
+			Convey("then job succeeded after all results received", func() {
+				for _, task := range tasks {
+					task.UpdateHandler(task)
+				}
+				poison := <-taskQ
+				time.Sleep(100 * time.Millisecond)
+				state, _ := runner.GetJobState(job.id)
+
+				So(drainingState, ShouldEqual, JobDraining)
+				So(poison.poison, ShouldBeTrue)
+				So(state, ShouldEqual, JobSucceeded)
+			})
+		})
+
+		Convey("when submit bounded job with passed deadline", func() {
+			job := &fakeBoundedJob{MockJob: MockJob{id: "job1"}, total: 2, deadline: time.Now().Add(100 * time.Millisecond)}
+			runner.Submit(job)
+			<-taskQ
+			<-taskQ
+			poison := <-taskQ
+			time.Sleep(100 * time.Millisecond)
+			state, _ := runner.GetJobState(job.id)
+
+			Convey("then job failed", func() {
+				So(poison.poison, ShouldBeTrue)
+				So(state, ShouldEqual, JobFailed)
+			})
+		})
+
+		Convey("when submit bounded job then interrupt it", func() {
+			job := &fakeBoundedJob{MockJob: MockJob{id: "job2"}, total: 2}
+			runner.Submit(job)
+			<-taskQ
+			<-taskQ
+			runner.InterruptJob(job.id)
+			<-taskQ
+			time.Sleep(100 * time.Millisecond)
+			state, _ := runner.GetJobState(job.id)
+
+			Convey("then job cancelled", func() {
+				So(state, ShouldEqual, JobCancelled)
+			})
+		})
+	})
+}
+
+func TestJobRunner_ShouldPauseResumeAndCancelJob(t *testing.T) {
+	Convey("given job runner with running endless job", t, func() {
+		taskQ := make(chan *Task, 1)
+		runner := NewJobRunner(taskQ, &simpleStore{})
+		go runner.Start()
+		defer runner.ShutDown()
+
+		job := &MockJob{id: "job0"}
+		job.Mock.On("TryAdvance", mock.Anything).Maybe().Return(false).Run(func(args mock.Arguments) {
+			args.Get(0).(func(*Task))(&Task{JobId: "job0"})
+		})
+		runner.Submit(job)
+		<-taskQ
+
+		Convey("when pause job", func() {
+			err := runner.PauseJob(job.id)
+			// the task being sent before paused is still issued
+			for drained := false; !drained; {
+				select {
+				case <-taskQ:
+				case <-time.After(100 * time.Millisecond):
+					drained = true
+				}
+			}
+			state, _ := runner.GetJobState(job.id)
+
+			Convey("then no more task issued", func() {
+				So(err, ShouldBeNil)
+				So(state, ShouldEqual, JobPaused)
+				So(len(taskQ), ShouldEqual, 0)
+				So(runner.ListJobs(JobPaused), ShouldResemble, []*JobInfo{{Id: job.id, State: JobPaused, Tasks: map[string]int{"Running": 1}}})
+				So(runner.ListJobs(JobRunning), ShouldBeEmpty)
+				So(errors.Cause(runner.PauseJob(job.id)), ShouldEqual, ErrJobStateConflict)
+			})
+
+			Convey("then issue task again when resumed", func() {
+				So(runner.ResumeJob(job.id), ShouldBeNil)
+				So((<-taskQ).JobId, ShouldEqual, job.id)
+
+				state, _ := runner.GetJobState(job.id)
+				So(state, ShouldEqual, JobRunning)
+			})
+		})
+
+		Convey("when cancel job", func() {
+			err := runner.CancelJob(job.id)
+			for task := range taskQ {
+				if task.poison {
+					break
+				}
+			}
+			time.Sleep(100 * time.Millisecond)
+			state, _ := runner.GetJobState(job.id)
+
+			Convey("then job cancelled", func() {
+				So(err, ShouldBeNil)
+				So(state, ShouldEqual, JobCancelled)
+				So(errors.Cause(runner.CancelJob(job.id)), ShouldEqual, ErrJobStateConflict)
+				So(runner.CancelJob("not-exist"), ShouldEqual, ErrJobNotFound)
+			})
+		})
+	})
+}
+
+func TestJobRunner_ShouldResubmitPausedJobNotRunning(t *testing.T) {
+	Convey("given paused job restored in store", t, func() {
+		store := &simpleStore{}
+		job := &MockJob{id: "job0"}
+		job.Mock.On("TryAdvance", mock.Anything).Maybe().Return(true)
+		store.Store(job)
+		store.SetState(job.id, JobPaused)
+		runner := NewJobRunner(make(chan *Task), store)
+
+		Convey("when resume job", func() {
+			err := runner.ResumeJob(job.id)
+
+			Convey("then job submitted again", func() {
+				So(err, ShouldBeNil)
+				So(<-runner.jobQ, ShouldEqual, job)
+				state, _ := runner.GetJobState(job.id)
+				So(state, ShouldEqual, JobPending)
+			})
+		})
+	})
+}
+
+func TestJobRunner_ShouldPublishTaskAndJobEvents(t *testing.T) {
+	Convey("given job runner with subscriber of job", t, func() {
+		taskQ := make(chan *Task, 4)
+		runner := NewJobRunner(taskQ, &simpleStore{})
+		go runner.Start()
+		defer runner.ShutDown()
+
+		job := &fakeBoundedJob{MockJob: MockJob{id: "job0"}, total: 1}
+		events, cancel := runner.Subscribe(job.id)
+		defer cancel()
+
+		Convey("when task reports progress then finishes", func() {
+			runner.Submit(job)
+			task := <-taskQ
+			task.Ctx = &Context{Status: api.TaskStatus_Running, IntermediateData: Text("partial"), Progress: 0.5}
+			task.UpdateHandler(task)
+			task.Ctx.Status = api.TaskStatus_Finished
+			task.Ctx.FinalData = Text("done")
+			task.Ctx.Progress = 1
+			task.UpdateHandler(task)
+
+			received := make([]*Event, 0)
+			for e := range events {
+				received = append(received, e)
+				if e.Job != nil && e.Job.State.Terminal() {
+					break
+				}
+			}
+
+			Convey("then subscriber receives task updates and job state changes in order, job result only once ended", func() {
+				states := make([]JobState, 0)
+				tasks := make([]*TaskUpdate, 0)
+				for _, e := range received {
+					So(e.JobId, ShouldEqual, job.id)
+					if e.Type == TaskEventType {
+						tasks = append(tasks, e.Task)
+					} else {
+						states = append(states, e.Job.State)
+						So(e.Job.Result != nil, ShouldEqual, e.Job.State.Terminal())
+					}
+				}
+
+				So(states[0], ShouldEqual, JobPending)
+				So(states[len(states)-1], ShouldEqual, JobSucceeded)
+				So(tasks, ShouldResemble, []*TaskUpdate{
+					{Status: "Running", Progress: 0.5, Data: "partial"},
+					{Status: "Finished", Progress: 1, Data: "done"},
+				})
+			})
+		})
+	})
+}
+
+func TestJobRunner_ShouldNotReviveEndedJob(t *testing.T) {
+	Convey("given job cancelled while waiting in job q", t, func() {
+		taskQ := make(chan *Task, 1)
+		runner := NewJobRunner(taskQ, &simpleStore{})
+		job := &MockJob{id: "job0"}
+		runner.Submit(job)
+		cancelErr := runner.CancelJob(job.id)
+
+		Convey("when runner starts", func() {
+			go runner.Start()
+			time.Sleep(50 * time.Millisecond)
+			runner.ShutDown()
+
+			Convey("then job stays cancelled without running", func() {
+				state, _ := runner.GetJobState(job.id)
+				So(cancelErr, ShouldBeNil)
+				So(state, ShouldEqual, JobCancelled)
+				job.Mock.AssertNotCalled(t, "TryAdvance", mock.Anything)
+				So(len(taskQ), ShouldEqual, 0)
+			})
+		})
+	})
+
+	Convey("given job ended while still tracked as running", t, func() {
+		runner := NewJobRunner(make(chan *Task), &simpleStore{})
+		job := &MockJob{id: "job0"}
+		runner.store.Store(job)
+		runner.store.SetState(job.id, JobRunning)
+		runner.running[job.id] = &jobControl{job: job, interruptCh: make(chan struct{})}
+		runner.transition(job, JobSucceeded, JobRunning)
+
+		Convey("when pause job", func() {
+			err := runner.PauseJob(job.id)
+
+			Convey("then terminal state kept", func() {
+				state, _ := runner.GetJobState(job.id)
+				So(errors.Cause(err), ShouldEqual, ErrJobStateConflict)
+				So(state, ShouldEqual, JobSucceeded)
+			})
+		})
+	})
+}
@@ -0,0 +1,36 @@
+package module
+
+import "time"
+
+type JobState string
+
+const (
+	JobPending   JobState = "Pending"
+	JobRunning   JobState = "Running"
+	JobPaused    JobState = "Paused"
+	JobDraining  JobState = "Draining"
+	JobSucceeded JobState = "Succeeded"
+	JobFailed    JobState = "Failed"
+	JobCancelled JobState = "Cancelled"
+)
+
+func (s JobState) Terminal() bool {
+	return s == JobSucceeded || s == JobFailed || s == JobCancelled
+}
+
+// Completable is implemented by bounded jobs, which know when all results received or target reached.
+// Job return finished from TryAdvance when all tasks issued, then it is drained until Completed reports done.
+// Job without this interface is succeeded as soon as all tasks issued.
+type Completable interface {
+	Completed() (done bool, err error)
+}
+
+// Deadlined is implemented by jobs that should be failed if not completed before deadline, zero means no deadline
+type Deadlined interface {
+	Deadline() time.Time
+}
+
+// Progressive is implemented by jobs that tell how much of them is done in [0, 1], it is streamed along with job state
+type Progressive interface {
+	Progress() float64
+}
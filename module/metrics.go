@@ -0,0 +1,228 @@
+package module
+
+import (
+	"github.com/TD-Hackathon-2022/DCoB-Scheduler/api"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	metricsNamespace = "dcob"
+	// series of this many most recently ended jobs are kept, older ones are deleted
+	endedJobsKept = 100
+)
+
+var (
+	tasksAssigned = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: metricsNamespace,
+		Name:      "tasks_assigned_total",
+		Help:      "Tasks assigned to workers, retries included.",
+	}, []string{"job", "func"})
+
+	tasksEnded = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: metricsNamespace,
+		Name:      "tasks_ended_total",
+		Help:      "Task attempts ended on workers by status: finished, error or interrupted.",
+	}, []string{"job", "func", "status"})
+
+	taskDuration = promauto.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: metricsNamespace,
+		Name:      "task_duration_seconds",
+		Help:      "Time from task assigned to worker until it ended, by status.",
+		Buckets:   prometheus.ExponentialBuckets(0.05, 3, 10),
+	}, []string{"job", "func", "status"})
+
+	verifications = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: metricsNamespace,
+		Name:      "verifications_total",
+		Help:      "Verified task results by outcome: agreed or disagreed by replicas, rejected by verifier.",
+	}, []string{"job", "outcome"})
+
+	poolWait = promauto.NewHistogram(prometheus.HistogramOpts{
+		Namespace: metricsNamespace,
+		Name:      "worker_pool_wait_seconds",
+		Help:      "Time decider waited for a free worker slot capable to run buffered tasks.",
+		Buckets:   prometheus.ExponentialBuckets(0.001, 4, 10),
+	})
+)
+
+// labelsOfJob are label values observed of job besides job id, to delete its series once ended
+type labelsOfJob struct {
+	funcs    map[string]struct{}
+	ended    map[[2]string]struct{}
+	outcomes map[string]struct{}
+}
+
+// jobSeries tracks series labelled by job, so they do not pile up as jobs come and go
+type jobSeries struct {
+	lock  sync.Mutex
+	jobs  map[string]*labelsOfJob
+	ended []string
+}
+
+var series = &jobSeries{jobs: make(map[string]*labelsOfJob)}
+
+func (s *jobSeries) of(jobId string) *labelsOfJob {
+	l, exist := s.jobs[jobId]
+	if !exist {
+		l = &labelsOfJob{funcs: make(map[string]struct{}), ended: make(map[[2]string]struct{}), outcomes: make(map[string]struct{})}
+		s.jobs[jobId] = l
+	}
+	return l
+}
+
+func (s *jobSeries) assigned(jobId, funcId string) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	s.of(jobId).funcs[funcId] = struct{}{}
+}
+
+func (s *jobSeries) endedWith(jobId, funcId, status string) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	s.of(jobId).ended[[2]string{funcId, status}] = struct{}{}
+}
+
+func (s *jobSeries) verified(jobId, outcome string) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	s.of(jobId).outcomes[outcome] = struct{}{}
+}
+
+// retire marks job ended, series of the job ended endedJobsKept jobs ago are deleted,
+// so that final values of recent jobs can still be scraped, and late reports of interrupted tasks land on kept series
+func (s *jobSeries) retire(jobId string) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	for _, id := range s.ended {
+		if id == jobId {
+			return
+		}
+	}
+
+	s.ended = append(s.ended, jobId)
+	for len(s.ended) > endedJobsKept {
+		s.delete(s.ended[0])
+		s.ended = s.ended[1:]
+	}
+}
+
+func (s *jobSeries) delete(jobId string) {
+	l, exist := s.jobs[jobId]
+	if !exist {
+		return
+	}
+
+	for funcId := range l.funcs {
+		tasksAssigned.DeleteLabelValues(jobId, funcId)
+	}
+	for labels := range l.ended {
+		tasksEnded.DeleteLabelValues(jobId, labels[0], labels[1])
+		taskDuration.DeleteLabelValues(jobId, labels[0], labels[1])
+	}
+	for outcome := range l.outcomes {
+		verifications.DeleteLabelValues(jobId, outcome)
+	}
+	delete(s.jobs, jobId)
+}
+
+// observeAssigned starts the latency clock of task attempt
+func observeAssigned(task *Task) {
+	task.assignedAt = time.Now()
+	tasksAssigned.WithLabelValues(task.JobId, task.FuncId).Inc()
+	series.assigned(task.JobId, task.FuncId)
+}
+
+// observeEnded records the outcome of task attempt, task never assigned is ignored
+func observeEnded(task *Task, status api.TaskStatus) {
+	if task.assignedAt.IsZero() {
+		return
+	}
+
+	label := strings.ToLower(status.String())
+	tasksEnded.WithLabelValues(task.JobId, task.FuncId, label).Inc()
+	taskDuration.WithLabelValues(task.JobId, task.FuncId, label).Observe(time.Since(task.assignedAt).Seconds())
+	series.endedWith(task.JobId, task.FuncId, label)
+	task.assignedAt = time.Time{}
+}
+
+func observeVerification(task *Task, outcome string) {
+	verifications.WithLabelValues(task.JobId, outcome).Inc()
+	series.verified(task.JobId, outcome)
+}
+
+// retireJobMetrics is called once job ended, its series are deleted after enough later jobs ended
+func retireJobMetrics(jobId string) {
+	series.retire(jobId)
+}
+
+func observeWait(since time.Time) {
+	poolWait.Observe(time.Since(since).Seconds())
+}
+
+var (
+	workersDesc = prometheus.NewDesc(metricsNamespace+"_workers",
+		"Connected workers by status: idle, busy or closing.", []string{"status"}, nil)
+	slotsDesc = prometheus.NewDesc(metricsNamespace+"_worker_slots",
+		"Task slots of connected workers by state: free or busy.", []string{"state"}, nil)
+	taskQueueLengthDesc = prometheus.NewDesc(metricsNamespace+"_task_queue_length",
+		"Tasks queued for decider.", nil, nil)
+	taskQueueCapacityDesc = prometheus.NewDesc(metricsNamespace+"_task_queue_capacity",
+		"Capacity of task queue, submitting job blocks once queue is full.", nil, nil)
+)
+
+// poolCollector reads worker pool and task queue at scrape time, so nothing is tracked on hot path
+type poolCollector struct {
+	pool  *WorkerPool
+	taskQ chan *Task
+}
+
+func (c *poolCollector) Describe(ch chan<- *prometheus.Desc) {
+	ch <- workersDesc
+	ch <- slotsDesc
+	ch <- taskQueueLengthDesc
+	ch <- taskQueueCapacityDesc
+}
+
+func (c *poolCollector) Collect(ch chan<- prometheus.Metric) {
+	workers := map[api.WorkerStatus]int{api.WorkerStatus_Idle: 0, api.WorkerStatus_Busy: 0, api.WorkerStatus_Closing: 0}
+	var free, busy int
+
+	c.pool.lock.RLock()
+	for _, wkr := range c.pool.pool {
+		switch {
+		case wkr.isClosing():
+			workers[api.WorkerStatus_Closing]++
+		case wkr.busy():
+			workers[api.WorkerStatus_Busy]++
+		default:
+			workers[api.WorkerStatus_Idle]++
+		}
+
+		for _, s := range wkr.slots {
+			if s.busy() {
+				busy++
+			} else if !s.occupied() {
+				free++
+			}
+		}
+	}
+	c.pool.lock.RUnlock()
+
+	for status, cnt := range workers {
+		ch <- prometheus.MustNewConstMetric(workersDesc, prometheus.GaugeValue, float64(cnt), strings.ToLower(status.String()))
+	}
+	ch <- prometheus.MustNewConstMetric(slotsDesc, prometheus.GaugeValue, float64(free), "free")
+	ch <- prometheus.MustNewConstMetric(slotsDesc, prometheus.GaugeValue, float64(busy), "busy")
+	ch <- prometheus.MustNewConstMetric(taskQueueLengthDesc, prometheus.GaugeValue, float64(len(c.taskQ)))
+	ch <- prometheus.MustNewConstMetric(taskQueueCapacityDesc, prometheus.GaugeValue, float64(cap(c.taskQ)))
+}
+
+// NewPoolCollector exposes connected workers by status and task queue depth against its capacity
+func NewPoolCollector(pool *WorkerPool, taskQ chan *Task) prometheus.Collector {
+	return &poolCollector{pool: pool, taskQ: taskQ}
+}
@@ -0,0 +1,109 @@
+package module
+
+import (
+	"fmt"
+	. "github.com/TD-Hackathon-2022/DCoB-Scheduler/api"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	. "github.com/smartystreets/goconvey/convey"
+	"strings"
+	"testing"
+)
+
+func TestMetrics_ShouldCountTaskOutcomeByJobAndFunc(t *testing.T) {
+	Convey("given decider assigned task to worker", t, func() {
+		jobId := "metrics-job"
+		updated := make(chan *Task, 1)
+		task := &Task{Id: "metrics-task", JobId: jobId, FuncId: "hash-miner", Ctx: &Context{InitData: Text("fake-data")},
+			UpdateHandler: func(task *Task) { updated <- task }}
+
+		wp := NewWorkerPool()
+		outputCh := make(chan *Msg, 1)
+		_ = wp.Add("worker", outputCh, &RegisterPayload{FuncIds: []string{"hash-miner"}, ProtocolVersion: ProtocolVersion})
+
+		taskQ := make(chan *Task, 1)
+		taskQ <- task
+		go NewDecider(wp, taskQ).Start()
+		defer close(taskQ)
+		<-outputCh
+
+		Convey("when worker reports task finished", func() {
+			_ = wp.UpdateStatus("worker", &StatusPayload{TaskId: task.Id, TaskStatus: TaskStatus_Finished})
+			<-updated
+
+			Convey("then assignment and outcome are counted", func() {
+				So(testutil.ToFloat64(tasksAssigned.WithLabelValues(jobId, "hash-miner")), ShouldEqual, 1)
+				So(testutil.ToFloat64(tasksEnded.WithLabelValues(jobId, "hash-miner", "finished")), ShouldEqual, 1)
+				So(testutil.ToFloat64(tasksEnded.WithLabelValues(jobId, "hash-miner", "error")), ShouldEqual, 0)
+				So(testutil.CollectAndCount(taskDuration), ShouldBeGreaterThan, 0)
+			})
+		})
+	})
+}
+
+func TestMetrics_ShouldCollectWorkersAndTaskQueue(t *testing.T) {
+	Convey("given pool with idle and closing workers and queued task", t, func() {
+		wp := NewWorkerPool()
+		_ = wp.Add("idle", make(chan *Msg, 1), &RegisterPayload{Slots: 2})
+		_ = wp.Add("closing", make(chan *Msg, 1), &RegisterPayload{})
+		wp.Close("closing")
+
+		taskQ := make(chan *Task, 4)
+		taskQ <- &Task{}
+
+		Convey("then collected gauges reflect them", func() {
+			expected := `
+# HELP dcob_task_queue_capacity Capacity of task queue, submitting job blocks once queue is full.
+# TYPE dcob_task_queue_capacity gauge
+dcob_task_queue_capacity 4
+# HELP dcob_task_queue_length Tasks queued for decider.
+# TYPE dcob_task_queue_length gauge
+dcob_task_queue_length 1
+# HELP dcob_worker_slots Task slots of connected workers by state: free or busy.
+# TYPE dcob_worker_slots gauge
+dcob_worker_slots{state="busy"} 0
+dcob_worker_slots{state="free"} 2
+# HELP dcob_workers Connected workers by status: idle, busy or closing.
+# TYPE dcob_workers gauge
+dcob_workers{status="busy"} 0
+dcob_workers{status="closing"} 0
+dcob_workers{status="idle"} 1
+`
+			So(testutil.CollectAndCompare(NewPoolCollector(wp, taskQ), strings.NewReader(expected)), ShouldBeNil)
+		})
+	})
+}
+
+func TestMetrics_ShouldDeleteSeriesOfJobsEndedLongAgo(t *testing.T) {
+	Convey("given task of job observed", t, func() {
+		task := &Task{Id: "retired-task", JobId: "retired-job", FuncId: "hash-miner", Ctx: &Context{}}
+		observeAssigned(task)
+		observeVerification(task, "agreed")
+		observeEnded(task, TaskStatus_Finished)
+		// deleting series reports whether it existed
+		deleted := func() []bool {
+			return []bool{
+				tasksAssigned.DeleteLabelValues(task.JobId, "hash-miner"),
+				tasksEnded.DeleteLabelValues(task.JobId, "hash-miner", "finished"),
+				taskDuration.DeleteLabelValues(task.JobId, "hash-miner", "finished"),
+				verifications.DeleteLabelValues(task.JobId, "agreed"),
+			}
+		}
+
+		Convey("when the job ended", func() {
+			retireJobMetrics(task.JobId)
+			_, kept := series.jobs[task.JobId]
+
+			Convey("and enough later jobs ended", func() {
+				for i := 0; i < endedJobsKept; i++ {
+					retireJobMetrics(fmt.Sprintf("later-job-%d", i))
+				}
+
+				Convey("then its series are deleted", func() {
+					So(kept, ShouldBeTrue)
+					So(series.jobs, ShouldNotContainKey, task.JobId)
+					So(deleted(), ShouldResemble, []bool{false, false, false, false})
+				})
+			})
+		})
+	})
+}
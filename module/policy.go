@@ -0,0 +1,215 @@
+package module
+
+import (
+	"container/heap"
+	"container/list"
+	"github.com/pkg/errors"
+)
+
+const (
+	FIFOPolicy              = "fifo"
+	PriorityPolicy          = "priority"
+	FairSharePolicy         = "fair-share"
+	defaultTaskWeight       = 1
+	defaultPolicyBufferSize = 64
+)
+
+// Prioritized is implemented by jobs that declare their priority and fair share weight, tasks of job are stamped with them
+type Prioritized interface {
+	Priority() int
+	Weight() int
+}
+
+// SchedulePolicy decides which of the buffered tasks the decider dispatches next, it is only accessed by decider goroutine
+type SchedulePolicy interface {
+	Push(task *Task)
+	Pop() (task *Task, ok bool)
+	// Putback returns task popped but not dispatched, it regains its position and share as if never popped,
+	// tasks popped together should be put back in reverse order
+	Putback(task *Task)
+	Len() int
+}
+
+func NewSchedulePolicy(name string) (SchedulePolicy, error) {
+	switch name {
+	case FIFOPolicy:
+		return newFIFOPolicy(), nil
+	case PriorityPolicy:
+		return newPriorityPolicy(), nil
+	case FairSharePolicy:
+		return newFairSharePolicy(), nil
+	default:
+		return nil, errors.Errorf("unknown schedule policy: %s", name)
+	}
+}
+
+type fifoPolicy struct {
+	tasks *list.List
+}
+
+func (p *fifoPolicy) Push(task *Task) {
+	p.tasks.PushBack(task)
+}
+
+func (p *fifoPolicy) Pop() (task *Task, ok bool) {
+	e := p.tasks.Front()
+	if e == nil {
+		return nil, false
+	}
+
+	return p.tasks.Remove(e).(*Task), true
+}
+
+func (p *fifoPolicy) Putback(task *Task) {
+	p.tasks.PushFront(task)
+}
+
+func (p *fifoPolicy) Len() int {
+	return p.tasks.Len()
+}
+
+func newFIFOPolicy() *fifoPolicy {
+	return &fifoPolicy{tasks: list.New()}
+}
+
+type priorityItem struct {
+	task *Task
+	seq  uint64
+}
+
+type priorityHeap []*priorityItem
+
+func (h priorityHeap) Len() int { return len(h) }
+
+func (h priorityHeap) Less(i, j int) bool {
+	if h[i].task.Priority != h[j].task.Priority {
+		return h[i].task.Priority > h[j].task.Priority
+	}
+
+	return h[i].seq < h[j].seq
+}
+
+func (h priorityHeap) Swap(i, j int) { h[i], h[j] = h[j], h[i] }
+
+func (h *priorityHeap) Push(x interface{}) { *h = append(*h, x.(*priorityItem)) }
+
+func (h *priorityHeap) Pop() interface{} {
+	old := *h
+	n := len(old)
+	item := old[n-1]
+	old[n-1] = nil
+	*h = old[:n-1]
+	return item
+}
+
+// priorityPolicy always dispatch task with the highest priority, FIFO among same priority
+type priorityPolicy struct {
+	items priorityHeap
+	seq   uint64
+}
+
+func (p *priorityPolicy) Push(task *Task) {
+	p.seq++
+	task.seq = p.seq
+	heap.Push(&p.items, &priorityItem{task: task, seq: p.seq})
+}
+
+func (p *priorityPolicy) Putback(task *Task) {
+	heap.Push(&p.items, &priorityItem{task: task, seq: task.seq})
+}
+
+func (p *priorityPolicy) Pop() (task *Task, ok bool) {
+	if p.items.Len() == 0 {
+		return nil, false
+	}
+
+	return heap.Pop(&p.items).(*priorityItem).task, true
+}
+
+func (p *priorityPolicy) Len() int {
+	return p.items.Len()
+}
+
+func newPriorityPolicy() *priorityPolicy {
+	return &priorityPolicy{}
+}
+
+type jobTaskQueue struct {
+	jobId  string
+	tasks  *list.List
+	pass   float64
+	weight int
+}
+
+// fairSharePolicy dispatch tasks of jobs in proportion to their weight (stride scheduling),
+// job with the smallest pass goes first, and its pass grows by 1/weight for each dispatched task
+type fairSharePolicy struct {
+	queues map[string]*jobTaskQueue
+	vtime  float64
+	size   int
+}
+
+func (p *fairSharePolicy) Push(task *Task) {
+	q, exist := p.queues[task.JobId]
+	if !exist {
+		// new or re-activated job starts from current virtual time, so that it cannot hoard credits while idle
+		q = &jobTaskQueue{jobId: task.JobId, tasks: list.New(), pass: p.vtime}
+		p.queues[task.JobId] = q
+	}
+
+	q.weight = task.Weight
+	if q.weight <= 0 {
+		q.weight = defaultTaskWeight
+	}
+
+	q.tasks.PushBack(task)
+	p.size++
+}
+
+func (p *fairSharePolicy) Pop() (task *Task, ok bool) {
+	var chosen *jobTaskQueue
+	for _, q := range p.queues {
+		if chosen == nil || q.pass < chosen.pass || (q.pass == chosen.pass && q.jobId < chosen.jobId) {
+			chosen = q
+		}
+	}
+
+	if chosen == nil {
+		return nil, false
+	}
+
+	task = chosen.tasks.Remove(chosen.tasks.Front()).(*Task)
+	p.size--
+	p.vtime = chosen.pass
+	task.pass = chosen.pass
+	chosen.pass += 1 / float64(chosen.weight)
+	if chosen.tasks.Len() == 0 {
+		delete(p.queues, chosen.jobId)
+	}
+
+	return task, true
+}
+
+// Putback refunds the pass charged when task popped, so job with task no worker can run keeps its share
+func (p *fairSharePolicy) Putback(task *Task) {
+	q, exist := p.queues[task.JobId]
+	if !exist {
+		q = &jobTaskQueue{jobId: task.JobId, tasks: list.New(), weight: task.Weight}
+		if q.weight <= 0 {
+			q.weight = defaultTaskWeight
+		}
+		p.queues[task.JobId] = q
+	}
+
+	q.pass = task.pass
+	q.tasks.PushFront(task)
+	p.size++
+}
+
+func (p *fairSharePolicy) Len() int {
+	return p.size
+}
+
+func newFairSharePolicy() *fairSharePolicy {
+	return &fairSharePolicy{queues: make(map[string]*jobTaskQueue)}
+}
@@ -0,0 +1,99 @@
+package module
+
+import (
+	. "github.com/smartystreets/goconvey/convey"
+	"testing"
+)
+
+func popJobIds(policy SchedulePolicy) []string {
+	jobIds := make([]string, 0, policy.Len())
+	for {
+		task, ok := policy.Pop()
+		if !ok {
+			return jobIds
+		}
+		jobIds = append(jobIds, task.JobId)
+	}
+}
+
+func TestPriorityPolicy_ShouldPopHighestPriorityFirstThenFIFO(t *testing.T) {
+	Convey("given priority policy", t, func() {
+		policy, _ := NewSchedulePolicy(PriorityPolicy)
+
+		Convey("when push tasks with different priority", func() {
+			policy.Push(&Task{JobId: "low-0"})
+			policy.Push(&Task{JobId: "high-0", Priority: 10})
+			policy.Push(&Task{JobId: "low-1"})
+			policy.Push(&Task{JobId: "high-1", Priority: 10})
+
+			Convey("then tasks popped by priority", func() {
+				So(popJobIds(policy), ShouldResemble, []string{"high-0", "high-1", "low-0", "low-1"})
+			})
+		})
+	})
+}
+
+func TestFairSharePolicy_ShouldPopTasksInProportionToWeight(t *testing.T) {
+	Convey("given fair share policy", t, func() {
+		policy, _ := NewSchedulePolicy(FairSharePolicy)
+
+		Convey("when one job floods tasks before another", func() {
+			for i := 0; i < 6; i++ {
+				policy.Push(&Task{JobId: "miner", Weight: 1})
+			}
+			for i := 0; i < 3; i++ {
+				policy.Push(&Task{JobId: "interactive", Weight: 2})
+			}
+
+			Convey("then tasks interleaved by weight", func() {
+				So(policy.Len(), ShouldEqual, 9)
+				So(popJobIds(policy), ShouldResemble, []string{
+					"interactive", "miner", "interactive", "interactive", "miner", "miner", "miner", "miner", "miner"})
+				So(policy.Len(), ShouldEqual, 0)
+			})
+		})
+	})
+}
+
+func TestSchedulePolicy_ShouldFailWithUnknownName(t *testing.T) {
+	Convey("when new policy with unknown name", t, func() {
+		_, err := NewSchedulePolicy("unknown")
+
+		Convey("then get error", func() {
+			So(err, ShouldNotBeNil)
+		})
+	})
+}
+
+func TestSchedulePolicy_ShouldKeepOrderOfTasksPutBack(t *testing.T) {
+	for _, name := range []string{FIFOPolicy, PriorityPolicy, FairSharePolicy} {
+		Convey("given "+name+" policy with tasks of two jobs", t, func() {
+			policy, _ := NewSchedulePolicy(name)
+			for i := 0; i < 3; i++ {
+				policy.Push(&Task{JobId: "pi", Weight: 1})
+				policy.Push(&Task{JobId: "miner", Weight: 1})
+			}
+			expected := popJobIds(policy)
+			for i := 0; i < 3; i++ {
+				policy.Push(&Task{JobId: "pi", Weight: 1})
+				policy.Push(&Task{JobId: "miner", Weight: 1})
+			}
+
+			Convey("when tasks popped then put back in reverse order", func() {
+				popped := make([]*Task, 0)
+				for i := 0; i < 4; i++ {
+					task, _ := policy.Pop()
+					popped = append(popped, task)
+				}
+				for i := len(popped) - 1; i >= 0; i-- {
+					policy.Putback(popped[i])
+				}
+
+				Convey("then they are popped in the same order as never popped", func() {
+					So(policy.Len(), ShouldEqual, 6)
+					So(popJobIds(policy), ShouldResemble, expected)
+				})
+			})
+		})
+	}
+}
@@ -0,0 +1,513 @@
+package module
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"github.com/TD-Hackathon-2022/DCoB-Scheduler/api"
+	"github.com/pkg/errors"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// Reducer folds results of finished tasks into job result, index identifies task within its job,
+// implementations are safe for concurrent use and their state can be snapshot along with job
+type Reducer interface {
+	Add(index int, data Data) error
+	Result() interface{}
+	Snapshot() ([]byte, error)
+	Restore(state []byte) error
+}
+
+// NumberDecoder decodes task result into number
+type NumberDecoder func(data Data) (float64, error)
+
+// Decoder decodes task result into value that survives JSON round trip
+type Decoder func(data Data) (interface{}, error)
+
+// StringsDecoder decodes task result into set members
+type StringsDecoder func(data Data) ([]string, error)
+
+// DecodeNumber parses textual number, or decodes number of JSON or msgpack
+func DecodeNumber(data Data) (float64, error) {
+	var f float64
+	switch data.ContentType {
+	case api.ContentType_Text, api.ContentType_Raw:
+		var err error
+		f, err = strconv.ParseFloat(strings.TrimSpace(string(data.Bytes)), 64)
+		if err != nil {
+			return 0, errors.Wrapf(ErrUndecodable, "number %q", data.Bytes)
+		}
+	default:
+		if err := data.Decode(&f); err != nil {
+			return 0, err
+		}
+	}
+
+	// NaN and Inf have no JSON representation
+	if math.IsNaN(f) || math.IsInf(f, 0) {
+		return 0, errors.Wrapf(ErrUndecodable, "number %v", f)
+	}
+	return f, nil
+}
+
+func DecodeString(data Data) (interface{}, error) {
+	var s string
+	if err := data.Decode(&s); err != nil {
+		return nil, err
+	}
+	return s, nil
+}
+
+// DecodeBytes takes binary result as is, textual result is regarded as base64 encoded by worker speaks older protocol
+func DecodeBytes(data Data) (interface{}, error) {
+	switch data.ContentType {
+	case api.ContentType_Raw:
+		return data.Bytes, nil
+	case api.ContentType_Text:
+		b, err := base64.StdEncoding.DecodeString(string(data.Bytes))
+		if err != nil {
+			return nil, errors.Wrapf(ErrUndecodable, "base64 %q", data.Bytes)
+		}
+		return b, nil
+	default:
+		var b []byte
+		if err := data.Decode(&b); err != nil {
+			return nil, err
+		}
+		return b, nil
+	}
+}
+
+// DecodeValue decodes structured result of JSON or msgpack, text as string and raw as bytes
+func DecodeValue(data Data) (interface{}, error) {
+	switch data.ContentType {
+	case api.ContentType_Text:
+		return string(data.Bytes), nil
+	case api.ContentType_Raw:
+		return data.Bytes, nil
+	default:
+		var v interface{}
+		if err := data.Decode(&v); err != nil {
+			return nil, err
+		}
+		return v, nil
+	}
+}
+
+// DecodeStrings decodes array of strings, textual result not an JSON array is a single member
+func DecodeStrings(data Data) ([]string, error) {
+	members := make([]string, 0)
+	switch data.ContentType {
+	case api.ContentType_Text:
+		if err := json.Unmarshal(data.Bytes, &members); err == nil {
+			return members, nil
+		}
+		return []string{string(data.Bytes)}, nil
+	case api.ContentType_Raw:
+		return []string{string(data.Bytes)}, nil
+	default:
+		if err := data.Decode(&members); err != nil {
+			return nil, err
+		}
+		return members, nil
+	}
+}
+
+// Entry is a decoded result along with index of task reported it
+type Entry struct {
+	Index int         `json:"index"`
+	Value interface{} `json:"value"`
+}
+
+// Stats of numeric results, mean and variance are computed by Welford's streaming algorithm
+type Stats struct {
+	Count    uint64  `json:"count"`
+	Sum      float64 `json:"sum"`
+	Mean     float64 `json:"mean"`
+	Variance float64 `json:"variance"`
+	Min      float64 `json:"min"`
+	Max      float64 `json:"max"`
+}
+
+type statsState struct {
+	Count uint64  `json:"count"`
+	Sum   float64 `json:"sum"`
+	Mean  float64 `json:"mean"`
+	M2    float64 `json:"m2"`
+	Min   float64 `json:"min"`
+	Max   float64 `json:"max"`
+}
+
+type StatsReducer struct {
+	lock   sync.Mutex
+	state  statsState
+	decode NumberDecoder
+}
+
+func (r *StatsReducer) Add(_ int, data Data) error {
+	v, err := r.decode(data)
+	if err != nil {
+		return err
+	}
+
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	s := &r.state
+	if s.Count == 0 || v < s.Min {
+		s.Min = v
+	}
+	if s.Count == 0 || v > s.Max {
+		s.Max = v
+	}
+
+	s.Count++
+	s.Sum += v
+	delta := v - s.Mean
+	s.Mean += delta / float64(s.Count)
+	s.M2 += delta * (v - s.Mean)
+	return nil
+}
+
+// Stats returns population variance, all zero if nothing added
+func (r *StatsReducer) Stats() Stats {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	s := r.state
+	stats := Stats{Count: s.Count, Sum: s.Sum, Mean: s.Mean, Min: s.Min, Max: s.Max}
+	if s.Count > 0 {
+		stats.Variance = s.M2 / float64(s.Count)
+	}
+	return stats
+}
+
+func (r *StatsReducer) Result() interface{} {
+	return r.Stats()
+}
+
+func (r *StatsReducer) Snapshot() ([]byte, error) {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	return json.Marshal(&r.state)
+}
+
+func (r *StatsReducer) Restore(state []byte) error {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	return json.Unmarshal(state, &r.state)
+}
+
+func NewStatsReducer(decode NumberDecoder) *StatsReducer {
+	return &StatsReducer{decode: decode}
+}
+
+// TopKReducer keeps k largest, or smallest, numeric results, best first
+type TopKReducer struct {
+	lock    sync.Mutex
+	k       int
+	largest bool
+	top     []Entry
+	decode  NumberDecoder
+}
+
+func (r *TopKReducer) Add(index int, data Data) error {
+	v, err := r.decode(data)
+	if err != nil {
+		return err
+	}
+
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	pos := sort.Search(len(r.top), func(i int) bool { return r.better(v, r.top[i].Value.(float64)) })
+	if pos >= r.k {
+		return nil
+	}
+
+	r.top = append(r.top, Entry{})
+	copy(r.top[pos+1:], r.top[pos:])
+	r.top[pos] = Entry{Index: index, Value: v}
+	if len(r.top) > r.k {
+		r.top = r.top[:r.k]
+	}
+	return nil
+}
+
+func (r *TopKReducer) better(a, b float64) bool {
+	if r.largest {
+		return a > b
+	}
+	return a < b
+}
+
+func (r *TopKReducer) Result() interface{} {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	return append([]Entry(nil), r.top...)
+}
+
+func (r *TopKReducer) Snapshot() ([]byte, error) {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	return json.Marshal(r.top)
+}
+
+func (r *TopKReducer) Restore(state []byte) error {
+	top := make([]Entry, 0, r.k)
+	if err := json.Unmarshal(state, &top); err != nil {
+		return err
+	}
+
+	// values are float64 after JSON round trip already
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	r.top = top
+	return nil
+}
+
+func NewTopKReducer(k int, largest bool, decode NumberDecoder) *TopKReducer {
+	return &TopKReducer{k: k, largest: largest, top: make([]Entry, 0, k), decode: decode}
+}
+
+// Histogram counts results by buckets, Counts[i] counts results <= Bounds[i] and > Bounds[i-1],
+// the last count is for results greater than all bounds
+type Histogram struct {
+	Bounds []float64 `json:"bounds"`
+	Counts []uint64  `json:"counts"`
+}
+
+type HistogramReducer struct {
+	lock   sync.Mutex
+	hist   Histogram
+	decode NumberDecoder
+}
+
+func (r *HistogramReducer) Add(_ int, data Data) error {
+	v, err := r.decode(data)
+	if err != nil {
+		return err
+	}
+
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	r.hist.Counts[sort.SearchFloat64s(r.hist.Bounds, v)]++
+	return nil
+}
+
+func (r *HistogramReducer) Result() interface{} {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	return Histogram{
+		Bounds: append([]float64(nil), r.hist.Bounds...),
+		Counts: append([]uint64(nil), r.hist.Counts...),
+	}
+}
+
+func (r *HistogramReducer) Snapshot() ([]byte, error) {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	return json.Marshal(r.hist.Counts)
+}
+
+func (r *HistogramReducer) Restore(state []byte) error {
+	counts := make([]uint64, 0)
+	if err := json.Unmarshal(state, &counts); err != nil {
+		return err
+	}
+
+	if len(counts) != len(r.hist.Counts) {
+		return errors.Errorf("histogram of %d buckets restored with %d", len(r.hist.Counts), len(counts))
+	}
+
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	r.hist.Counts = counts
+	return nil
+}
+
+func NewHistogramReducer(bounds []float64, decode NumberDecoder) *HistogramReducer {
+	bounds = append([]float64(nil), bounds...)
+	sort.Float64s(bounds)
+	return &HistogramReducer{
+		hist:   Histogram{Bounds: bounds, Counts: make([]uint64, len(bounds)+1)},
+		decode: decode,
+	}
+}
+
+// SetUnionReducer unions members of all results, result is sorted
+type SetUnionReducer struct {
+	lock    sync.Mutex
+	members map[string]struct{}
+	decode  StringsDecoder
+}
+
+func (r *SetUnionReducer) Add(_ int, data Data) error {
+	members, err := r.decode(data)
+	if err != nil {
+		return err
+	}
+
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	for _, m := range members {
+		r.members[m] = struct{}{}
+	}
+	return nil
+}
+
+func (r *SetUnionReducer) Result() interface{} {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	members := make([]string, 0, len(r.members))
+	for m := range r.members {
+		members = append(members, m)
+	}
+	sort.Strings(members)
+	return members
+}
+
+func (r *SetUnionReducer) Snapshot() ([]byte, error) {
+	return json.Marshal(r.Result())
+}
+
+func (r *SetUnionReducer) Restore(state []byte) error {
+	members := make([]string, 0)
+	if err := json.Unmarshal(state, &members); err != nil {
+		return err
+	}
+
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	for _, m := range members {
+		r.members[m] = struct{}{}
+	}
+	return nil
+}
+
+func NewSetUnionReducer(decode StringsDecoder) *SetUnionReducer {
+	return &SetUnionReducer{members: make(map[string]struct{}), decode: decode}
+}
+
+// FirstNReducer keeps the first n results in arrival order and ignores the rest, n <= 0 keeps all
+type FirstNReducer struct {
+	lock   sync.Mutex
+	n      int
+	found  []Entry
+	decode Decoder
+}
+
+func (r *FirstNReducer) Add(index int, data Data) error {
+	v, err := r.decode(data)
+	if err != nil {
+		return err
+	}
+
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	if r.n > 0 && len(r.found) >= r.n {
+		return nil
+	}
+
+	r.found = append(r.found, Entry{Index: index, Value: v})
+	return nil
+}
+
+func (r *FirstNReducer) Len() int {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	return len(r.found)
+}
+
+func (r *FirstNReducer) Full() bool {
+	return r.n > 0 && r.Len() >= r.n
+}
+
+func (r *FirstNReducer) Result() interface{} {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	return append([]Entry(nil), r.found...)
+}
+
+func (r *FirstNReducer) Snapshot() ([]byte, error) {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	return json.Marshal(r.found)
+}
+
+func (r *FirstNReducer) Restore(state []byte) error {
+	found := make([]Entry, 0)
+	if err := json.Unmarshal(state, &found); err != nil {
+		return err
+	}
+
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	r.found = found
+	return nil
+}
+
+func NewFirstNReducer(n int, decode Decoder) *FirstNReducer {
+	return &FirstNReducer{n: n, decode: decode}
+}
+
+// CollectReducer keeps all results ordered by task index no matter which task reported first
+type CollectReducer struct {
+	lock    sync.Mutex
+	results map[int]interface{}
+	decode  Decoder
+}
+
+func (r *CollectReducer) Add(index int, data Data) error {
+	v, err := r.decode(data)
+	if err != nil {
+		return err
+	}
+
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	r.results[index] = v
+	return nil
+}
+
+func (r *CollectReducer) Values() []interface{} {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	indexes := make([]int, 0, len(r.results))
+	for index := range r.results {
+		indexes = append(indexes, index)
+	}
+	sort.Ints(indexes)
+
+	values := make([]interface{}, 0, len(indexes))
+	for _, index := range indexes {
+		values = append(values, r.results[index])
+	}
+	return values
+}
+
+func (r *CollectReducer) Result() interface{} {
+	return r.Values()
+}
+
+func (r *CollectReducer) Snapshot() ([]byte, error) {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	return json.Marshal(r.results)
+}
+
+func (r *CollectReducer) Restore(state []byte) error {
+	results := make(map[int]interface{})
+	if err := json.Unmarshal(state, &results); err != nil {
+		return err
+	}
+
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	r.results = results
+	return nil
+}
+
+func NewCollectReducer(decode Decoder) *CollectReducer {
+	return &CollectReducer{results: make(map[int]interface{}), decode: decode}
+}
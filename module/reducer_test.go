@@ -0,0 +1,118 @@
+package module
+
+import (
+	"github.com/pkg/errors"
+	. "github.com/smartystreets/goconvey/convey"
+	"strconv"
+	"sync"
+	"testing"
+)
+
+func TestStatsReducer_ShouldStreamStats(t *testing.T) {
+	Convey("given stats reducer", t, func() {
+		r := NewStatsReducer(DecodeNumber)
+
+		Convey("when add results concurrently", func() {
+			wg := sync.WaitGroup{}
+			for i := 1; i <= 100; i++ {
+				wg.Add(1)
+				go func(i int) {
+					defer wg.Done()
+					_ = r.Add(i, Text(strconv.Itoa(i)))
+				}(i)
+			}
+			wg.Wait()
+
+			Convey("then stats computed of all results", func() {
+				s := r.Stats()
+				So(s.Count, ShouldEqual, 100)
+				So(s.Sum, ShouldEqual, 5050)
+				So(s.Mean, ShouldAlmostEqual, 50.5)
+				So(s.Variance, ShouldAlmostEqual, 833.25)
+				So(s.Min, ShouldEqual, 1)
+				So(s.Max, ShouldEqual, 100)
+			})
+		})
+
+		Convey("when add undecodable result", func() {
+			err := r.Add(0, Text("NaN"))
+
+			Convey("then result rejected", func() {
+				So(errors.Cause(err), ShouldEqual, ErrUndecodable)
+				So(r.Stats().Count, ShouldEqual, 0)
+			})
+		})
+	})
+}
+
+func TestReducers_ShouldRestoreFromSnapshot(t *testing.T) {
+	Convey("given reducers with results", t, func() {
+		reducers := map[string]func() Reducer{
+			"stats":     func() Reducer { return NewStatsReducer(DecodeNumber) },
+			"top-k":     func() Reducer { return NewTopKReducer(2, true, DecodeNumber) },
+			"histogram": func() Reducer { return NewHistogramReducer([]float64{10, 0}, DecodeNumber) },
+			"first-n":   func() Reducer { return NewFirstNReducer(2, DecodeString) },
+			"collect":   func() Reducer { return NewCollectReducer(DecodeString) },
+			"set-union": func() Reducer { return NewSetUnionReducer(DecodeStrings) },
+		}
+
+		for name, newReducer := range reducers {
+			r := newReducer()
+			for i, result := range []string{"5", "-3", "12", "5"} {
+				So(r.Add(i, Text(result)), ShouldBeNil)
+			}
+
+			Convey("when "+name+" restored from snapshot", func() {
+				state, err := r.Snapshot()
+				So(err, ShouldBeNil)
+
+				restored := newReducer()
+				So(restored.Restore(state), ShouldBeNil)
+
+				Convey("then same result", func() {
+					So(restored.Result(), ShouldResemble, r.Result())
+				})
+			})
+		}
+	})
+}
+
+func TestReducers_ShouldReduceByKind(t *testing.T) {
+	Convey("given results reported out of order", t, func() {
+		results := []string{"5", "-3", "12", "5"}
+		reduce := func(r Reducer) interface{} {
+			for _, i := range []int{2, 0, 3, 1} {
+				So(r.Add(i, Text(results[i])), ShouldBeNil)
+			}
+			return r.Result()
+		}
+
+		Convey("then top-k keeps best k", func() {
+			So(reduce(NewTopKReducer(2, true, DecodeNumber)), ShouldResemble, []Entry{{Index: 2, Value: 12.0}, {Index: 0, Value: 5.0}})
+			So(reduce(NewTopKReducer(1, false, DecodeNumber)), ShouldResemble, []Entry{{Index: 1, Value: -3.0}})
+		})
+
+		Convey("then histogram counts by bucket", func() {
+			So(reduce(NewHistogramReducer([]float64{10, 0}, DecodeNumber)), ShouldResemble, Histogram{
+				Bounds: []float64{0, 10},
+				Counts: []uint64{1, 2, 1},
+			})
+		})
+
+		Convey("then first-n keeps first n in arrival order", func() {
+			r := NewFirstNReducer(2, DecodeString)
+			So(reduce(r), ShouldResemble, []Entry{{Index: 2, Value: "12"}, {Index: 0, Value: "5"}})
+			So(r.Full(), ShouldBeTrue)
+		})
+
+		Convey("then collect keeps all in index order", func() {
+			So(reduce(NewCollectReducer(DecodeString)), ShouldResemble, []interface{}{"5", "-3", "12", "5"})
+		})
+
+		Convey("then set union dedups members", func() {
+			r := NewSetUnionReducer(DecodeStrings)
+			So(r.Add(4, Text(`["a", "5"]`)), ShouldBeNil)
+			So(reduce(r), ShouldResemble, []string{"-3", "12", "5", "a"})
+		})
+	})
+}
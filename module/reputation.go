@@ -0,0 +1,115 @@
+package module
+
+import (
+	"math"
+	"sync"
+	"time"
+)
+
+const (
+	// initialReputation is the score of worker never judged
+	initialReputation = 1.0
+	// penaltyFactor scales score of worker whose result is rejected or outvoted
+	penaltyFactor = 0.5
+	// rewardRate recovers share of score lost, for worker whose result agrees with quorum
+	rewardRate = 0.1
+	// forgetMargin is how close to initial score a worker is forgotten as never judged
+	forgetMargin = 1e-3
+
+	DefaultMinReputation      = 0.2
+	DefaultReputationHalfLife = time.Hour
+)
+
+// standing is score of worker as of the time it was last judged
+type standing struct {
+	score float64
+	at    time.Time
+}
+
+// Reputation scores workers by their verified results, scores are kept by principal of worker (see WithPrincipal),
+// so that neither reconnecting nor registering as another worker id clears them: rejected or outvoted result halves
+// the score, agreed one recovers a tenth of what is lost, and half of what is lost recovers every half life,
+// worker scored under threshold gets no task until then
+type Reputation struct {
+	lock      sync.RWMutex
+	scores    map[string]*standing
+	threshold float64
+	halfLife  time.Duration
+	now       func() time.Time
+}
+
+func (r *Reputation) Score(principal string) float64 {
+	r.lock.RLock()
+	defer r.lock.RUnlock()
+	return r.score(principal)
+}
+
+// Scores lists scores of workers ever judged and not recovered yet
+func (r *Reputation) Scores() map[string]float64 {
+	r.lock.RLock()
+	defer r.lock.RUnlock()
+	scores := make(map[string]float64, len(r.scores))
+	for principal := range r.scores {
+		scores[principal] = r.score(principal)
+	}
+	return scores
+}
+
+// Trusted tells whether worker can be assigned task, threshold 0 trusts everyone
+func (r *Reputation) Trusted(principal string) bool {
+	return r.Score(principal) >= r.threshold
+}
+
+func (r *Reputation) Reward(principal string) {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	score := r.score(principal)
+	r.set(principal, score+(initialReputation-score)*rewardRate)
+}
+
+func (r *Reputation) Penalize(principal string, reason string) {
+	r.lock.Lock()
+	score := r.score(principal) * penaltyFactor
+	r.set(principal, score)
+	r.lock.Unlock()
+
+	log.Warnf("Worker principal %s penalized, reputation: %.3f, reason: %s", principal, score, reason)
+	if score < r.threshold {
+		log.Warnf("Worker principal %s reputation under %.3f, no more task assigned", principal, r.threshold)
+	}
+}
+
+// Reset restores worker to initial score, returns false if it has never been judged
+func (r *Reputation) Reset(principal string) bool {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	_, exist := r.scores[principal]
+	delete(r.scores, principal)
+	return exist
+}
+
+func (r *Reputation) score(principal string) float64 {
+	s, exist := r.scores[principal]
+	if !exist {
+		return initialReputation
+	}
+
+	if r.halfLife <= 0 {
+		return s.score
+	}
+	lost := (initialReputation - s.score) * math.Pow(0.5, float64(r.now().Sub(s.at))/float64(r.halfLife))
+	return initialReputation - lost
+}
+
+func (r *Reputation) set(principal string, score float64) {
+	if initialReputation-score < forgetMargin {
+		delete(r.scores, principal)
+		return
+	}
+	r.scores[principal] = &standing{score: score, at: r.now()}
+}
+
+// NewReputation creates reputation never recovers by time, see WithReputationHalfLife
+func NewReputation(threshold float64) *Reputation {
+	return &Reputation{scores: make(map[string]*standing), threshold: threshold, now: time.Now}
+}
@@ -0,0 +1,55 @@
+package module
+
+import (
+	"github.com/TD-Hackathon-2022/DCoB-Scheduler/api"
+	"time"
+)
+
+type RetryPolicy struct {
+	MaxAttempts    int
+	InitialBackoff time.Duration
+	MaxBackoff     time.Duration
+	Multiplier     float64
+	RetryOn        []api.TaskStatus
+}
+
+func (p *RetryPolicy) shouldRetry(task *Task) bool {
+	if p == nil || task.Attempt+1 >= p.MaxAttempts {
+		return false
+	}
+
+	for _, status := range p.RetryOn {
+		if status == task.Ctx.Status {
+			return true
+		}
+	}
+
+	return false
+}
+
+// backoff returns the delay before given attempt (start from 1) be scheduled again
+func (p *RetryPolicy) backoff(attempt int) time.Duration {
+	delay := float64(p.InitialBackoff)
+	for i := 1; i < attempt; i++ {
+		delay *= p.Multiplier
+		if p.MaxBackoff > 0 && delay >= float64(p.MaxBackoff) {
+			return p.MaxBackoff
+		}
+	}
+
+	return time.Duration(delay)
+}
+
+func NewRetryPolicy(maxAttempts int, initialBackoff, maxBackoff time.Duration, retryOn ...api.TaskStatus) *RetryPolicy {
+	return &RetryPolicy{
+		MaxAttempts:    maxAttempts,
+		InitialBackoff: initialBackoff,
+		MaxBackoff:     maxBackoff,
+		Multiplier:     2,
+		RetryOn:        retryOn,
+	}
+}
+
+func DefaultRetryPolicy() *RetryPolicy {
+	return NewRetryPolicy(3, time.Second, 30*time.Second, api.TaskStatus_Error, api.TaskStatus_Interrupted)
+}
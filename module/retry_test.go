@@ -0,0 +1,60 @@
+package module
+
+import (
+	. "github.com/TD-Hackathon-2022/DCoB-Scheduler/api"
+	. "github.com/smartystreets/goconvey/convey"
+	"testing"
+	"time"
+)
+
+func TestRetryPolicy_ShouldBackoffExponentiallyUntilMax(t *testing.T) {
+	Convey("given retry policy", t, func() {
+		policy := NewRetryPolicy(5, time.Second, 5*time.Second, TaskStatus_Error)
+
+		Convey("when calculate backoff", func() {
+			Convey("then delay doubled each attempt and limited by max backoff", func() {
+				So(policy.backoff(1), ShouldEqual, time.Second)
+				So(policy.backoff(2), ShouldEqual, 2*time.Second)
+				So(policy.backoff(3), ShouldEqual, 4*time.Second)
+				So(policy.backoff(4), ShouldEqual, 5*time.Second)
+			})
+		})
+	})
+}
+
+func TestRetryPolicy_ShouldRetryOnlyGivenStatusWithinMaxAttempts(t *testing.T) {
+	Convey("given retry policy", t, func() {
+		policy := NewRetryPolicy(2, time.Second, 5*time.Second, TaskStatus_Error)
+		task := &Task{Ctx: &Context{Status: TaskStatus_Error}}
+
+		Convey("when task failed first time", func() {
+			Convey("then should retry", func() {
+				So(policy.shouldRetry(task), ShouldBeTrue)
+			})
+		})
+
+		Convey("when task failed with status not retry on", func() {
+			task.Ctx.Status = TaskStatus_Interrupted
+
+			Convey("then should not retry", func() {
+				So(policy.shouldRetry(task), ShouldBeFalse)
+			})
+		})
+
+		Convey("when task run out of attempts", func() {
+			task.Attempt = 1
+
+			Convey("then should not retry", func() {
+				So(policy.shouldRetry(task), ShouldBeFalse)
+			})
+		})
+
+		Convey("when no policy", func() {
+			var nilPolicy *RetryPolicy
+
+			Convey("then should not retry", func() {
+				So(nilPolicy.shouldRetry(task), ShouldBeFalse)
+			})
+		})
+	})
+}
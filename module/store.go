@@ -1,16 +1,74 @@
 package module
 
 import (
+	"github.com/TD-Hackathon-2022/DCoB-Scheduler/api"
 	"sync"
 )
 
 type JobStore interface {
 	Store(job Job)
 	Load(jobId string) (job Job, exist bool)
+	SetState(jobId string, state JobState)
+	State(jobId string) (state JobState, exist bool)
+	// SetTaskState records the latest status of task issued by job
+	SetTaskState(jobId, taskId string, status api.TaskStatus)
+	TaskStates(jobId string) map[string]api.TaskStatus
+	Range(fn func(job Job) bool)
+	Close() error
+}
+
+// taskStates keeps the latest status of tasks by job id, version of job counts changes of its tasks,
+// zero value is ready to use
+type taskStates struct {
+	lock     sync.RWMutex
+	jobs     map[string]map[string]api.TaskStatus
+	versions map[string]int
+}
+
+func (t *taskStates) set(jobId, taskId string, status api.TaskStatus) {
+	t.lock.Lock()
+	defer t.lock.Unlock()
+	if t.jobs == nil {
+		t.jobs = make(map[string]map[string]api.TaskStatus)
+		t.versions = make(map[string]int)
+	}
+
+	tasks, exist := t.jobs[jobId]
+	if !exist {
+		tasks = make(map[string]api.TaskStatus)
+		t.jobs[jobId] = tasks
+	}
+	if old, exist := tasks[taskId]; !exist || old != status {
+		tasks[taskId] = status
+		t.versions[jobId]++
+	}
+}
+
+// get returns a copy of task states of job, nil if none recorded
+func (t *taskStates) get(jobId string) map[string]api.TaskStatus {
+	tasks, _ := t.versioned(jobId)
+	return tasks
+}
+
+func (t *taskStates) versioned(jobId string) (tasks map[string]api.TaskStatus, version int) {
+	t.lock.RLock()
+	defer t.lock.RUnlock()
+	current, exist := t.jobs[jobId]
+	if !exist {
+		return nil, 0
+	}
+
+	tasks = make(map[string]api.TaskStatus, len(current))
+	for taskId, status := range current {
+		tasks[taskId] = status
+	}
+	return tasks, t.versions[jobId]
 }
 
 type simpleStore struct {
 	innerMap sync.Map
+	stateMap sync.Map
+	tasks    taskStates
 }
 
 func (s *simpleStore) Store(job Job) {
@@ -26,6 +84,37 @@ func (s *simpleStore) Load(jobId string) (job Job, exist bool) {
 	return v.(Job), true
 }
 
+func (s *simpleStore) SetState(jobId string, state JobState) {
+	s.stateMap.Store(jobId, state)
+}
+
+func (s *simpleStore) State(jobId string) (state JobState, exist bool) {
+	v, exist := s.stateMap.Load(jobId)
+	if !exist {
+		return "", false
+	}
+
+	return v.(JobState), true
+}
+
+func (s *simpleStore) SetTaskState(jobId, taskId string, status api.TaskStatus) {
+	s.tasks.set(jobId, taskId, status)
+}
+
+func (s *simpleStore) TaskStates(jobId string) map[string]api.TaskStatus {
+	return s.tasks.get(jobId)
+}
+
+func (s *simpleStore) Range(fn func(job Job) bool) {
+	s.innerMap.Range(func(_, v interface{}) bool {
+		return fn(v.(Job))
+	})
+}
+
+func (s *simpleStore) Close() error {
+	return nil
+}
+
 func NewSimpleStore() JobStore {
 	return &simpleStore{}
 }
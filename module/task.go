@@ -1,18 +1,49 @@
 package module
 
-import "github.com/TD-Hackathon-2022/DCoB-Scheduler/api"
+import (
+	"github.com/TD-Hackathon-2022/DCoB-Scheduler/api"
+	"time"
+)
 
 type Task struct {
 	Id            string
 	JobId         string
 	Ctx           *Context
 	FuncId        string
+	MinCores      int
+	NeedsWasm     bool
 	UpdateHandler func(*Task)
+	LostHandler   func(*Task)
+	RetryPolicy   *RetryPolicy
+	// Verify checks result of finished task cheaply on scheduler, rejected result fails the task
+	Verify func(*Task) error
+	// Equivalent compares results of replicas, results are equivalent only if identical by default
+	Equivalent func(a, b Data) bool
+	// Replicas of task run on distinct workers if more than one, result is accepted once Quorum of them agree
+	Replicas   int
+	Quorum     int
+	Attempt    int
+	Priority   int
+	Weight     int
+	Timeout    time.Duration
+	poison     bool
+	funcCode   []byte
+	funcHash   string
+	assignedAt time.Time
+	trace      *taskTrace
+	workerId   string
+	principal  string
+	group      *replicaGroup
+	// seq and pass are bookkeeping of schedule policy, to put back popped task where it was
+	seq  uint64
+	pass float64
 }
 
 type Context struct {
 	Status           api.TaskStatus
-	InitData         interface{}
-	IntermediateData interface{}
-	FinalData        interface{}
+	InitData         Data
+	IntermediateData Data
+	FinalData        Data
+	// Progress of running task in [0, 1] reported by worker
+	Progress float32
 }
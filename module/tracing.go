@@ -0,0 +1,106 @@
+package module
+
+import (
+	"context"
+	"github.com/TD-Hackathon-2022/DCoB-Scheduler/api"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
+	"time"
+)
+
+var tracer = otel.Tracer("github.com/TD-Hackathon-2022/DCoB-Scheduler/module")
+
+const (
+	jobIdKey      = attribute.Key("dcob.job.id")
+	taskIdKey     = attribute.Key("dcob.task.id")
+	funcIdKey     = attribute.Key("dcob.func.id")
+	workerIdKey   = attribute.Key("dcob.worker.id")
+	slotKey       = attribute.Key("dcob.worker.slot")
+	attemptKey    = attribute.Key("dcob.task.attempt")
+	taskStatusKey = attribute.Key("dcob.task.status")
+	progressKey   = attribute.Key("dcob.task.progress")
+	jobStateKey   = attribute.Key("dcob.job.state")
+	replicasKey   = attribute.Key("dcob.task.replicas")
+)
+
+// taskTrace ties spans of task together: task span lasts until task ended after retries,
+// stage span is the current one of queue, schedule and run, restarted by every attempt
+type taskTrace struct {
+	ctx   context.Context
+	span  trace.Span
+	stage trace.Span
+}
+
+// startTaskTrace starts task span under job span of ctx, task begins with queue stage
+func startTaskTrace(ctx context.Context, task *Task) {
+	ctx, span := tracer.Start(ctx, "task", trace.WithAttributes(
+		jobIdKey.String(task.JobId), taskIdKey.String(task.Id), funcIdKey.String(task.FuncId)))
+	task.trace = &taskTrace{ctx: ctx, span: span}
+	task.traceStage("task.queue")
+}
+
+// traceContext is the task span's context, task created without job runner has none
+func (t *Task) traceContext() context.Context {
+	if t.trace == nil {
+		return context.Background()
+	}
+	return t.trace.ctx
+}
+
+// startSpan starts span under task span, it is a no-op span for task without trace
+func (t *Task) startSpan(name string, attrs ...attribute.KeyValue) trace.Span {
+	if t.trace == nil {
+		return trace.SpanFromContext(context.Background())
+	}
+
+	_, span := tracer.Start(t.trace.ctx, name, trace.WithAttributes(append(attrs, taskIdKey.String(t.Id))...))
+	return span
+}
+
+// traceSince records span under task span, which started at given time and ends now
+func (t *Task) traceSince(name string, start time.Time, attrs ...attribute.KeyValue) {
+	if t.trace == nil {
+		return
+	}
+
+	_, span := tracer.Start(t.trace.ctx, name, trace.WithTimestamp(start),
+		trace.WithAttributes(append(attrs, taskIdKey.String(t.Id))...))
+	span.End()
+}
+
+// traceStage ends current stage of task and starts the next one
+func (t *Task) traceStage(name string, attrs ...attribute.KeyValue) {
+	if t.trace == nil {
+		return
+	}
+
+	if t.trace.stage != nil {
+		t.trace.stage.End()
+	}
+	t.trace.stage = t.startSpan(name, append(attrs, attemptKey.Int(t.Attempt))...)
+}
+
+// endTrace ends task span with its final status
+func (t *Task) endTrace() {
+	if t.trace == nil {
+		return
+	}
+
+	if t.trace.stage != nil {
+		t.trace.stage.End()
+		t.trace.stage = nil
+	}
+
+	status := api.TaskStatus_Interrupted
+	if t.Ctx != nil {
+		status = t.Ctx.Status
+	}
+	t.trace.span.SetAttributes(taskStatusKey.String(status.String()), attemptKey.Int(t.Attempt))
+	if status == api.TaskStatus_Error {
+		t.trace.span.SetStatus(codes.Error, t.Ctx.IntermediateData.String())
+	}
+	t.trace.span.End()
+	t.trace = nil
+}
@@ -0,0 +1,49 @@
+package module
+
+import (
+	"context"
+	. "github.com/TD-Hackathon-2022/DCoB-Scheduler/api"
+	. "github.com/smartystreets/goconvey/convey"
+	"go.opentelemetry.io/otel"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+	"testing"
+)
+
+func TestTracing_ShouldTieTaskLifecycleSpansToJobSpan(t *testing.T) {
+	Convey("given task traced under job span", t, func() {
+		recorder := tracetest.NewSpanRecorder()
+		provider := sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(recorder))
+		otel.SetTracerProvider(provider)
+		defer provider.Shutdown(context.Background())
+
+		ctx, jobSpan := tracer.Start(context.Background(), "job")
+		task := &Task{Id: "traced-task", JobId: "traced-job", Ctx: &Context{InitData: Text("fake-data")},
+			UpdateHandler: func(task *Task) { task.endTrace() }}
+		startTaskTrace(ctx, task)
+
+		wp := NewWorkerPool()
+		outputCh := make(chan *Msg, 1)
+		_ = wp.Add("worker", outputCh, &RegisterPayload{ProtocolVersion: ProtocolVersion})
+
+		taskQ := make(chan *Task, 1)
+		taskQ <- task
+		go NewDecider(wp, taskQ).Start()
+		defer close(taskQ)
+		<-outputCh
+
+		Convey("when worker reports task finished", func() {
+			_ = wp.UpdateStatus("worker", &StatusPayload{TaskId: task.Id, TaskStatus: TaskStatus_Finished})
+			jobSpan.End()
+
+			Convey("then every stage is recorded in the job's trace", func() {
+				names := make([]string, 0)
+				for _, span := range recorder.Ended() {
+					So(span.SpanContext().TraceID(), ShouldEqual, jobSpan.SpanContext().TraceID())
+					names = append(names, span.Name())
+				}
+				So(names, ShouldResemble, []string{"task.queue", "task.schedule", "worker.assign", "task.run", "task", "worker.status", "job"})
+			})
+		})
+	})
+}
@@ -0,0 +1,229 @@
+package module
+
+import (
+	"bytes"
+	"fmt"
+	"github.com/TD-Hackathon-2022/DCoB-Scheduler/api"
+	"math/rand"
+	"strconv"
+	"sync"
+)
+
+// Verification runs share of tasks on Replicas distinct workers, result is accepted once Quorum of them agree,
+// quorum defaults to majority of replicas
+type Verification struct {
+	Share    float64
+	Replicas int
+	Quorum   int
+}
+
+// Verified is implemented by jobs whose results should be verified by redundant execution
+type Verified interface {
+	Verification() *Verification
+}
+
+// sampled tells whether a task is picked for redundant execution
+func (v *Verification) sampled() bool {
+	if v == nil || v.Replicas < 2 || v.Share <= 0 {
+		return false
+	}
+	return v.Share >= 1 || rand.Float64() < v.Share
+}
+
+func (v *Verification) quorum() int {
+	if v.Quorum > 0 && v.Quorum <= v.Replicas {
+		return v.Quorum
+	}
+	return v.Replicas/2 + 1
+}
+
+// vote is the result reported by workers agree with each other, workers are kept by principal to be judged
+type vote struct {
+	result  Data
+	workers []string
+}
+
+// replicaGroup runs replicas of task on distinct workers, and delivers the result agreed by quorum as task's,
+// workers agree with quorum are rewarded, workers disagree are penalized
+type replicaGroup struct {
+	lock        sync.Mutex
+	task        *Task
+	replicas    []*Task
+	quorum      int
+	reputation  *Reputation
+	principals  map[string]bool
+	votes       []*vote
+	agreed      *vote
+	ended       int
+	lastFailure *Task
+	delivered   bool
+}
+
+// replicate splits task into replicas sharing its input, each of them retried and re-dispatched on its own
+func replicate(task *Task, reputation *Reputation) *replicaGroup {
+	g := &replicaGroup{
+		task:       task,
+		quorum:     (&Verification{Replicas: task.Replicas, Quorum: task.Quorum}).quorum(),
+		reputation: reputation,
+		principals: make(map[string]bool),
+	}
+
+	for i := 0; i < task.Replicas; i++ {
+		replica := &Task{
+			Id:            task.Id + "-replica-" + strconv.Itoa(i+1),
+			JobId:         task.JobId,
+			Ctx:           &Context{Status: task.Ctx.Status, InitData: task.Ctx.InitData},
+			FuncId:        task.FuncId,
+			MinCores:      task.MinCores,
+			NeedsWasm:     task.NeedsWasm,
+			LostHandler:   task.LostHandler,
+			RetryPolicy:   task.RetryPolicy,
+			Priority:      task.Priority,
+			Weight:        task.Weight,
+			Timeout:       task.Timeout,
+			Verify:        task.Verify,
+			Equivalent:    task.Equivalent,
+			funcCode:      task.funcCode,
+			funcHash:      task.funcHash,
+			group:         g,
+			UpdateHandler: g.update,
+		}
+		g.replicas = append(g.replicas, replica)
+	}
+	return g
+}
+
+// ranOn tells whether any replica has been assigned to worker of principal, nil group never ran,
+// workers registered by one client share principal, so that it never runs two replicas of task
+func (g *replicaGroup) ranOn(principal string) bool {
+	if g == nil {
+		return false
+	}
+
+	g.lock.Lock()
+	defer g.lock.Unlock()
+	return g.principals[principal]
+}
+
+func (g *replicaGroup) assigned(principal string) {
+	g.lock.Lock()
+	defer g.lock.Unlock()
+	g.principals[principal] = true
+}
+
+// update collects status of replica, running progress is forwarded until result delivered
+func (g *replicaGroup) update(replica *Task) {
+	g.lock.Lock()
+	defer g.lock.Unlock()
+
+	switch replica.Ctx.Status {
+	case api.TaskStatus_Running:
+		if g.delivered {
+			return
+		}
+
+		if replica.Ctx.Progress > g.task.Ctx.Progress {
+			g.task.Ctx.Progress = replica.Ctx.Progress
+		}
+		g.task.Ctx.Status = api.TaskStatus_Running
+		g.task.Ctx.IntermediateData = replica.Ctx.IntermediateData
+		g.task.UpdateHandler(g.task)
+		return
+	case api.TaskStatus_Finished:
+		g.vote(replica)
+	default:
+		g.lastFailure = replica
+	}
+
+	g.ended++
+	replica.endTrace()
+	g.settle()
+}
+
+func (g *replicaGroup) vote(replica *Task) {
+	result := replica.Ctx.FinalData
+	if g.agreed != nil {
+		// late replica is judged by the agreed result
+		if g.equivalent(g.agreed.result, result) {
+			g.reputation.Reward(replica.principal)
+		} else {
+			g.reputation.Penalize(replica.principal, "result of "+replica.Id+" disagrees with quorum")
+		}
+		return
+	}
+
+	for _, v := range g.votes {
+		if g.equivalent(v.result, result) {
+			v.workers = append(v.workers, replica.principal)
+			return
+		}
+	}
+	g.votes = append(g.votes, &vote{result: result, workers: []string{replica.principal}})
+}
+
+func (g *replicaGroup) equivalent(a, b Data) bool {
+	if g.task.Equivalent != nil {
+		return g.task.Equivalent(a, b)
+	}
+	return a.ContentType == b.ContentType && bytes.Equal(a.Bytes, b.Bytes)
+}
+
+// settle delivers agreed result once quorum reached, or failure once quorum can never be reached
+func (g *replicaGroup) settle() {
+	if g.delivered {
+		return
+	}
+
+	var best *vote
+	for _, v := range g.votes {
+		if best == nil || len(v.workers) > len(best.workers) {
+			best = v
+		}
+	}
+
+	if best != nil && len(best.workers) >= g.quorum {
+		g.agreed = best
+		for _, v := range g.votes {
+			for _, principal := range v.workers {
+				if v == best {
+					g.reputation.Reward(principal)
+				} else {
+					g.reputation.Penalize(principal, "result of "+g.task.Id+" disagrees with quorum")
+				}
+			}
+		}
+
+		observeVerification(g.task, "agreed")
+		g.deliver(api.TaskStatus_Finished, best.result, Data{})
+		return
+	}
+
+	agreeing := 0
+	if best != nil {
+		agreeing = len(best.workers)
+	}
+	if agreeing+len(g.replicas)-g.ended >= g.quorum {
+		return
+	}
+
+	if len(g.votes) > 1 {
+		observeVerification(g.task, "disagreed")
+		g.deliver(api.TaskStatus_Error, Data{}, Text(fmt.Sprintf("%d different results, no %d of %d replicas agree",
+			len(g.votes), g.quorum, len(g.replicas))))
+		return
+	}
+
+	// too many replicas failed, task fails as the last one
+	g.deliver(g.lastFailure.Ctx.Status, Data{}, g.lastFailure.Ctx.IntermediateData)
+}
+
+func (g *replicaGroup) deliver(status api.TaskStatus, result Data, intermediate Data) {
+	g.delivered = true
+	g.task.Ctx.Status = status
+	g.task.Ctx.FinalData = result
+	g.task.Ctx.IntermediateData = intermediate
+	if status == api.TaskStatus_Finished {
+		g.task.Ctx.Progress = 1
+	}
+	g.task.UpdateHandler(g.task)
+}
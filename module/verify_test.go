@@ -0,0 +1,338 @@
+package module
+
+import (
+	. "github.com/TD-Hackathon-2022/DCoB-Scheduler/api"
+	"github.com/pkg/errors"
+	. "github.com/smartystreets/goconvey/convey"
+	"strings"
+	"testing"
+	"time"
+)
+
+func newVerifiedTask(replicas, quorum int, updates *[]Context) *Task {
+	return &Task{
+		Id:       "fake-task",
+		JobId:    "fake-job-id",
+		Ctx:      &Context{Status: TaskStatus_Running, InitData: Text("fake-data")},
+		FuncId:   "fake-func-id",
+		Replicas: replicas,
+		Quorum:   quorum,
+		UpdateHandler: func(task *Task) {
+			*updates = append(*updates, *task.Ctx)
+		},
+	}
+}
+
+// report ends replica as if reported by worker
+func report(replica *Task, workerId string, status TaskStatus, result Data) {
+	replica.workerId = workerId
+	replica.principal = workerId
+	replica.Ctx.Status = status
+	replica.Ctx.FinalData = result
+	replica.UpdateHandler(replica)
+}
+
+func TestReplicaGroup_ShouldDeliverResultAgreedByQuorum(t *testing.T) {
+	Convey("given task replicated on 3 workers with quorum of 2", t, func() {
+		updates := make([]Context, 0)
+		reputation := NewReputation(DefaultMinReputation)
+		g := replicate(newVerifiedTask(3, 2, &updates), reputation)
+
+		Convey("when two of them agree", func() {
+			report(g.replicas[0], "w1", TaskStatus_Finished, Text("42"))
+			report(g.replicas[1], "w2", TaskStatus_Finished, Text("43"))
+			settledBefore := len(updates)
+			report(g.replicas[2], "w3", TaskStatus_Finished, Text("42"))
+
+			Convey("then agreed result delivered and dissenter penalized", func() {
+				So(settledBefore, ShouldEqual, 0)
+				So(len(updates), ShouldEqual, 1)
+				So(updates[0].Status, ShouldEqual, TaskStatus_Finished)
+				So(updates[0].FinalData, ShouldResemble, Text("42"))
+				So(updates[0].Progress, ShouldEqual, 1)
+				So(reputation.Score("w1"), ShouldEqual, 1)
+				So(reputation.Score("w3"), ShouldEqual, 1)
+				So(reputation.Score("w2"), ShouldEqual, 0.5)
+			})
+		})
+
+		Convey("when quorum reached before the last replica ends", func() {
+			report(g.replicas[0], "w1", TaskStatus_Finished, Text("42"))
+			report(g.replicas[1], "w2", TaskStatus_Finished, Text("42"))
+			report(g.replicas[2], "w3", TaskStatus_Finished, Text("43"))
+
+			Convey("then result delivered once and late dissenter penalized", func() {
+				So(len(updates), ShouldEqual, 1)
+				So(updates[0].FinalData, ShouldResemble, Text("42"))
+				So(reputation.Score("w3"), ShouldEqual, 0.5)
+			})
+		})
+
+		Convey("when replicas report progress", func() {
+			g.replicas[0].Ctx.Progress = 0.5
+			report(g.replicas[0], "w1", TaskStatus_Running, Data{})
+			g.replicas[1].Ctx.Progress = 0.2
+			report(g.replicas[1], "w2", TaskStatus_Running, Data{})
+
+			Convey("then the furthest progress forwarded", func() {
+				So(len(updates), ShouldEqual, 2)
+				So(updates[1].Status, ShouldEqual, TaskStatus_Running)
+				So(updates[1].Progress, ShouldEqual, 0.5)
+			})
+		})
+	})
+}
+
+func TestReplicaGroup_ShouldFailWhenQuorumUnreachable(t *testing.T) {
+	Convey("given task replicated on 2 workers with quorum of 2", t, func() {
+		updates := make([]Context, 0)
+		reputation := NewReputation(DefaultMinReputation)
+		g := replicate(newVerifiedTask(2, 0, &updates), reputation)
+
+		Convey("when results disagree", func() {
+			report(g.replicas[0], "w1", TaskStatus_Finished, Text("42"))
+			report(g.replicas[1], "w2", TaskStatus_Finished, Text("43"))
+
+			Convey("then task fails without judging anyone", func() {
+				So(len(updates), ShouldEqual, 1)
+				So(updates[0].Status, ShouldEqual, TaskStatus_Error)
+				So(string(updates[0].IntermediateData.Bytes), ShouldContainSubstring, "no 2 of 2 replicas agree")
+				So(reputation.Score("w1"), ShouldEqual, 1)
+				So(reputation.Score("w2"), ShouldEqual, 1)
+			})
+		})
+
+		Convey("when one replica fails", func() {
+			g.replicas[0].Ctx.IntermediateData = Text("out of memory")
+			report(g.replicas[0], "w1", TaskStatus_Error, Data{})
+
+			Convey("then task fails as the replica", func() {
+				So(len(updates), ShouldEqual, 1)
+				So(updates[0].Status, ShouldEqual, TaskStatus_Error)
+				So(updates[0].IntermediateData, ShouldResemble, Text("out of memory"))
+			})
+		})
+	})
+
+	Convey("given replicas with custom equivalence", t, func() {
+		updates := make([]Context, 0)
+		task := newVerifiedTask(2, 2, &updates)
+		task.Equivalent = func(a, b Data) bool {
+			return strings.EqualFold(string(a.Bytes), string(b.Bytes))
+		}
+		g := replicate(task, NewReputation(DefaultMinReputation))
+
+		Convey("when results equivalent but not identical", func() {
+			report(g.replicas[0], "w1", TaskStatus_Finished, Text("abc"))
+			report(g.replicas[1], "w2", TaskStatus_Finished, Text("ABC"))
+
+			Convey("then the first result delivered", func() {
+				So(updates[0].Status, ShouldEqual, TaskStatus_Finished)
+				So(updates[0].FinalData, ShouldResemble, Text("abc"))
+			})
+		})
+	})
+}
+
+func TestDecider_ShouldRunReplicasOnDistinctTrustedWorkers(t *testing.T) {
+	Convey("given decider with two trusted workers and an untrusted one", t, func() {
+		wp := NewWorkerPool()
+		outputs := make(map[string]chan *Msg)
+		for _, id := range []string{"trusted-1", "trusted-2", "untrusted"} {
+			outputs[id] = make(chan *Msg, 2)
+			_ = wp.Add(id, outputs[id], &RegisterPayload{Slots: 2, FuncIds: []string{"fake-func-id"}, ProtocolVersion: ProtocolVersion})
+		}
+		for i := 0; i < 3; i++ {
+			wp.reputation.Penalize("untrusted", "test")
+		}
+
+		updates := make([]Context, 0)
+		taskQ := make(chan *Task, 1)
+		taskQ <- newVerifiedTask(3, 2, &updates)
+		decider := NewDecider(wp, taskQ)
+		go decider.Start()
+		defer close(taskQ)
+
+		Convey("when decider start", func() {
+			first := <-outputs["trusted-1"]
+			second := <-outputs["trusted-2"]
+			time.Sleep(50 * time.Millisecond)
+
+			Convey("then each trusted worker runs one replica, the last one waits", func() {
+				So(first.GetAssign().TaskId, ShouldStartWith, "fake-task-replica-")
+				So(second.GetAssign().TaskId, ShouldStartWith, "fake-task-replica-")
+				So(first.GetAssign().TaskId, ShouldNotEqual, second.GetAssign().TaskId)
+				So(len(outputs["trusted-1"]), ShouldEqual, 0)
+				So(len(outputs["trusted-2"]), ShouldEqual, 0)
+				So(len(outputs["untrusted"]), ShouldEqual, 0)
+			})
+		})
+	})
+}
+
+func TestDecider_ShouldRunReplicasOnWorkersOfDistinctPrincipals(t *testing.T) {
+	Convey("given decider with two workers of same principal and another one", t, func() {
+		wp := NewWorkerPool()
+		outputs := make(map[string]chan *Msg)
+		for id, principal := range map[string]string{"alice-1": "token:alice", "alice-2": "token:alice", "bob": "token:bob"} {
+			outputs[id] = make(chan *Msg, 2)
+			_ = wp.Add(id, outputs[id], &RegisterPayload{FuncIds: []string{"fake-func-id"}, ProtocolVersion: ProtocolVersion},
+				WithPrincipal(principal))
+		}
+
+		updates := make([]Context, 0)
+		taskQ := make(chan *Task, 1)
+		taskQ <- newVerifiedTask(3, 2, &updates)
+		decider := NewDecider(wp, taskQ)
+		go decider.Start()
+		defer close(taskQ)
+
+		Convey("when decider start", func() {
+			bob := <-outputs["bob"]
+			time.Sleep(50 * time.Millisecond)
+
+			Convey("then each principal runs one replica, no matter how many workers it registered", func() {
+				So(bob.GetAssign().TaskId, ShouldStartWith, "fake-task-replica-")
+				So(len(outputs["alice-1"])+len(outputs["alice-2"]), ShouldEqual, 1)
+			})
+		})
+	})
+}
+
+func TestDecider_ShouldFailTaskAndPenalizeWorkerWhenResultRejected(t *testing.T) {
+	Convey("given decider and task with verifier", t, func() {
+		var notified *Task
+		task := &Task{
+			Id:     "fake-task",
+			JobId:  "fake-job-id",
+			Ctx:    &Context{Status: TaskStatus_Running, InitData: Text("fake-data")},
+			FuncId: "fake-func-id",
+			Verify: func(task *Task) error {
+				if string(task.Ctx.FinalData.Bytes) != "42" {
+					return errors.New("not the answer")
+				}
+				return nil
+			},
+			UpdateHandler: func(task *Task) {
+				notified = task
+			},
+		}
+
+		wp := NewWorkerPool()
+		decider := NewDecider(wp, nil)
+		s := newTestSlot("127.0.0.1:8081", WorkerStatus_Busy, &task.JobId, task, nil)
+
+		Convey("when worker reports bad result", func() {
+			decider.statusNotify(s, &StatusPayload{TaskStatus: TaskStatus_Finished, ExecResult: "43"})
+
+			Convey("then task fails and worker penalized", func() {
+				So(notified.Ctx.Status, ShouldEqual, TaskStatus_Error)
+				So(notified.Ctx.FinalData.Bytes, ShouldBeEmpty)
+				So(string(notified.Ctx.IntermediateData.Bytes), ShouldEqual, "not the answer")
+				So(wp.reputation.Score(s.wkr.id), ShouldEqual, 0.5)
+			})
+		})
+
+		Convey("when worker reports good result", func() {
+			decider.statusNotify(s, &StatusPayload{TaskStatus: TaskStatus_Finished, ExecResult: "42"})
+
+			Convey("then task finished", func() {
+				So(notified.Ctx.Status, ShouldEqual, TaskStatus_Finished)
+				So(wp.reputation.Score(s.wkr.id), ShouldEqual, 1)
+			})
+		})
+	})
+}
+
+func TestReputation_ShouldDistrustPenalizedWorker(t *testing.T) {
+	Convey("given reputation with threshold", t, func() {
+		r := NewReputation(0.3)
+
+		Convey("when worker penalized twice then rewarded", func() {
+			r.Penalize("w1", "test")
+			r.Penalize("w1", "test")
+			distrusted := !r.Trusted("w1")
+			r.Reward("w1")
+
+			Convey("then it recovers a tenth of lost score", func() {
+				So(distrusted, ShouldBeTrue)
+				So(r.Score("w1"), ShouldAlmostEqual, 0.325)
+				So(r.Trusted("w1"), ShouldBeTrue)
+				So(r.Trusted("unknown"), ShouldBeTrue)
+			})
+		})
+	})
+}
+
+func TestVerification_ShouldSampleShareOfTasks(t *testing.T) {
+	Convey("given verifications", t, func() {
+		Convey("then only replicated share sampled, quorum defaults to majority", func() {
+			So((*Verification)(nil).sampled(), ShouldBeFalse)
+			So((&Verification{Share: 1, Replicas: 1}).sampled(), ShouldBeFalse)
+			So((&Verification{Share: 0, Replicas: 3}).sampled(), ShouldBeFalse)
+			So((&Verification{Share: 1, Replicas: 3}).sampled(), ShouldBeTrue)
+			So((&Verification{Replicas: 3}).quorum(), ShouldEqual, 2)
+			So((&Verification{Replicas: 4, Quorum: 5}).quorum(), ShouldEqual, 3)
+			So((&Verification{Replicas: 4, Quorum: 4}).quorum(), ShouldEqual, 4)
+		})
+	})
+}
+
+func TestWorkerPool_ShouldKeepReputationByPrincipal(t *testing.T) {
+	Convey("given worker penalized under principal of its token", t, func() {
+		wp := NewWorkerPool()
+		_ = wp.Add("w1", make(chan *Msg, 1), &RegisterPayload{}, WithPrincipal("token:abc"))
+		for i := 0; i < 3; i++ {
+			wp.reputation.Penalize("token:abc", "test")
+		}
+
+		Convey("when the same client registers as another worker id", func() {
+			_ = wp.Add("w2", make(chan *Msg, 1), &RegisterPayload{}, WithPrincipal("token:abc"))
+			_ = wp.Add("w3", make(chan *Msg, 1), &RegisterPayload{})
+
+			Convey("then it inherits the reputation, worker without principal is kept by its id", func() {
+				workers := wp.ListWorkers()
+				So(workers, ShouldHaveLength, 3)
+				for _, info := range workers {
+					if info.Id == "w3" {
+						So(info.Principal, ShouldEqual, "w3")
+						So(info.Reputation, ShouldEqual, 1)
+						continue
+					}
+					So(info.Principal, ShouldEqual, "token:abc")
+					So(info.Reputation, ShouldEqual, 0.125)
+				}
+			})
+		})
+	})
+}
+
+func TestReputation_ShouldRecoverByTimeOrReset(t *testing.T) {
+	Convey("given reputation with half life of an hour", t, func() {
+		now := time.Now()
+		r := NewReputation(0.3)
+		r.halfLife = time.Hour
+		r.now = func() time.Time { return now }
+
+		Convey("when worker penalized twice", func() {
+			r.Penalize("w1", "test")
+			r.Penalize("w1", "test")
+			distrusted := !r.Trusted("w1")
+
+			Convey("then half of lost score recovers an hour later", func() {
+				now = now.Add(time.Hour)
+				So(distrusted, ShouldBeTrue)
+				So(r.Score("w1"), ShouldAlmostEqual, 0.625)
+				So(r.Trusted("w1"), ShouldBeTrue)
+				So(r.Scores(), ShouldContainKey, "w1")
+			})
+
+			Convey("then reset restores it at once", func() {
+				So(r.Reset("w1"), ShouldBeTrue)
+				So(r.Score("w1"), ShouldEqual, 1)
+				So(r.Scores(), ShouldBeEmpty)
+				So(r.Reset("w1"), ShouldBeFalse)
+			})
+		})
+	})
+}
@@ -4,195 +4,622 @@ import (
 	"container/list"
 	"github.com/TD-Hackathon-2022/DCoB-Scheduler/api"
 	"github.com/pkg/errors"
+	"sort"
 	"sync"
 	"sync/atomic"
+	"time"
 	"unsafe"
 )
 
 var notOccupied = "not_occupied"
 var notAvailable = "not_available"
 
+// ProtocolVersion is the latest worker protocol version scheduler speaks, 0 means legacy worker without register payload
+const ProtocolVersion = 3
+
+// funcCacheProtocolVersion is the first protocol version that worker caches func by hash, and fetches code if missing
+const funcCacheProtocolVersion = 2
+
+// typedPayloadProtocolVersion is the first protocol version that task input and result are typed bytes
+const typedPayloadProtocolVersion = 3
+
+// ErrStaleStatus means status reported for task no longer assigned to worker, e.g. task already timeout
+var ErrStaleStatus = errors.New("stale task status")
+
+// ErrUnsupportedProtocol means worker registered with a protocol version newer than scheduler supports
+var ErrUnsupportedProtocol = errors.New("unsupported protocol version")
+
+// worker is a connected client, it runs up to len(slots) tasks concurrently
 type worker struct {
-	id           string
-	status       api.WorkerStatus
+	id string
+	// principal identifies client of worker for reputation, worker id by default
+	principal string
+	status    api.WorkerStatus
+	ch        chan *api.Msg
+	// chLock guards sending to ch, nothing is sent once detached, so that connection can close ch safely
+	chLock       sync.Mutex
+	detached     bool
+	reg          *api.RegisterPayload
+	slots        []*slot
+	closing      uint32
+	closeTimer   *time.Timer
+	connectedAt  time.Time
+	lastSeen     int64
+	completedCnt uint64
+	failedCnt    uint64
+}
+
+// slot is the unit of task assignment, each slot of worker runs one task at a time
+type slot struct {
+	wkr          *worker
+	index        int
 	occupiedBy   *string
 	task         *Task
-	ch           chan *api.Msg
-	statusNotify func(*worker, *api.StatusPayload)
-	exitNotify   func(*worker)
+	statusNotify func(*slot, *api.StatusPayload)
+	exitNotify   func(*slot)
+	taskLock     sync.Mutex
+	taskTimer    *time.Timer
 }
 
-func (w *worker) atomicGetOccupiedBy() *string {
-	return (*string)(atomic.LoadPointer((*unsafe.Pointer)(unsafe.Pointer(&w.occupiedBy))))
+type WorkerInfo struct {
+	Id            string      `json:"id"`
+	Status        string      `json:"status"`
+	Slots         int         `json:"slots"`
+	Tasks         []*SlotInfo `json:"tasks,omitempty"`
+	ConnectedAt   time.Time   `json:"connectedAt"`
+	LastHeartbeat time.Time   `json:"lastHeartbeat"`
+	Completed     uint64      `json:"completed"`
+	Failed        uint64      `json:"failed"`
+	UserAgent     string      `json:"userAgent,omitempty"`
+	Cores         uint32      `json:"cores,omitempty"`
+	Memory        uint64      `json:"memory,omitempty"`
+	FuncIds       []string    `json:"funcIds,omitempty"`
+	Wasm          bool        `json:"wasm"`
+	Protocol      uint32      `json:"protocolVersion"`
+	Principal     string      `json:"principal"`
+	Reputation    float64     `json:"reputation"`
 }
 
-func (w *worker) assign(t *Task, notify func(*worker, *api.StatusPayload), exitNotify func(*worker)) (success bool) {
-	occupiedBy := w.atomicGetOccupiedBy()
-	if occupiedBy == &notOccupied || *occupiedBy != t.JobId || w.task != nil {
+type SlotInfo struct {
+	Slot   int    `json:"slot"`
+	JobId  string `json:"jobId"`
+	TaskId string `json:"taskId,omitempty"`
+}
+
+type WorkerOption func(w *worker)
+
+// WithPrincipal keeps reputation of worker by principal of its client, e.g. its admission token,
+// so that reputation is not cleared by registering as another worker id
+func WithPrincipal(principal string) WorkerOption {
+	return func(w *worker) {
+		if principal != "" {
+			w.principal = principal
+		}
+	}
+}
+
+// newWorker creates worker with the number of slots it advertised, at least one
+func newWorker(id string, ch chan *api.Msg, reg *api.RegisterPayload, opts ...WorkerOption) *worker {
+	wkr := &worker{
+		id:          id,
+		principal:   id,
+		status:      api.WorkerStatus_Idle,
+		ch:          ch,
+		reg:         reg,
+		connectedAt: time.Now(),
+	}
+	for _, opt := range opts {
+		opt(wkr)
+	}
+
+	slotCnt := int(reg.GetSlots())
+	if slotCnt <= 0 {
+		slotCnt = 1
+	}
+
+	wkr.slots = make([]*slot, slotCnt)
+	for i := range wkr.slots {
+		wkr.slots[i] = &slot{wkr: wkr, index: i, occupiedBy: &notOccupied}
+	}
+	wkr.touch()
+	return wkr
+}
+
+func (w *worker) touch() {
+	atomic.StoreInt64(&w.lastSeen, time.Now().UnixNano())
+}
+
+func (w *worker) info() *WorkerInfo {
+	info := &WorkerInfo{
+		Id:            w.id,
+		Status:        w.status.String(),
+		Slots:         len(w.slots),
+		ConnectedAt:   w.connectedAt,
+		LastHeartbeat: time.Unix(0, atomic.LoadInt64(&w.lastSeen)),
+		Completed:     atomic.LoadUint64(&w.completedCnt),
+		Failed:        atomic.LoadUint64(&w.failedCnt),
+		UserAgent:     w.reg.GetUserAgent(),
+		Cores:         w.reg.GetCores(),
+		Memory:        w.reg.GetMemory(),
+		FuncIds:       w.reg.GetFuncIds(),
+		Wasm:          w.reg.GetWasm(),
+		Protocol:      w.reg.GetProtocolVersion(),
+		Principal:     w.principal,
+	}
+
+	for _, s := range w.slots {
+		if !s.busy() {
+			continue
+		}
+
+		slotInfo := &SlotInfo{Slot: s.index, JobId: *s.atomicGetOccupiedBy()}
+		if task := s.task; task != nil {
+			slotInfo.TaskId = task.Id
+		}
+		info.Tasks = append(info.Tasks, slotInfo)
+	}
+	return info
+}
+
+// busy tells whether any slot of worker is occupied by job
+func (w *worker) busy() bool {
+	for _, s := range w.slots {
+		if s.busy() {
+			return true
+		}
+	}
+	return false
+}
+
+// send delivers msg to worker unless it is detached from its connection
+func (w *worker) send(msg *api.Msg) (sent bool) {
+	w.chLock.Lock()
+	defer w.chLock.Unlock()
+	if w.detached {
 		return false
 	}
 
-	w.statusNotify = notify
-	w.exitNotify = exitNotify
-	w.task = t
+	w.ch <- msg
+	return true
+}
+
+// detach stops sending to worker, it is called once worker removed from pool, before connection closes its channel
+func (w *worker) detach() {
+	w.chLock.Lock()
+	w.detached = true
+	w.chLock.Unlock()
+}
+
+// ackClose tells closing worker it is closed, it is the last msg sent to worker
+func (w *worker) ackClose() {
+	w.chLock.Lock()
+	defer w.chLock.Unlock()
+	if w.detached {
+		return
+	}
+
 	w.ch <- &api.Msg{
-		Cmd: api.CMD_Assign,
-		Payload: &api.Msg_Assign{
-			Assign: &api.AssignPayload{
-				TaskId: t.Id,
-				Data:   t.Ctx.InitData.(string),
-				FuncId: t.FuncId,
-			},
-		},
+		Cmd:     api.CMD_Close,
+		Payload: &api.Msg_Empty{Empty: &api.EmptyPayload{}},
+	}
+	w.detached = true
+}
+
+func (w *worker) isClosing() bool {
+	return atomic.LoadUint32(&w.closing) == 1
+}
+
+// canRun tells whether worker advertised capabilities required by task,
+// legacy worker registered without protocol version advertises nothing, so it is assumed to run any func
+func (w *worker) canRun(t *Task) bool {
+	if w.reg.GetProtocolVersion() < typedPayloadProtocolVersion && t.Ctx != nil && !t.Ctx.InitData.Textual() {
+		// binary input can not be sent as string
+		return false
+	}
+
+	if w.reg.GetProtocolVersion() == 0 {
+		return t.MinCores <= 0 && !t.NeedsWasm
+	}
+
+	if t.MinCores > 0 && int(w.reg.GetCores()) < t.MinCores {
+		return false
+	}
+
+	if t.NeedsWasm {
+		// WASM func is shipped along with task, supporting WASM is enough
+		return w.reg.GetWasm()
+	}
+
+	if t.FuncId == "" {
+		return true
+	}
+
+	for _, funcId := range w.reg.GetFuncIds() {
+		if funcId == t.FuncId {
+			return true
+		}
+	}
+	return false
+}
+
+func (w *worker) moribund() {
+	for _, s := range w.slots {
+		s.moribund()
+	}
+}
+
+func (s *slot) atomicGetOccupiedBy() *string {
+	return (*string)(atomic.LoadPointer((*unsafe.Pointer)(unsafe.Pointer(&s.occupiedBy))))
+}
+
+func (s *slot) assign(t *Task, notify func(*slot, *api.StatusPayload), exitNotify func(*slot)) (success bool) {
+	occupiedBy := s.atomicGetOccupiedBy()
+	if occupiedBy == &notOccupied || *occupiedBy != t.JobId || s.task != nil {
+		return false
+	}
+
+	span := t.startSpan("worker.assign", workerIdKey.String(s.wkr.id), slotKey.Int(s.index))
+	defer span.End()
+
+	assign := &api.AssignPayload{
+		TaskId:   t.Id,
+		FuncId:   t.FuncId,
+		FuncHash: t.funcHash,
+	}
+	if s.wkr.reg.GetProtocolVersion() < typedPayloadProtocolVersion {
+		assign.Data = string(t.Ctx.InitData.Bytes)
+	} else {
+		assign.Input = t.Ctx.InitData.toPayload()
+	}
+	if s.wkr.reg.GetProtocolVersion() < funcCacheProtocolVersion {
+		// worker without func cache needs code every time
+		assign.FuncCode = t.funcCode
+	}
+
+	s.statusNotify = notify
+	s.exitNotify = exitNotify
+	s.task = t
+	if !s.wkr.send(&api.Msg{Cmd: api.CMD_Assign, Payload: &api.Msg_Assign{Assign: assign}}) {
+		// worker removed since occupied
+		s.task = nil
+		return false
 	}
 	return true
 }
 
-func (w *worker) interrupt() {
-	w.ch <- &api.Msg{
+// interrupt asks worker to interrupt task on slot, caller should hold taskLock
+func (s *slot) interrupt() {
+	s.wkr.send(&api.Msg{
 		Cmd: api.CMD_Interrupt,
 		Payload: &api.Msg_Interrupt{
 			Interrupt: &api.InterruptPayload{
-				TaskId: w.task.Id,
+				TaskId: s.task.Id,
 			},
 		},
-	}
+	})
 }
 
-func (w *worker) occupied() bool {
-	return w.atomicGetOccupiedBy() != &notOccupied
+func (s *slot) occupied() bool {
+	return s.atomicGetOccupiedBy() != &notOccupied
 }
 
-func (w *worker) occupy(jobId string) (success bool) {
-	// TODO: consider closing status
+// busy tells whether slot is occupied by job, rather than free or removed
+func (s *slot) busy() bool {
+	occupiedBy := s.atomicGetOccupiedBy()
+	return occupiedBy != &notOccupied && *occupiedBy != notAvailable
+}
+
+func (s *slot) occupy(jobId string) (success bool) {
 	return atomic.CompareAndSwapPointer(
-		(*unsafe.Pointer)(unsafe.Pointer(&w.occupiedBy)),
+		(*unsafe.Pointer)(unsafe.Pointer(&s.occupiedBy)),
 		unsafe.Pointer(&notOccupied),
 		unsafe.Pointer(&jobId))
 }
 
-func (w *worker) release() {
-	w.task = nil
-	atomic.StorePointer((*unsafe.Pointer)(unsafe.Pointer(&w.occupiedBy)), unsafe.Pointer(&notOccupied))
+func (s *slot) release() {
+	s.task = nil
+	atomic.StorePointer((*unsafe.Pointer)(unsafe.Pointer(&s.occupiedBy)), unsafe.Pointer(&notOccupied))
 }
 
-func (w *worker) moribund() {
-	atomic.StorePointer((*unsafe.Pointer)(unsafe.Pointer(&w.occupiedBy)), unsafe.Pointer(&notAvailable))
+func (s *slot) moribund() {
+	atomic.StorePointer((*unsafe.Pointer)(unsafe.Pointer(&s.occupiedBy)), unsafe.Pointer(&notAvailable))
 }
 
+const defaultCloseGracePeriod = 30 * time.Second
+
 type WorkerPool struct {
-	pool     map[string]*worker
-	freeList *list.List
-	lock     sync.RWMutex
-	freeCond *sync.Cond
+	pool             map[string]*worker
+	freeList         *list.List
+	lock             sync.RWMutex
+	freeCh           chan struct{}
+	closeGracePeriod time.Duration
+	reputation       *Reputation
 }
 
-func (w *WorkerPool) Add(id string, ch chan *api.Msg) {
-	w.lock.Lock()
-	defer w.lock.Unlock()
-	_, exist := w.pool[id]
-	if exist {
-		return
+type PoolOption func(w *WorkerPool)
+
+// WithCloseGracePeriod sets how long a closing worker can take to finish its running task
+func WithCloseGracePeriod(grace time.Duration) PoolOption {
+	return func(w *WorkerPool) {
+		w.closeGracePeriod = grace
 	}
+}
 
-	newWorker := &worker{
-		id:         id,
-		status:     api.WorkerStatus_Idle,
-		occupiedBy: &notOccupied,
-		ch:         ch,
+// WithMinReputation assigns no task to worker whose reputation falls under threshold, 0 trusts every worker
+func WithMinReputation(threshold float64) PoolOption {
+	return func(w *WorkerPool) {
+		w.reputation.threshold = threshold
+	}
+}
+
+// WithReputationHalfLife recovers half of reputation worker lost every half life, 0 means never
+func WithReputationHalfLife(halfLife time.Duration) PoolOption {
+	return func(w *WorkerPool) {
+		w.reputation.halfLife = halfLife
 	}
-	w.pool[id] = newWorker
-	w.freeList.PushFront(newWorker)
-	w.freeCond.Broadcast()
 }
 
-func (w *WorkerPool) Remove(id string) {
+// Add registers worker connected with given channel, worker id is stable across connections,
+// so that a reconnecting worker reclaims its identity, the stale connection's worker is removed then.
+func (w *WorkerPool) Add(id string, ch chan *api.Msg, reg *api.RegisterPayload, opts ...WorkerOption) error {
+	if reg.GetProtocolVersion() > ProtocolVersion {
+		return errors.Wrapf(ErrUnsupportedProtocol, "worker %s speaks protocol %d, latest supported %d", id, reg.GetProtocolVersion(), ProtocolVersion)
+	}
+
+	w.lock.RLock()
+	old, exist := w.pool[id]
+	w.lock.RUnlock()
+	if exist {
+		if old.ch == ch {
+			return nil
+		}
+
+		log.Infof("Worker %s reconnected, reclaim identity from stale connection", id)
+		w.remove(old)
+	}
+
+	newWorker := newWorker(id, ch, reg, opts...)
+
 	w.lock.Lock()
 	defer w.lock.Unlock()
+	if _, exist := w.pool[id]; exist {
+		return errors.Errorf("worker %s registered concurrently", id)
+	}
+
+	w.pool[id] = newWorker
+	for _, s := range newWorker.slots {
+		w.freeList.PushFront(s)
+	}
+	w.notifyFree()
+	return nil
+}
+
+// Remove removes the worker only if it is still bound to given channel, connection superseded by reconnect removes nothing
+func (w *WorkerPool) Remove(id string, ch chan *api.Msg) {
+	w.lock.RLock()
 	wkr, exist := w.pool[id]
+	w.lock.RUnlock()
+	if !exist || wkr.ch != ch {
+		return
+	}
+
+	w.remove(wkr)
+}
+
+// Evict removes the worker right now no matter which connection it is bound to, e.g. worker is banned,
+// its running tasks are re-dispatched
+func (w *WorkerPool) Evict(id string) bool {
+	w.lock.RLock()
+	wkr, exist := w.pool[id]
+	w.lock.RUnlock()
 	if !exist {
+		return false
+	}
+
+	w.remove(wkr)
+	return true
+}
+
+func (w *WorkerPool) remove(wkr *worker) {
+	w.lock.Lock()
+	if current, exist := w.pool[wkr.id]; !exist || current != wkr {
+		w.lock.Unlock()
 		return
 	}
 
-	// occupy with "not_available" to prevent from other goroutine try to apply this ready-to-close worker
-	if !wkr.occupy(notAvailable) {
-		// failed to occupy means this worker have been occupied by some job's task, notify to exit
-		wkr.exitNotify(wkr)
+	// occupy with "not_available" to prevent from other goroutine try to apply slots of this ready-to-close worker
+	occupiedSlots := make([]*slot, 0, len(wkr.slots))
+	for _, s := range wkr.slots {
+		if !s.occupy(notAvailable) && s.busy() {
+			occupiedSlots = append(occupiedSlots, s)
+		}
 	}
 
 	// now the worker can be safe delete
-	delete(w.pool, id)
+	delete(w.pool, wkr.id)
 
-	// no need to clear free list, we can eliminate it when the "not available" worker be applied
+	// no need to clear free list, we can eliminate it when the "not available" slot be applied
 	wkr.moribund()
+	w.lock.Unlock()
+	wkr.detach()
+
+	for _, s := range occupiedSlots {
+		// failed to occupy means this slot have been occupied by some job's task, notify to exit
+		// outside of pool lock, since it may wait for task timeout in progress
+		s.taskLock.Lock()
+		if s.exitNotify != nil {
+			s.exitNotify(s)
+		}
+		s.taskLock.Unlock()
+	}
 }
 
-func (w *WorkerPool) apply(jobId string) (wkr *worker, found bool) {
+// Close drains the worker gracefully: no more task assigned, and it is removed once running tasks ended,
+// or the tasks are interrupted and re-dispatched if not ended within grace period
+func (w *WorkerPool) Close(id string) {
+	w.lock.Lock()
+	wkr, exist := w.pool[id]
+	if !exist || !atomic.CompareAndSwapUint32(&wkr.closing, 0, 1) {
+		w.lock.Unlock()
+		return
+	}
+
+	wkr.status = api.WorkerStatus_Closing
+	for _, s := range wkr.slots {
+		// free slot is never applied again
+		s.occupy(notAvailable)
+	}
+
+	if !wkr.busy() {
+		// idle worker can be removed right now
+		w.lock.Unlock()
+		w.dismiss(wkr)
+		return
+	}
+
+	wkr.closeTimer = time.AfterFunc(w.closeGracePeriod, func() { w.forceClose(wkr) })
+	w.lock.Unlock()
+}
+
+// dismiss acks closing worker then removes it, ack is sent outside of pool lock and before removal, so that it is
+// skipped if connection exited meanwhile, rather than sent on channel closed by connection
+func (w *WorkerPool) dismiss(wkr *worker) {
+	wkr.ackClose()
+
 	w.lock.Lock()
 	defer w.lock.Unlock()
+	if current, exist := w.pool[wkr.id]; exist && current == wkr {
+		delete(w.pool, wkr.id)
+		wkr.moribund()
+	}
+}
 
-	for {
-		if w.freeList.Len() == 0 {
-			return nil, false
-		}
+func (w *WorkerPool) forceClose(wkr *worker) {
+	w.lock.RLock()
+	current, exist := w.pool[wkr.id]
+	w.lock.RUnlock()
+	if !exist || current != wkr {
+		return
+	}
 
-		wkr := w.chooseFreeWorker(jobId)
-		if wkr == nil {
-			continue
+	for _, s := range wkr.slots {
+		s.taskLock.Lock()
+		if s.busy() && s.task != nil {
+			s.interrupt()
 		}
-
-		return wkr, true
+		s.taskLock.Unlock()
 	}
+
+	log.Infof("Worker %s not finished task within grace period, force closed", wkr.id)
+	wkr.ackClose()
+	w.remove(wkr)
 }
 
-func (w *WorkerPool) blockApply(jobId string) *worker {
+func (w *WorkerPool) apply(task *Task) (s *slot, found bool) {
 	w.lock.Lock()
 	defer w.lock.Unlock()
 
-	for {
-		if w.freeList.Len() == 0 {
-			w.freeCond.Wait()
-		}
+	s = w.chooseFreeSlot(task)
+	return s, s != nil
+}
 
-		wkr := w.chooseFreeWorker(jobId)
-		if wkr == nil {
-			continue
-		}
+// freed is signaled whenever a slot is put into free list, so that caller waiting for capable worker can retry
+func (w *WorkerPool) freed() <-chan struct{} {
+	return w.freeCh
+}
 
-		return wkr
+func (w *WorkerPool) notifyFree() {
+	select {
+	case w.freeCh <- struct{}{}:
+	default:
 	}
 }
 
-func (w *WorkerPool) chooseFreeWorker(jobId string) *worker {
-	e := w.freeList.Back()
-	if e == nil {
-		return nil
+// chooseFreeSlot occupies the longest idle slot of trusted worker capable to run the task, replicas of task are placed
+// on workers of distinct principals, slots of other workers are left free for other tasks, nil if there is no such one
+func (w *WorkerPool) chooseFreeSlot(task *Task) *slot {
+	for e := w.freeList.Back(); e != nil; {
+		prev := e.Prev()
+		s := e.Value.(*slot)
+		if *s.atomicGetOccupiedBy() == notAvailable || s.wkr.isClosing() {
+			// drop slot of worker that already removed or closing
+			w.freeList.Remove(e)
+		} else if w.suits(s.wkr, task) {
+			w.freeList.Remove(e)
+			if s.occupy(task.JobId) {
+				return s
+			}
+		}
+		e = prev
 	}
 
-	wkr := w.freeList.Remove(e).(*worker)
-	if *wkr.atomicGetOccupiedBy() == notAvailable {
-		// ignore worker that already removed
-		return nil
-	}
+	return nil
+}
+
+// suits tells whether worker is trusted and capable to run task, and no other replica of task ran on it
+func (w *WorkerPool) suits(wkr *worker, task *Task) bool {
+	return wkr.canRun(task) && w.reputation.Trusted(wkr.principal) && !task.group.ranOn(wkr.principal)
+}
 
-	if !wkr.occupy(jobId) {
-		return nil
+// capable tells whether any connected worker not closing suits task, no matter it is free or busy
+func (w *WorkerPool) capable(task *Task) bool {
+	w.lock.RLock()
+	defer w.lock.RUnlock()
+
+	for _, wkr := range w.pool {
+		if !wkr.isClosing() && w.suits(wkr, task) {
+			return true
+		}
 	}
+	return false
+}
 
-	return wkr
+// hasFree tells whether there may be free slot, slots of removed or closing worker are not dropped until applied
+func (w *WorkerPool) hasFree() bool {
+	w.lock.RLock()
+	defer w.lock.RUnlock()
+	return w.freeList.Len() > 0
 }
 
-func (w *WorkerPool) returnBack(wkr *worker) {
+func (w *WorkerPool) returnBack(s *slot) {
 	w.lock.Lock()
-	defer w.lock.Unlock()
 
-	wkr.status = api.WorkerStatus_Idle
-	wkr.release()
+	wkr := s.wkr
+	if *s.atomicGetOccupiedBy() == notAvailable {
+		// worker already removed, never put it back
+		s.task = nil
+		w.lock.Unlock()
+		return
+	}
+
+	if wkr.isClosing() {
+		s.moribund()
+		s.task = nil
+		if wkr.busy() {
+			w.lock.Unlock()
+			return
+		}
+
+		// last task of closing worker ended, remove it cleanly
+		if wkr.closeTimer != nil {
+			wkr.closeTimer.Stop()
+		}
+		w.lock.Unlock()
+		w.dismiss(wkr)
+		return
+	}
 
-	w.freeList.PushFront(wkr)
-	w.freeCond.Broadcast()
+	s.release()
+	if !wkr.busy() {
+		wkr.status = api.WorkerStatus_Idle
+	}
+
+	w.freeList.PushFront(s)
+	w.notifyFree()
+	w.lock.Unlock()
 }
 
+// UpdateStatus routes status to the slot running the reported task
 func (w *WorkerPool) UpdateStatus(id string, payload *api.StatusPayload) error {
 	w.lock.RLock()
 	wkr, exist := w.pool[id]
@@ -202,35 +629,132 @@ func (w *WorkerPool) UpdateStatus(id string, payload *api.StatusPayload) error {
 		return errors.Errorf("Worker id: %s not regsitered, no context found.", id)
 	}
 
-	if !wkr.occupied() {
-		return errors.Errorf("Worker id: %s not occupied", id)
+	s := wkr.lockSlotOf(payload.TaskId)
+	if s == nil {
+		return errors.Wrapf(ErrStaleStatus, "Task id: %s not assigned to worker %s", payload.TaskId, id)
 	}
+	defer s.taskLock.Unlock()
 
-	if wkr.task == nil || (wkr.task.Id != payload.TaskId) {
-		return errors.Errorf("Task id: %s not assigned to worker %s", payload.TaskId, id)
+	if payload.WorkStatus == api.WorkerStatus_Closing {
+		// mark closing before notify, so that worker is removed instead of returned back when tasks ended
+		w.Close(id)
 	}
 
 	wkr.status = payload.WorkStatus
-	wkr.statusNotify(wkr, payload)
+	switch payload.TaskStatus {
+	case api.TaskStatus_Finished:
+		atomic.AddUint64(&wkr.completedCnt, 1)
+	case api.TaskStatus_Error, api.TaskStatus_Interrupted:
+		atomic.AddUint64(&wkr.failedCnt, 1)
+	default:
+	}
+
+	s.statusNotify(s, payload)
 	return nil
 }
 
-func (w *WorkerPool) InterruptJobTasks(jobId string) {
+// lockSlotOf finds the occupied slot running given task and returns it with task lock held, so that it serializes
+// with task timeout, nil if the task is not running on worker any more
+func (w *worker) lockSlotOf(taskId string) *slot {
+	for _, s := range w.slots {
+		s.taskLock.Lock()
+		if s.occupied() && s.task != nil && s.task.Id == taskId {
+			return s
+		}
+		s.taskLock.Unlock()
+	}
+	return nil
+}
+
+// expireTask fails the task if it is still running on the slot, and asks worker to interrupt it
+func (w *WorkerPool) expireTask(s *slot, taskId string) {
+	s.taskLock.Lock()
+	defer s.taskLock.Unlock()
+
+	if !s.busy() || s.task == nil || s.task.Id != taskId {
+		return
+	}
+
+	s.interrupt()
+	atomic.AddUint64(&s.wkr.failedCnt, 1)
+	s.statusNotify(s, &api.StatusPayload{
+		WorkStatus: s.wkr.status,
+		TaskId:     taskId,
+		TaskStatus: api.TaskStatus_Error,
+		ExecResult: "task execution timeout",
+	})
+}
+
+// Touch records the worker is alive
+func (w *WorkerPool) Touch(id string) {
+	w.lock.RLock()
+	defer w.lock.RUnlock()
+	if wkr, exist := w.pool[id]; exist {
+		wkr.touch()
+	}
+}
+
+// Reputations lists reputation of worker principals lost any and not recovered yet
+func (w *WorkerPool) Reputations() map[string]float64 {
+	return w.reputation.Scores()
+}
+
+// ResetReputation restores reputation of worker principal, e.g. once its client fixed, returns false if nothing lost
+func (w *WorkerPool) ResetReputation(principal string) bool {
+	return w.reputation.Reset(principal)
+}
+
+func (w *WorkerPool) ListWorkers() []*WorkerInfo {
 	w.lock.RLock()
 	defer w.lock.RUnlock()
 
+	workers := make([]*WorkerInfo, 0, len(w.pool))
+	for _, wkr := range w.pool {
+		info := wkr.info()
+		info.Reputation = w.reputation.Score(wkr.principal)
+		workers = append(workers, info)
+	}
+
+	sort.Slice(workers, func(a, b int) bool {
+		if !workers[a].ConnectedAt.Equal(workers[b].ConnectedAt) {
+			return workers[a].ConnectedAt.Before(workers[b].ConnectedAt)
+		}
+		return workers[a].Id < workers[b].Id
+	})
+	return workers
+}
+
+// InterruptJobTasks interrupts all tasks of job running on any slot of workers
+func (w *WorkerPool) InterruptJobTasks(jobId string) {
+	// slots are collected first, task lock must not be taken under pool lock since status notify
+	// returns slot to pool while holding task lock
+	w.lock.RLock()
+	slots := make([]*slot, 0, len(w.pool))
 	for _, wkr := range w.pool {
-		if wkr.occupied() && wkr.task.JobId == jobId {
-			wkr.interrupt()
+		slots = append(slots, wkr.slots...)
+	}
+	w.lock.RUnlock()
+
+	for _, s := range slots {
+		s.taskLock.Lock()
+		if task := s.task; s.busy() && task != nil && task.JobId == jobId {
+			s.interrupt()
 		}
+		s.taskLock.Unlock()
 	}
 }
 
-func NewWorkerPool() *WorkerPool {
+func NewWorkerPool(opts ...PoolOption) *WorkerPool {
 	pool := &WorkerPool{
-		pool:     make(map[string]*worker),
-		freeList: list.New(),
+		pool:             make(map[string]*worker),
+		freeList:         list.New(),
+		freeCh:           make(chan struct{}, 1),
+		closeGracePeriod: defaultCloseGracePeriod,
+		reputation:       NewReputation(DefaultMinReputation),
+	}
+
+	for _, opt := range opts {
+		opt(pool)
 	}
-	pool.freeCond = sync.NewCond(&pool.lock)
 	return pool
 }
@@ -2,9 +2,10 @@ package module
 
 import (
 	. "github.com/TD-Hackathon-2022/DCoB-Scheduler/api"
+	"github.com/pkg/errors"
 	. "github.com/smartystreets/goconvey/convey"
-	"runtime"
-	"sync"
+	"sort"
+	"strconv"
 	"testing"
 	"time"
 )
@@ -15,7 +16,7 @@ func TestWorkerPool_ShouldAddWorkerToPool(t *testing.T) {
 
 		Convey("when add worker", func() {
 			addr := "127.0.0.1:8081"
-			wp.Add(addr, nil)
+			_ = wp.Add(addr, nil, nil)
 
 			Convey("then pool init new worker", func() {
 				w, exist := wp.pool[addr]
@@ -23,10 +24,11 @@ func TestWorkerPool_ShouldAddWorkerToPool(t *testing.T) {
 				So(w, ShouldHaveSameTypeAs, &worker{})
 				So(w.id, ShouldEqual, addr)
 				So(w.status, ShouldEqual, WorkerStatus_Idle)
-				So(w.occupiedBy, ShouldEqual, &notOccupied)
+				So(len(w.slots), ShouldEqual, 1)
+				So(w.slots[0].occupiedBy, ShouldEqual, &notOccupied)
 
 				So(wp.freeList.Len(), ShouldEqual, 1)
-				So(wp.freeList.Back().Value.(*worker), ShouldEqual, w)
+				So(wp.freeList.Back().Value.(*slot), ShouldEqual, w.slots[0])
 			})
 		})
 	})
@@ -36,12 +38,12 @@ func TestWorkerPool_ShouldDoNothingWhenAddWorkerThatAlreadyInPool(t *testing.T)
 	Convey("given worker pool", t, func() {
 		wp := NewWorkerPool()
 		addr := "127.0.0.1:8081"
-		w := &worker{id: "fake-worker", status: WorkerStatus_Busy}
-		wp.pool[addr] = w
+		w := newTestSlot("fake-worker", WorkerStatus_Busy, &notOccupied, nil, nil)
+		wp.pool[addr] = w.wkr
 		wp.freeList.PushFront(w)
 
 		Convey("when add worker", func() {
-			wp.Add(addr, nil)
+			_ = wp.Add(addr, nil, nil)
 
 			Convey("then do nothing", func() {
 				w := wp.pool[addr]
@@ -53,42 +55,104 @@ func TestWorkerPool_ShouldDoNothingWhenAddWorkerThatAlreadyInPool(t *testing.T)
 	})
 }
 
-func TestWorkerPool_ShouldBlockApplyWorker(t *testing.T) {
+func TestWorkerPool_ShouldStoreRegisteredCapabilities(t *testing.T) {
 	Convey("given worker pool", t, func() {
 		wp := NewWorkerPool()
-		addr := "127.0.0.1:8081"
-		w1 := &worker{id: addr, status: WorkerStatus_Idle, occupiedBy: &notOccupied}
-		wp.pool[addr] = w1
-		wp.freeList.PushFront(w1)
-		job0 := "job-id-0"
-		job1 := "job-id-1"
+		reg := &RegisterPayload{
+			WorkerId:        "fake-worker",
+			UserAgent:       "fake-agent",
+			Cores:           8,
+			Memory:          1 << 30,
+			FuncIds:         []string{"hash-miner"},
+			Wasm:            true,
+			ProtocolVersion: ProtocolVersion,
+		}
 
-		Convey("when try apply a worker", func() {
-			wkr := wp.blockApply(job0)
-			Convey("then worker should be returned without block", func() {
-				So(wkr.id, ShouldEqual, addr)
-				So(*wkr.occupiedBy, ShouldEqual, job0)
+		Convey("when add worker with register payload", func() {
+			err := wp.Add(reg.WorkerId, nil, reg)
+
+			Convey("then capabilities listed", func() {
+				So(err, ShouldBeNil)
+				workers := wp.ListWorkers()
+				So(len(workers), ShouldEqual, 1)
+				So(workers[0].Id, ShouldEqual, "fake-worker")
+				So(workers[0].UserAgent, ShouldEqual, "fake-agent")
+				So(workers[0].Cores, ShouldEqual, 8)
+				So(workers[0].Memory, ShouldEqual, 1<<30)
+				So(workers[0].FuncIds, ShouldResemble, []string{"hash-miner"})
+				So(workers[0].Wasm, ShouldBeTrue)
+				So(workers[0].Protocol, ShouldEqual, ProtocolVersion)
 			})
+		})
+	})
+}
+
+func TestWorkerPool_ShouldRejectUnsupportedProtocol(t *testing.T) {
+	Convey("given worker pool", t, func() {
+		wp := NewWorkerPool()
 
-			wg := sync.WaitGroup{}
-			wg.Add(1)
-			go func() {
-				wkr = wp.blockApply(job1)
-				wg.Done()
-			}()
-			runtime.Gosched()
-			time.Sleep(time.Second)
+		Convey("when add worker with newer protocol", func() {
+			err := wp.Add("fake-worker", nil, &RegisterPayload{ProtocolVersion: ProtocolVersion + 1})
 
-			Convey("should still blocked and not apply", func() {
-				So(wkr.id, ShouldEqual, addr)
-				So(*wkr.occupiedBy, ShouldEqual, job0)
+			Convey("then rejected", func() {
+				So(errors.Cause(err), ShouldEqual, ErrUnsupportedProtocol)
+				So(len(wp.pool), ShouldEqual, 0)
 			})
+		})
+	})
+}
+
+func TestWorkerPool_ShouldReclaimIdentityWhenWorkerReconnect(t *testing.T) {
+	Convey("given worker pool with busy worker on stale connection", t, func() {
+		task := &Task{Id: "fake-task", JobId: "fake-job-id", Ctx: &Context{Status: TaskStatus_Running}}
+		wp := NewWorkerPool()
+		id := "fake-worker"
+		staleCh := make(chan *Msg, 1)
+		exited := false
+		stale := newTestSlot(id, WorkerStatus_Busy, &task.JobId, task, staleCh)
+		stale.exitNotify = func(*slot) { exited = true }
+		wp.pool[id] = stale.wkr
+
+		Convey("when worker registers again on new connection, then stale connection exits", func() {
+			newCh := make(chan *Msg, 1)
+			err := wp.Add(id, newCh, &RegisterPayload{WorkerId: id, ProtocolVersion: ProtocolVersion})
+			wp.Remove(id, staleCh)
+
+			Convey("then identity taken over by new connection and stale task released", func() {
+				So(err, ShouldBeNil)
+				So(exited, ShouldBeTrue)
+				So(*stale.atomicGetOccupiedBy(), ShouldEqual, notAvailable)
+				w, exist := wp.pool[id]
+				So(exist, ShouldBeTrue)
+				So(w.ch, ShouldEqual, newCh)
+				So(w.busy(), ShouldBeFalse)
+				So(wp.chooseFreeSlot(&Task{JobId: "fake-job-id"}), ShouldEqual, w.slots[0])
+			})
+		})
+	})
+}
 
+func TestWorkerPool_ShouldSignalFreedWhenWorkerReturned(t *testing.T) {
+	Convey("given worker pool with the only worker applied", t, func() {
+		wp := NewWorkerPool()
+		addr := "127.0.0.1:8081"
+		w1 := newTestSlot(addr, WorkerStatus_Idle, &notOccupied, nil, nil)
+		wp.pool[addr] = w1.wkr
+		wp.freeList.PushFront(w1)
+		job0 := "job-id-0"
+		job1 := "job-id-1"
+		wkr, _ := wp.apply(&Task{JobId: job0})
+
+		Convey("when worker returned", func() {
+			_, foundBeforeReturned := wp.apply(&Task{JobId: job1})
 			wp.returnBack(wkr)
-			runtime.Gosched()
-			wg.Wait()
-			Convey("then worker should be returned then apply again", func() {
-				So(wkr.id, ShouldEqual, addr)
+
+			Convey("then freed signaled and worker can be applied again", func() {
+				So(foundBeforeReturned, ShouldBeFalse)
+				So(len(wp.freed()), ShouldEqual, 1)
+				wkr, found := wp.apply(&Task{JobId: job1})
+				So(found, ShouldBeTrue)
+				So(wkr.wkr.id, ShouldEqual, addr)
 				So(*wkr.occupiedBy, ShouldEqual, job1)
 			})
 		})
@@ -100,27 +164,70 @@ func TestWorkerPool_ShouldApplyWorker(t *testing.T) {
 		wp := NewWorkerPool()
 		addr0 := "127.0.0.1:8081"
 		job0 := "job-0"
-		w0 := &worker{id: addr0, status: WorkerStatus_Idle, occupiedBy: &job0}
-		wp.pool[addr0] = w0
+		w0 := newTestSlot(addr0, WorkerStatus_Idle, &job0, nil, nil)
+		wp.pool[addr0] = w0.wkr
 		wp.freeList.PushFront(w0)
 		addr1 := "127.0.0.1:8082"
-		w1 := &worker{id: addr1, status: WorkerStatus_Idle, occupiedBy: &notOccupied}
-		wp.pool[addr1] = w1
+		w1 := newTestSlot(addr1, WorkerStatus_Idle, &notOccupied, nil, nil)
+		wp.pool[addr1] = w1.wkr
 		wp.freeList.PushFront(w1)
 		addr2 := "127.0.0.1:8083"
 		job1 := "job-1"
-		w2 := &worker{id: addr2, status: WorkerStatus_Idle, occupiedBy: &job1}
-		wp.pool[addr2] = w2
+		w2 := newTestSlot(addr2, WorkerStatus_Idle, &job1, nil, nil)
+		wp.pool[addr2] = w2.wkr
 		wp.freeList.PushFront(w2)
 
 		Convey("when try apply a worker", func() {
-			wFirst := wp.chooseFreeWorker("job-id-2")
-			wSecond := wp.chooseFreeWorker("job-id-2")
+			wFirst := wp.chooseFreeSlot(&Task{JobId: "job-id-2"})
+			wSecond := wp.chooseFreeSlot(&Task{JobId: "job-id-2"})
 
-			Convey("then worker1 should be returned", func() {
-				So(wFirst, ShouldBeNil)
-				So(wSecond.id, ShouldEqual, addr1)
-				So(*wSecond.occupiedBy, ShouldEqual, "job-id-2")
+			Convey("then worker1 should be returned and occupied ones dropped", func() {
+				So(wFirst.wkr.id, ShouldEqual, addr1)
+				So(*wFirst.occupiedBy, ShouldEqual, "job-id-2")
+				So(wSecond, ShouldBeNil)
+				So(wp.freeList.Len(), ShouldEqual, 0)
+			})
+		})
+	})
+}
+
+func TestWorkerPool_ShouldApplyOnlyCapableWorker(t *testing.T) {
+	Convey("given worker pool with workers of different capabilities", t, func() {
+		wp := NewWorkerPool()
+		_ = wp.Add("legacy", nil, nil)
+		_ = wp.Add("miner", nil, &RegisterPayload{Cores: 2, FuncIds: []string{"hash-miner"}, ProtocolVersion: ProtocolVersion})
+		_ = wp.Add("wasm", nil, &RegisterPayload{Cores: 8, FuncIds: []string{"custom-func-monte_carlo_pi"}, Wasm: true, ProtocolVersion: ProtocolVersion})
+
+		Convey("when apply worker for wasm task", func() {
+			wkr, found := wp.apply(&Task{JobId: "job-pi", FuncId: "custom-func-monte_carlo_pi", NeedsWasm: true, MinCores: 4})
+			_, foundAnother := wp.apply(&Task{JobId: "job-pi", FuncId: "custom-func-monte_carlo_pi", NeedsWasm: true})
+
+			Convey("then only the wasm worker applied, others left free", func() {
+				So(found, ShouldBeTrue)
+				So(wkr.wkr.id, ShouldEqual, "wasm")
+				So(foundAnother, ShouldBeFalse)
+				So(wp.freeList.Len(), ShouldEqual, 2)
+			})
+		})
+
+		Convey("when apply worker for task requiring more cores than advertised", func() {
+			_, found := wp.apply(&Task{JobId: "job-miner", FuncId: "hash-miner", MinCores: 4})
+
+			Convey("then no worker applied", func() {
+				So(found, ShouldBeFalse)
+				So(wp.freeList.Len(), ShouldEqual, 3)
+			})
+		})
+
+		Convey("when apply workers for plain miner tasks", func() {
+			first, _ := wp.apply(&Task{JobId: "job-miner", FuncId: "hash-miner"})
+			second, _ := wp.apply(&Task{JobId: "job-miner", FuncId: "hash-miner"})
+			_, foundThird := wp.apply(&Task{JobId: "job-miner", FuncId: "hash-miner"})
+
+			Convey("then miner and legacy workers applied", func() {
+				So(first.wkr.id, ShouldEqual, "legacy")
+				So(second.wkr.id, ShouldEqual, "miner")
+				So(foundThird, ShouldBeFalse)
 			})
 		})
 	})
@@ -131,16 +238,16 @@ func TestWorkerPool_ShouldNotApplyWorkerIfNotAvailable(t *testing.T) {
 		wp := NewWorkerPool()
 		addr0 := "127.0.0.1:8081"
 		job0 := "job-0"
-		wp.pool[addr0] = &worker{id: addr0, status: WorkerStatus_Idle, occupiedBy: &job0}
+		wp.pool[addr0] = newTestSlot(addr0, WorkerStatus_Idle, &job0, nil, nil).wkr
 		addr1 := "127.0.0.1:8082"
 		job1 := "job-1"
-		wp.pool[addr1] = &worker{id: addr1, status: WorkerStatus_Idle, occupiedBy: &job1}
+		wp.pool[addr1] = newTestSlot(addr1, WorkerStatus_Idle, &job1, nil, nil).wkr
 		addr2 := "127.0.0.1:8083"
 		job2 := "job-2"
-		wp.pool[addr2] = &worker{id: addr2, status: WorkerStatus_Busy, occupiedBy: &job2}
+		wp.pool[addr2] = newTestSlot(addr2, WorkerStatus_Busy, &job2, nil, nil).wkr
 
 		Convey("when try apply a worker", func() {
-			wkr := wp.chooseFreeWorker("job-id-3")
+			wkr := wp.chooseFreeSlot(&Task{JobId: "job-id-3"})
 
 			Convey("then no worker should be returned", func() {
 				So(wkr, ShouldBeNil)
@@ -154,7 +261,7 @@ func TestWorkerPool_ShouldNotApplyWorkerIfNoWorker(t *testing.T) {
 		wp := NewWorkerPool()
 
 		Convey("when try apply a worker", func() {
-			wkr := wp.chooseFreeWorker("job-id-3")
+			wkr := wp.chooseFreeSlot(&Task{JobId: "job-id-3"})
 
 			Convey("then no worker should be returned", func() {
 				So(wkr, ShouldBeNil)
@@ -167,16 +274,16 @@ func TestWorkerPool_ShouldApplyWorkerThenRelease(t *testing.T) {
 	Convey("given worker pool", t, func() {
 		wp := NewWorkerPool()
 		addr0 := "127.0.0.1:8081"
-		w := &worker{id: addr0, status: WorkerStatus_Idle, occupiedBy: &notOccupied}
-		wp.pool[addr0] = w
+		w := newTestSlot(addr0, WorkerStatus_Idle, &notOccupied, nil, nil)
+		wp.pool[addr0] = w.wkr
 		wp.freeList.PushFront(w)
 
 		Convey("when try apply a worker", func() {
-			w, found := wp.apply("job-id-0")
+			w, found := wp.apply(&Task{JobId: "job-id-0"})
 
 			Convey("then worker1 should be returned", func() {
 				So(found, ShouldBeTrue)
-				So(w.id, ShouldEqual, addr0)
+				So(w.wkr.id, ShouldEqual, addr0)
 				So(*w.occupiedBy, ShouldEqual, "job-id-0")
 				So(wp.freeList.Len(), ShouldEqual, 0)
 			})
@@ -184,7 +291,7 @@ func TestWorkerPool_ShouldApplyWorkerThenRelease(t *testing.T) {
 			wp.returnBack(w)
 
 			Convey("can returnBack", func() {
-				So(w.status, ShouldEqual, WorkerStatus_Idle)
+				So(w.wkr.status, ShouldEqual, WorkerStatus_Idle)
 				So(w.occupiedBy, ShouldEqual, &notOccupied)
 				So(wp.freeList.Len(), ShouldEqual, 1)
 			})
@@ -194,10 +301,10 @@ func TestWorkerPool_ShouldApplyWorkerThenRelease(t *testing.T) {
 
 func TestWorker_ShouldNotAssignTaskWhenNotOccupied(t *testing.T) {
 	Convey("given worker", t, func() {
-		w := &worker{id: "127.0.0.1:8081", status: WorkerStatus_Idle, occupiedBy: &notOccupied}
+		w := newTestSlot("127.0.0.1:8081", WorkerStatus_Idle, &notOccupied, nil, nil)
 
 		Convey("when try assign a task", func() {
-			success := w.assign(&Task{}, func(*worker, *StatusPayload) {}, func(*worker) {})
+			success := w.assign(&Task{}, func(*slot, *StatusPayload) {}, func(*slot) {})
 
 			Convey("then assign failed", func() {
 				So(success, ShouldBeFalse)
@@ -209,11 +316,11 @@ func TestWorker_ShouldNotAssignTaskWhenNotOccupied(t *testing.T) {
 func TestWorker_ShouldNotAssignTaskWhenOccupiedByAnotherJob(t *testing.T) {
 	Convey("given worker", t, func() {
 		job0 := "job0"
-		w := &worker{id: "127.0.0.1:8081", status: WorkerStatus_Idle, occupiedBy: &job0}
+		w := newTestSlot("127.0.0.1:8081", WorkerStatus_Idle, &job0, nil, nil)
 
 		Convey("when try assign a task", func() {
 			job1 := "job1"
-			success := w.assign(&Task{JobId: job1}, func(*worker, *StatusPayload) {}, func(*worker) {})
+			success := w.assign(&Task{JobId: job1}, func(*slot, *StatusPayload) {}, func(*slot) {})
 
 			Convey("then assign failed", func() {
 				So(success, ShouldBeFalse)
@@ -225,12 +332,12 @@ func TestWorker_ShouldNotAssignTaskWhenOccupiedByAnotherJob(t *testing.T) {
 func TestWorker_ShouldNotAssignTaskWhenThereIsARunningTask(t *testing.T) {
 	Convey("given worker", t, func() {
 		job0 := "job0"
-		w := &worker{id: "127.0.0.1:8081", status: WorkerStatus_Idle, occupiedBy: &job0, task: &Task{
+		w := newTestSlot("127.0.0.1:8081", WorkerStatus_Idle, &job0, &Task{
 			Ctx: &Context{Status: TaskStatus_Running},
-		}}
+		}, nil)
 
 		Convey("when try assign a task", func() {
-			success := w.assign(&Task{JobId: job0}, func(*worker, *StatusPayload) {}, func(*worker) {})
+			success := w.assign(&Task{JobId: job0}, func(*slot, *StatusPayload) {}, func(*slot) {})
 
 			Convey("then assign failed", func() {
 				So(success, ShouldBeFalse)
@@ -243,7 +350,7 @@ func TestWorker_ShouldAssignTaskToOutputCh(t *testing.T) {
 	Convey("given worker", t, func() {
 		job0 := "job0"
 		ch := make(chan *Msg, 1)
-		w := &worker{id: "127.0.0.1:8081", status: WorkerStatus_Idle, occupiedBy: &job0, ch: ch}
+		w := newTestSlot("127.0.0.1:8081", WorkerStatus_Idle, &job0, nil, ch)
 
 		Convey("when try assign a task", func() {
 			task0 := "task0"
@@ -252,10 +359,10 @@ func TestWorker_ShouldAssignTaskToOutputCh(t *testing.T) {
 				Id:    task0,
 				JobId: job0,
 				Ctx: &Context{
-					InitData: "fake-data",
+					InitData: Text("fake-data"),
 				},
 				FuncId: funcId,
-			}, func(*worker, *StatusPayload) {}, func(*worker) {})
+			}, func(*slot, *StatusPayload) {}, func(*slot) {})
 
 			Convey("then assign success", func() {
 				So(success, ShouldBeTrue)
@@ -270,6 +377,66 @@ func TestWorker_ShouldAssignTaskToOutputCh(t *testing.T) {
 	})
 }
 
+func TestWorker_ShouldShipFuncCodeOnlyToWorkerWithoutFuncCache(t *testing.T) {
+	Convey("given workers speak different protocol versions", t, func() {
+		task := &Task{Id: "task0", JobId: "job0", Ctx: &Context{}, FuncId: "pi", funcCode: fakeWasm, funcHash: "fake-hash"}
+		legacyCh := make(chan *Msg, 1)
+		legacy := newWorker("legacy", legacyCh, &RegisterPayload{ProtocolVersion: 1}).slots[0]
+		legacy.occupy(task.JobId)
+		cachingCh := make(chan *Msg, 1)
+		caching := newWorker("caching", cachingCh, &RegisterPayload{ProtocolVersion: ProtocolVersion}).slots[0]
+		caching.occupy(task.JobId)
+
+		Convey("when assign the same task", func() {
+			legacy.assign(task, func(*slot, *StatusPayload) {}, func(*slot) {})
+			caching.assign(task, func(*slot, *StatusPayload) {}, func(*slot) {})
+
+			Convey("then legacy worker receives code, caching worker receives hash only", func() {
+				legacyAssign := (<-legacyCh).GetAssign()
+				So(legacyAssign.FuncCode, ShouldResemble, fakeWasm)
+				So(legacyAssign.FuncHash, ShouldEqual, "fake-hash")
+				cachingAssign := (<-cachingCh).GetAssign()
+				So(cachingAssign.FuncCode, ShouldBeEmpty)
+				So(cachingAssign.FuncHash, ShouldEqual, "fake-hash")
+			})
+		})
+	})
+}
+
+func TestWorker_ShouldSendTypedInputOnlyToWorkerSpeaksTypedPayload(t *testing.T) {
+	Convey("given workers speak different protocol versions", t, func() {
+		input, _ := JSON(map[string]int{"n": 1})
+		task := &Task{Id: "task0", JobId: "job0", Ctx: &Context{InitData: input}}
+		binary := &Task{Id: "task1", JobId: "job0", Ctx: &Context{InitData: Raw([]byte{0x00, 0xff})}}
+		legacyCh := make(chan *Msg, 1)
+		legacy := newWorker("legacy", legacyCh, &RegisterPayload{ProtocolVersion: 2}).slots[0]
+		legacy.occupy(task.JobId)
+		typedCh := make(chan *Msg, 1)
+		typed := newWorker("typed", typedCh, &RegisterPayload{ProtocolVersion: ProtocolVersion}).slots[0]
+		typed.occupy(task.JobId)
+
+		Convey("when assign task of JSON input", func() {
+			legacy.assign(task, func(*slot, *StatusPayload) {}, func(*slot) {})
+			typed.assign(task, func(*slot, *StatusPayload) {}, func(*slot) {})
+
+			Convey("then legacy worker receives string, typed worker receives bytes with content type", func() {
+				legacyAssign := (<-legacyCh).GetAssign()
+				So(legacyAssign.Data, ShouldEqual, `{"n":1}`)
+				So(legacyAssign.Input, ShouldBeNil)
+				typedAssign := (<-typedCh).GetAssign()
+				So(typedAssign.Data, ShouldBeEmpty)
+				So(typedAssign.Input.ContentType, ShouldEqual, ContentType_Json)
+				So(typedAssign.Input.Data, ShouldResemble, []byte(`{"n":1}`))
+			})
+		})
+
+		Convey("then only typed worker can run task of binary input", func() {
+			So(legacy.wkr.canRun(binary), ShouldBeFalse)
+			So(typed.wkr.canRun(binary), ShouldBeTrue)
+		})
+	})
+}
+
 func TestWorker_ShouldInterruptTaskToOutputCh(t *testing.T) {
 	Convey("given worker", t, func() {
 		job0 := "job0"
@@ -281,11 +448,11 @@ func TestWorker_ShouldInterruptTaskToOutputCh(t *testing.T) {
 			Id:    task0,
 			JobId: job0,
 			Ctx: &Context{
-				InitData: "fake-data",
+				InitData: Text("fake-data"),
 			},
 			FuncId: funcId,
 		}
-		w := &worker{id: "127.0.0.1:8081", status: WorkerStatus_Busy, occupiedBy: &job0, ch: ch, task: task}
+		w := newTestSlot("127.0.0.1:8081", WorkerStatus_Busy, &job0, task, ch)
 
 		Convey("when try interrupt a task", func() {
 
@@ -307,7 +474,7 @@ func TestWorkerPool_ShouldUpdateWorkerStatusAndNotify(t *testing.T) {
 			JobId: "fake-job-id",
 			Ctx: &Context{
 				Status:   TaskStatus_Running,
-				InitData: "fake-data",
+				InitData: Text("fake-data"),
 			},
 			FuncId: "fake-func-id",
 		}
@@ -315,10 +482,11 @@ func TestWorkerPool_ShouldUpdateWorkerStatusAndNotify(t *testing.T) {
 		wp := NewWorkerPool()
 		addr := "127.0.0.1:8081"
 		notified := false
-		w := &worker{id: addr, status: WorkerStatus_Busy, occupiedBy: &task.JobId, task: task, statusNotify: func(*worker, *StatusPayload) {
+		w := newTestSlot(addr, WorkerStatus_Busy, &task.JobId, task, nil)
+		w.statusNotify = func(*slot, *StatusPayload) {
 			notified = true
-		}}
-		wp.pool[addr] = w
+		}
+		wp.pool[addr] = w.wkr
 		wp.freeList.PushFront(w)
 
 		Convey("when update status", func() {
@@ -349,21 +517,22 @@ func TestWorkerPool_ShouldRemoveOccupiedWorkerAndNotifyExit(t *testing.T) {
 			JobId: "fake-job-id",
 			Ctx: &Context{
 				Status:   TaskStatus_Running,
-				InitData: "fake-data",
+				InitData: Text("fake-data"),
 			},
 			FuncId: "fake-func-id",
 		}
 
 		wp := NewWorkerPool()
 		addr := "127.0.0.1:8081"
-		w := &worker{id: addr, status: WorkerStatus_Busy, occupiedBy: &task.JobId, task: task, exitNotify: func(*worker) {
+		w := newTestSlot(addr, WorkerStatus_Busy, &task.JobId, task, nil)
+		w.exitNotify = func(*slot) {
 			notified = true
-		}}
-		wp.pool[addr] = w
+		}
+		wp.pool[addr] = w.wkr
 		wp.freeList.PushFront(w)
 
 		Convey("when remove worker", func() {
-			wp.Remove(addr)
+			wp.Remove(addr, nil)
 
 			Convey("then worker updated", func() {
 				_, exist := wp.pool[addr]
@@ -378,14 +547,14 @@ func TestWorkerPool_ShouldRemoveOccupiedWorkerAndNotifyExit(t *testing.T) {
 func TestWorkerPool_ShouldRemoveIdleWorker(t *testing.T) {
 	Convey("given worker pool", t, func() {
 		addr := "127.0.0.1:8081"
-		wkr := &worker{id: addr, status: WorkerStatus_Idle, occupiedBy: &notOccupied}
+		wkr := newTestSlot(addr, WorkerStatus_Idle, &notOccupied, nil, nil)
 
 		wp := NewWorkerPool()
-		wp.pool[addr] = wkr
+		wp.pool[addr] = wkr.wkr
 		wp.freeList.PushFront(wkr)
 
 		Convey("when remove worker", func() {
-			wp.Remove(addr)
+			wp.Remove(addr, nil)
 
 			Convey("then worker updated", func() {
 				_, exist := wp.pool[addr]
@@ -396,6 +565,34 @@ func TestWorkerPool_ShouldRemoveIdleWorker(t *testing.T) {
 	})
 }
 
+func TestWorkerPool_ShouldEvictWorkerOfAnyConnectionAndNotifyExit(t *testing.T) {
+	Convey("given worker pool with busy worker", t, func() {
+		jobId := "fake-job-id"
+		notified := false
+		addr := "127.0.0.1:8081"
+		wkr := newTestSlot(addr, WorkerStatus_Busy, &jobId, &Task{Id: "fake-task", JobId: jobId}, nil)
+		wkr.exitNotify = func(*slot) {
+			notified = true
+		}
+
+		wp := NewWorkerPool()
+		wp.pool[addr] = wkr.wkr
+		wp.freeList.PushFront(wkr)
+
+		Convey("when evict worker", func() {
+			evicted := wp.Evict(addr)
+
+			Convey("then worker removed and its task notified to exit", func() {
+				So(evicted, ShouldBeTrue)
+				_, exist := wp.pool[addr]
+				So(exist, ShouldBeFalse)
+				So(notified, ShouldBeTrue)
+				So(wp.Evict(addr), ShouldBeFalse)
+			})
+		})
+	})
+}
+
 func TestWorkerPool_ShouldInterruptAllWorkerWithGivenJob(t *testing.T) {
 	Convey("given worker pool", t, func() {
 		jobId0 := "fake-job-id-0"
@@ -404,7 +601,7 @@ func TestWorkerPool_ShouldInterruptAllWorkerWithGivenJob(t *testing.T) {
 			JobId: jobId0,
 			Ctx: &Context{
 				Status:   TaskStatus_Running,
-				InitData: "fake-data",
+				InitData: Text("fake-data"),
 			},
 			FuncId: "fake-func-id",
 		}
@@ -414,7 +611,7 @@ func TestWorkerPool_ShouldInterruptAllWorkerWithGivenJob(t *testing.T) {
 			JobId: jobId0,
 			Ctx: &Context{
 				Status:   TaskStatus_Running,
-				InitData: "fake-data",
+				InitData: Text("fake-data"),
 			},
 			FuncId: "fake-func-id",
 		}
@@ -425,7 +622,7 @@ func TestWorkerPool_ShouldInterruptAllWorkerWithGivenJob(t *testing.T) {
 			JobId: jobId1,
 			Ctx: &Context{
 				Status:   TaskStatus_Running,
-				InitData: "fake-data",
+				InitData: Text("fake-data"),
 			},
 			FuncId: "fake-func-id",
 		}
@@ -433,20 +630,20 @@ func TestWorkerPool_ShouldInterruptAllWorkerWithGivenJob(t *testing.T) {
 		outputCh := make(chan *Msg, 5)
 		wp := NewWorkerPool()
 		addr0 := "127.0.0.1:8081"
-		w0 := &worker{id: addr0, status: WorkerStatus_Busy, occupiedBy: &jobId0, task: task0, ch: outputCh}
-		wp.pool[addr0] = w0
+		w0 := newTestSlot(addr0, WorkerStatus_Busy, &jobId0, task0, outputCh)
+		wp.pool[addr0] = w0.wkr
 		wp.freeList.PushFront(w0)
 		addr1 := "127.0.0.1:8082"
-		w1 := &worker{id: addr1, status: WorkerStatus_Busy, occupiedBy: &jobId0, task: task1, ch: outputCh}
-		wp.pool[addr1] = w1
+		w1 := newTestSlot(addr1, WorkerStatus_Busy, &jobId0, task1, outputCh)
+		wp.pool[addr1] = w1.wkr
 		wp.freeList.PushFront(w1)
 		addr2 := "127.0.0.1:8083"
-		w2 := &worker{id: addr2, status: WorkerStatus_Busy, occupiedBy: &jobId1, task: task2, ch: outputCh}
-		wp.pool[addr2] = w2
+		w2 := newTestSlot(addr2, WorkerStatus_Busy, &jobId1, task2, outputCh)
+		wp.pool[addr2] = w2.wkr
 		wp.freeList.PushFront(w2)
 		addr3 := "127.0.0.1:8084"
-		w3 := &worker{id: addr3, status: WorkerStatus_Idle, occupiedBy: &notOccupied, ch: outputCh}
-		wp.pool[addr2] = w3
+		w3 := newTestSlot(addr3, WorkerStatus_Idle, &notOccupied, nil, outputCh)
+		wp.pool[addr2] = w3.wkr
 		wp.freeList.PushFront(w3)
 
 		Convey("when remove worker", func() {
@@ -460,3 +657,273 @@ func TestWorkerPool_ShouldInterruptAllWorkerWithGivenJob(t *testing.T) {
 		})
 	})
 }
+
+func TestWorkerPool_ShouldListWorkersWithTaskAndCounters(t *testing.T) {
+	Convey("given worker pool with a busy worker", t, func() {
+		task := &Task{
+			Id:    "fake-task",
+			JobId: "fake-job-id",
+			Ctx: &Context{
+				Status:   TaskStatus_Running,
+				InitData: Text("fake-data"),
+			},
+			FuncId: "fake-func-id",
+		}
+
+		wp := NewWorkerPool()
+		addr0 := "127.0.0.1:8081"
+		_ = wp.Add(addr0, nil, nil)
+		addr1 := "127.0.0.1:8082"
+		_ = wp.Add(addr1, nil, nil)
+		w0 := wp.pool[addr0]
+		w0.slots[0].occupiedBy = &task.JobId
+		w0.slots[0].task = task
+		w0.status = WorkerStatus_Busy
+		w0.slots[0].statusNotify = func(*slot, *StatusPayload) {}
+
+		Convey("when task reported error then list workers", func() {
+			_ = wp.UpdateStatus(addr0, &StatusPayload{WorkStatus: WorkerStatus_Busy, TaskId: task.Id, TaskStatus: TaskStatus_Error})
+			workers := wp.ListWorkers()
+
+			Convey("then all workers listed", func() {
+				So(len(workers), ShouldEqual, 2)
+				So(workers[0].Id, ShouldEqual, addr0)
+				So(workers[0].Status, ShouldEqual, "Busy")
+				So(workers[0].Slots, ShouldEqual, 1)
+				So(workers[0].Tasks, ShouldResemble, []*SlotInfo{{Slot: 0, JobId: task.JobId, TaskId: task.Id}})
+				So(workers[0].Failed, ShouldEqual, 1)
+				So(workers[0].Completed, ShouldEqual, 0)
+				So(workers[0].LastHeartbeat.IsZero(), ShouldBeFalse)
+				So(workers[1].Id, ShouldEqual, addr1)
+				So(workers[1].Status, ShouldEqual, "Idle")
+				So(workers[1].Tasks, ShouldBeEmpty)
+			})
+		})
+	})
+}
+
+func TestWorkerPool_ShouldNotReturnBackRemovedWorker(t *testing.T) {
+	Convey("given worker pool with occupied worker", t, func() {
+		jobId := "fake-job-id"
+		addr := "127.0.0.1:8081"
+		wkr := newTestSlot(addr, WorkerStatus_Busy, &jobId, &Task{Id: "fake-task", Ctx: &Context{}}, nil)
+
+		wp := NewWorkerPool()
+		wp.pool[addr] = wkr.wkr
+
+		Convey("when worker removed then return back", func() {
+			wp.Remove(addr, nil)
+			wp.returnBack(wkr)
+
+			Convey("then worker not in free list", func() {
+				So(wp.freeList.Len(), ShouldEqual, 0)
+				So(*wkr.occupiedBy, ShouldEqual, notAvailable)
+				So(wkr.task, ShouldBeNil)
+			})
+		})
+	})
+}
+
+func TestWorkerPool_ShouldRemoveIdleWorkerWhenClose(t *testing.T) {
+	Convey("given worker pool with idle worker", t, func() {
+		wp := NewWorkerPool()
+		addr := "127.0.0.1:8081"
+		outputCh := make(chan *Msg, 1)
+		_ = wp.Add(addr, outputCh, nil)
+
+		Convey("when close worker", func() {
+			wp.Close(addr)
+
+			Convey("then worker removed and close acked", func() {
+				_, exist := wp.pool[addr]
+				So(exist, ShouldBeFalse)
+				So((<-outputCh).Cmd, ShouldEqual, CMD_Close)
+				So(wp.chooseFreeSlot(&Task{JobId: "fake-job-id"}), ShouldBeNil)
+			})
+		})
+	})
+}
+
+func TestWorkerPool_ShouldNotAckCloseAfterConnectionExited(t *testing.T) {
+	Convey("given worker pool with idle worker, whose connection exited right before removing it", t, func() {
+		wp := NewWorkerPool()
+		addr := "127.0.0.1:8081"
+		outputCh := make(chan *Msg)
+		_ = wp.Add(addr, outputCh, nil)
+		wp.pool[addr].detach()
+		close(outputCh)
+
+		Convey("when close worker", func() {
+			closeWorker := func() { wp.Close(addr) }
+
+			Convey("then worker removed without sending on closed channel", func() {
+				So(closeWorker, ShouldNotPanic)
+				_, exist := wp.pool[addr]
+				So(exist, ShouldBeFalse)
+			})
+		})
+	})
+}
+
+func TestWorkerPool_ShouldRemoveClosingWorkerWhenTaskEnded(t *testing.T) {
+	Convey("given worker pool with busy worker", t, func() {
+		task := &Task{Id: "fake-task", JobId: "fake-job-id", Ctx: &Context{Status: TaskStatus_Running}}
+		wp := NewWorkerPool()
+		addr := "127.0.0.1:8081"
+		outputCh := make(chan *Msg, 1)
+		w := newTestSlot(addr, WorkerStatus_Busy, &task.JobId, task, outputCh)
+		w.statusNotify = func(w *slot, payload *StatusPayload) {
+			if payload.TaskStatus != TaskStatus_Running {
+				wp.returnBack(w)
+			}
+		}
+		wp.pool[addr] = w.wkr
+
+		Convey("when worker reports closing then finishes task", func() {
+			_ = wp.UpdateStatus(addr, &StatusPayload{WorkStatus: WorkerStatus_Closing, TaskId: task.Id, TaskStatus: TaskStatus_Running})
+			_, existAfterClosing := wp.pool[addr]
+			_ = wp.UpdateStatus(addr, &StatusPayload{WorkStatus: WorkerStatus_Closing, TaskId: task.Id, TaskStatus: TaskStatus_Finished})
+
+			Convey("then worker removed after task ended", func() {
+				So(existAfterClosing, ShouldBeTrue)
+				_, exist := wp.pool[addr]
+				So(exist, ShouldBeFalse)
+				So(wp.freeList.Len(), ShouldEqual, 0)
+				So((<-outputCh).Cmd, ShouldEqual, CMD_Close)
+			})
+		})
+	})
+}
+
+func TestWorkerPool_ShouldInterruptAndReleaseTaskWhenCloseGraceExpired(t *testing.T) {
+	Convey("given worker pool with short grace period and busy worker", t, func() {
+		task := &Task{Id: "fake-task", JobId: "fake-job-id", Ctx: &Context{Status: TaskStatus_Running}}
+		wp := NewWorkerPool(WithCloseGracePeriod(50 * time.Millisecond))
+		addr := "127.0.0.1:8081"
+		outputCh := make(chan *Msg, 2)
+		exited := make(chan struct{})
+		w := newTestSlot(addr, WorkerStatus_Busy, &task.JobId, task, outputCh)
+		w.exitNotify = func(*slot) { close(exited) }
+		wp.pool[addr] = w.wkr
+
+		Convey("when close worker and task not ended", func() {
+			wp.Close(addr)
+			<-exited
+
+			Convey("then task interrupted, worker removed and close acked", func() {
+				So((<-outputCh).Cmd, ShouldEqual, CMD_Interrupt)
+				So((<-outputCh).Cmd, ShouldEqual, CMD_Close)
+				wp.lock.RLock()
+				defer wp.lock.RUnlock()
+				_, exist := wp.pool[addr]
+				So(exist, ShouldBeFalse)
+			})
+		})
+	})
+}
+
+// newTestSlot builds the only slot of a worker in given state
+func newTestSlot(id string, status WorkerStatus, occupiedBy *string, task *Task, ch chan *Msg) *slot {
+	wkr := newWorker(id, ch, nil)
+	wkr.status = status
+	s := wkr.slots[0]
+	s.occupiedBy = occupiedBy
+	s.task = task
+	return s
+}
+
+func TestWorkerPool_ShouldAssignTasksToAllSlotsAndRouteStatusByTaskId(t *testing.T) {
+	Convey("given worker pool with worker of 3 slots", t, func() {
+		wp := NewWorkerPool()
+		addr := "127.0.0.1:8081"
+		outputCh := make(chan *Msg, 3)
+		_ = wp.Add(addr, outputCh, &RegisterPayload{Slots: 3})
+
+		tasks := make([]*Task, 0, 3)
+		slots := make([]*slot, 0, 3)
+		notified := make(map[string]*slot)
+		for _, jobId := range []string{"job-0", "job-1", "job-1"} {
+			task := &Task{Id: "task-" + strconv.Itoa(len(tasks)), JobId: jobId, Ctx: &Context{InitData: Text("fake-data")}}
+			s, found := wp.apply(task)
+			So(found, ShouldBeTrue)
+			So(s.assign(task, func(s *slot, payload *StatusPayload) {
+				notified[payload.TaskId] = s
+				wp.returnBack(s)
+			}, func(*slot) {}), ShouldBeTrue)
+			tasks = append(tasks, task)
+			slots = append(slots, s)
+		}
+
+		Convey("when all slots occupied", func() {
+			_, found := wp.apply(&Task{JobId: "job-2"})
+
+			Convey("then no more task assigned", func() {
+				So(found, ShouldBeFalse)
+				So(len(wp.ListWorkers()[0].Tasks), ShouldEqual, 3)
+				So(slots[0], ShouldNotEqual, slots[1])
+				So(slots[1], ShouldNotEqual, slots[2])
+			})
+		})
+
+		Convey("when middle task finished", func() {
+			err := wp.UpdateStatus(addr, &StatusPayload{WorkStatus: WorkerStatus_Busy, TaskId: tasks[1].Id, TaskStatus: TaskStatus_Finished})
+
+			Convey("then status routed to its slot, only that slot freed", func() {
+				So(err, ShouldBeNil)
+				So(notified[tasks[1].Id], ShouldEqual, slots[1])
+				So(slots[0].task, ShouldEqual, tasks[0])
+				So(slots[1].task, ShouldBeNil)
+				So(slots[2].task, ShouldEqual, tasks[2])
+				So(wp.freeList.Len(), ShouldEqual, 1)
+				So(wp.pool[addr].status, ShouldEqual, WorkerStatus_Busy)
+			})
+		})
+
+		Convey("when job interrupted", func() {
+			for range tasks {
+				<-outputCh
+			}
+			wp.InterruptJobTasks("job-1")
+
+			Convey("then all tasks of job interrupted", func() {
+				interrupted := []string{(<-outputCh).GetInterrupt().TaskId, (<-outputCh).GetInterrupt().TaskId}
+				sort.Strings(interrupted)
+				So(interrupted, ShouldResemble, []string{tasks[1].Id, tasks[2].Id})
+			})
+		})
+	})
+}
+
+func TestWorkerPool_ShouldRemoveClosingWorkerWhenAllSlotsEnded(t *testing.T) {
+	Convey("given worker pool with worker running 2 tasks", t, func() {
+		wp := NewWorkerPool()
+		addr := "127.0.0.1:8081"
+		outputCh := make(chan *Msg, 3)
+		_ = wp.Add(addr, outputCh, &RegisterPayload{Slots: 3})
+
+		tasks := make([]*Task, 0, 2)
+		for i := 0; i < 2; i++ {
+			task := &Task{Id: "task-" + strconv.Itoa(i), JobId: "job-0", Ctx: &Context{InitData: Text("fake-data")}}
+			s, _ := wp.apply(task)
+			s.assign(task, func(s *slot, _ *StatusPayload) { wp.returnBack(s) }, func(*slot) {})
+			<-outputCh
+			tasks = append(tasks, task)
+		}
+
+		Convey("when worker closing and tasks finished one by one", func() {
+			wp.Close(addr)
+			_, foundFree := wp.apply(&Task{JobId: "job-1"})
+			_ = wp.UpdateStatus(addr, &StatusPayload{WorkStatus: WorkerStatus_Closing, TaskId: tasks[0].Id, TaskStatus: TaskStatus_Finished})
+			_, existAfterFirst := wp.pool[addr]
+			_ = wp.UpdateStatus(addr, &StatusPayload{WorkStatus: WorkerStatus_Closing, TaskId: tasks[1].Id, TaskStatus: TaskStatus_Finished})
+
+			Convey("then worker removed after the last task ended", func() {
+				So(foundFree, ShouldBeFalse)
+				So(existAfterFirst, ShouldBeTrue)
+				_, exist := wp.pool[addr]
+				So(exist, ShouldBeFalse)
+				So((<-outputCh).Cmd, ShouldEqual, CMD_Close)
+			})
+		})
+	})
+}
@@ -2,84 +2,294 @@ package main
 
 import (
 	"context"
+	"crypto/sha256"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/hex"
+	"flag"
+	"fmt"
 	"github.com/TD-Hackathon-2022/DCoB-Scheduler/api"
+	"github.com/TD-Hackathon-2022/DCoB-Scheduler/auth"
 	"github.com/TD-Hackathon-2022/DCoB-Scheduler/comm"
+	"github.com/TD-Hackathon-2022/DCoB-Scheduler/config"
 	"github.com/TD-Hackathon-2022/DCoB-Scheduler/module"
 	"github.com/TD-Hackathon-2022/DCoB-Scheduler/module/job"
 	"github.com/gin-gonic/gin"
 	"github.com/gorilla/websocket"
 	"github.com/pkg/errors"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
 	"google.golang.org/protobuf/proto"
+	"io"
+	"io/ioutil"
 	"math/rand"
 	"net"
 	"net/http"
 	"os"
 	"os/signal"
+	"path/filepath"
 	"strconv"
+	"strings"
 	"syscall"
 	"time"
 )
 
 var (
 	log = comm.GetLogger()
+
+	websocketBytes = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: "dcob",
+		Name:      "websocket_bytes_total",
+		Help:      "Bytes of websocket messages exchanged with workers, by direction: in or out.",
+	}, []string{"direction"})
 )
 
 const (
-	addr                     = ":8080"
-	workerConnectUrl         = "/connect"
-	taskQueueCapacity        = 128
-	adminStartUrl            = "/admin/start"
-	adminShutdownUrl         = "/admin/shutdown"
-	adminRunMineJobUrl       = "/admin/job/run-mine"
-	adminRunCalPiJobUrl      = "/admin/job/run-pi"
-	adminInterruptCurrJobUrl = "/admin/job/interrupt-curr"
-	adminGetJobResultUrl     = "/admin/job/:id"
+	workerConnectUrl          = "/connect"
+	adminStartUrl             = "/admin/start"
+	adminShutdownUrl          = "/admin/shutdown"
+	adminRunMineJobUrl        = "/admin/job/run-mine"
+	adminRunCalPiJobUrl       = "/admin/job/run-pi"
+	adminRunGenericJobUrl     = "/admin/job/run"
+	adminInterruptCurrJobUrl  = "/admin/job/interrupt-curr"
+	adminGetJobResultUrl      = "/admin/job/:id"
+	adminListJobsUrl          = "/admin/jobs"
+	adminCancelJobUrl         = "/admin/job/:id"
+	adminPauseJobUrl          = "/admin/job/:id/pause"
+	adminResumeJobUrl         = "/admin/job/:id/resume"
+	adminJobEventsUrl         = "/admin/job/:id/events"
+	adminListWorkersUrl       = "/admin/workers"
+	adminUploadFuncUrl        = "/admin/funcs"
+	adminListFuncsUrl         = "/admin/funcs"
+	adminGetFuncUrl           = "/admin/funcs/:id"
+	adminIssueWorkerTokenUrl  = "/admin/worker-tokens"
+	adminListWorkerTokensUrl  = "/admin/worker-tokens"
+	adminRevokeWorkerTokenUrl = "/admin/worker-tokens/:id"
+	adminListBannedWorkersUrl = "/admin/banned-workers"
+	adminBanWorkerUrl         = "/admin/banned-workers/:id"
+	adminUnbanWorkerUrl       = "/admin/banned-workers/:id"
+	adminListReputationsUrl   = "/admin/reputations"
+	adminResetReputationUrl   = "/admin/reputations/:principal"
+	metricsUrl                = "/metrics"
+	builtinFuncVersion        = "builtin"
 )
 
-func BuildServer(wh *workerHandler, ah *adminHandler) *http.Server {
-	router := gin.Default()
+func BuildServer(conf *config.Config, guard *auth.Guard, wh *workerHandler, ah *adminHandler) (*http.Server, error) {
+	viewer, submitter, operator := guard.Require(auth.Viewer), guard.Require(auth.Submitter), guard.Require(auth.Operator)
+
+	router := gin.New()
+	router.Use(gin.LoggerWithFormatter(accessLog), gin.Recovery())
 	router.GET(workerConnectUrl, func(c *gin.Context) { wh.handle(c.Writer, c.Request) })
-	router.POST(adminStartUrl, ah.start)
-	router.POST(adminShutdownUrl, ah.shutdown)
-	router.POST(adminRunMineJobUrl, ah.runMinerJob)
-	router.POST(adminRunCalPiJobUrl, ah.runCalPiJob)
-	router.POST(adminInterruptCurrJobUrl, ah.interruptCurrentJob)
-	router.GET(adminGetJobResultUrl, ah.getJobInfo)
-	router.Static("/ui", "./ui")
-
-	return &http.Server{
-		Addr:    addr,
+	router.POST(adminStartUrl, operator, ah.start)
+	router.POST(adminShutdownUrl, operator, ah.shutdown)
+	router.POST(adminRunMineJobUrl, submitter, ah.runMinerJob)
+	router.POST(adminRunCalPiJobUrl, submitter, ah.runCalPiJob)
+	router.POST(adminRunGenericJobUrl, submitter, ah.runGenericJob)
+	router.POST(adminInterruptCurrJobUrl, operator, ah.interruptCurrentJob)
+	router.GET(adminGetJobResultUrl, viewer, ah.getJobInfo)
+	router.GET(adminListJobsUrl, viewer, ah.listJobs)
+	router.DELETE(adminCancelJobUrl, operator, ah.cancelJob)
+	router.POST(adminPauseJobUrl, operator, ah.pauseJob)
+	router.POST(adminResumeJobUrl, operator, ah.resumeJob)
+	router.GET(adminJobEventsUrl, viewer, ah.jobEvents)
+	router.GET(adminListWorkersUrl, viewer, ah.listWorkers)
+	router.POST(adminUploadFuncUrl, submitter, ah.uploadFunc)
+	router.GET(adminListFuncsUrl, viewer, ah.listFuncs)
+	router.GET(adminGetFuncUrl, viewer, ah.getFunc)
+	router.POST(adminIssueWorkerTokenUrl, operator, ah.issueWorkerToken)
+	router.GET(adminListWorkerTokensUrl, viewer, ah.listWorkerTokens)
+	router.DELETE(adminRevokeWorkerTokenUrl, operator, ah.revokeWorkerToken)
+	router.GET(adminListBannedWorkersUrl, viewer, ah.listBannedWorkers)
+	router.PUT(adminBanWorkerUrl, operator, ah.banWorker)
+	router.DELETE(adminUnbanWorkerUrl, operator, ah.unbanWorker)
+	router.GET(adminListReputationsUrl, viewer, ah.listReputations)
+	router.DELETE(adminResetReputationUrl, operator, ah.resetReputation)
+	router.GET(metricsUrl, viewer, gin.WrapH(promhttp.Handler()))
+	router.Static("/ui", conf.UIDir)
+
+	svr := &http.Server{
+		Addr:    conf.Addr,
 		Handler: router,
 	}
+
+	if conf.TLS.ClientCAFile != "" {
+		pem, err := ioutil.ReadFile(conf.TLS.ClientCAFile)
+		if err != nil {
+			return nil, errors.Wrap(err, "read client ca")
+		}
+
+		cas := x509.NewCertPool()
+		if !cas.AppendCertsFromPEM(pem) {
+			return nil, errors.Errorf("no cert found in client ca %s", conf.TLS.ClientCAFile)
+		}
+
+		// workers connect without cert, so cert is only verified if given
+		svr.TLSConfig = &tls.Config{ClientCAs: cas, ClientAuth: tls.VerifyClientCertIfGiven}
+	}
+	return svr, nil
+}
+
+// accessLog is the format of gin default logger, but without query of url, which may carry anything
+func accessLog(param gin.LogFormatterParams) string {
+	return fmt.Sprintf("[GIN] %v | %3d | %13v | %15s | %-7s %#v\n%s",
+		param.TimeStamp.Format("2006/01/02 - 15:04:05"),
+		param.StatusCode,
+		param.Latency,
+		param.ClientIP,
+		param.Method,
+		param.Request.URL.Path,
+		param.ErrorMessage,
+	)
+}
+
+// newGuard authenticates admin requests by credentials in config, denied ones are appended to audit log,
+// body of signed request beyond max size is rejected
+func newGuard(conf *config.AuthConfig, maxBodySize int64) (*auth.Guard, error) {
+	if conf.Disabled {
+		log.Warn("Admin auth disabled, admin API is open to anyone")
+		return auth.NewOpenGuard(), nil
+	}
+
+	authenticators := make([]auth.Authenticator, 0, 3)
+	if len(conf.Certs) > 0 {
+		principals := make(map[string]*auth.Principal)
+		for _, c := range conf.Certs {
+			role, _ := auth.ParseRole(c.Role)
+			principals[c.CommonName] = &auth.Principal{Name: c.CommonName, Role: role}
+		}
+		authenticators = append(authenticators, auth.NewCertAuthenticator(principals))
+	}
+
+	if len(conf.HMACKeys) > 0 {
+		keys := make(map[string]*auth.HMACKey)
+		for _, k := range conf.HMACKeys {
+			role, _ := auth.ParseRole(k.Role)
+			keys[k.KeyId] = &auth.HMACKey{Secret: []byte(k.Secret), Principal: &auth.Principal{Name: k.KeyId, Role: role}}
+		}
+		authenticators = append(authenticators, auth.NewHMACAuthenticator(keys, conf.MaxClockSkew, auth.WithMaxSignedBodySize(maxBodySize)))
+	}
+
+	if len(conf.Tokens) > 0 {
+		tokens := make(map[string]*auth.Principal)
+		for _, t := range conf.Tokens {
+			role, _ := auth.ParseRole(t.Role)
+			tokens[t.Token] = &auth.Principal{Name: t.Name, Role: role}
+		}
+		authenticators = append(authenticators, auth.NewTokenAuthenticator(tokens))
+	}
+
+	if len(authenticators) == 0 {
+		log.Warn("No admin credentials configured, admin API denies every request until auth configured or disabled")
+	}
+
+	var audit *auth.AuditLog
+	if conf.AuditLog != "" {
+		if err := os.MkdirAll(filepath.Dir(conf.AuditLog), 0755); err != nil {
+			return nil, errors.Wrap(err, "create audit log dir")
+		}
+
+		f, err := os.OpenFile(conf.AuditLog, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0600)
+		if err != nil {
+			return nil, errors.Wrap(err, "open audit log")
+		}
+		audit = auth.NewAuditLog(f)
+	}
+	return auth.NewGuard(audit, authenticators...), nil
+}
+
+// newAdmission admits workers by config, issued tokens and bans are kept in state file
+func newAdmission(conf *config.AdmissionConfig) (*auth.Admission, error) {
+	opts := []auth.AdmissionOption{
+		auth.WithAllowedOrigins(conf.AllowedOrigins...),
+		auth.WithMaxConnectionsPerIP(conf.MaxConnectionsPerIP),
+		auth.WithAdmissionState(conf.StatePath),
+	}
+	if conf.RequireToken {
+		opts = append(opts, auth.WithRequiredToken())
+	} else {
+		log.Warn("Worker admission token not required, any client can register as worker")
+	}
+	return auth.NewAdmission(opts...)
 }
 
 type workerHandler struct {
-	pool     *module.WorkerPool
-	upgrader websocket.Upgrader
+	pool             *module.WorkerPool
+	funcs            *module.FuncRegistry
+	admission        *auth.Admission
+	upgrader         websocket.Upgrader
+	heartbeatTimeout time.Duration
 }
 
 func (h *workerHandler) handle(w http.ResponseWriter, r *http.Request) {
+	// remote address rather than forwarded one, which is up to client
+	release, err := h.admission.Connect(r.RemoteAddr)
+	if err != nil {
+		log.Warnf("Connection rejected: %v", err)
+		http.Error(w, err.Error(), http.StatusTooManyRequests)
+		return
+	}
+	defer release()
+
 	c, err := h.upgrader.Upgrade(w, r, nil)
 	if err != nil {
 		log.Errorf("upgrade: %v", err)
 		return
 	}
+
+	s := &session{workerId: c.RemoteAddr().String(), remoteAddr: r.RemoteAddr, writeCh: make(chan *api.Msg)}
 	defer func() {
-		// clean worker pool when connection exit
-		h.pool.Remove(c.RemoteAddr().String())
+		// clean worker pool when connection exit, before write channel closed
+		h.pool.Remove(s.workerId, s.writeCh)
+		close(s.writeCh)
 		_ = c.Close()
 		log.Debugf("Connection closed: %s", c.RemoteAddr())
 	}()
 	log.Debugf("Connection established: %s", c.RemoteAddr())
 
-	writeCh := make(chan *api.Msg)
-	defer close(writeCh)
+	h.keepAlive(c, s)
+	go h.handleSend(c, s.writeCh)
+	h.handleRecv(c, s)
+}
+
+// session is the worker identity bound to a connection, worker id defaults to remote address until registered
+type session struct {
+	workerId   string
+	remoteAddr string
+	principal  string
+	registered bool
+	writeCh    chan *api.Msg
+}
+
+// keepAlive answers worker's pings, connection without any ping or msg within heartbeat timeout is regarded as dead
+func (h *workerHandler) keepAlive(c *websocket.Conn, s *session) {
+	if h.heartbeatTimeout <= 0 {
+		return
+	}
+
+	_ = c.SetReadDeadline(time.Now().Add(h.heartbeatTimeout))
+	c.SetPingHandler(func(appData string) error {
+		// banned idle worker is disconnected at its next ping
+		if err := h.checkBanned(s); err != nil {
+			h.reject(c, err)
+			return err
+		}
+
+		h.pool.Touch(s.workerId)
+		_ = c.SetReadDeadline(time.Now().Add(h.heartbeatTimeout))
 
-	go h.handleSend(c, writeCh)
-	h.handleRecv(c, writeCh)
+		err := c.WriteControl(websocket.PongMessage, []byte(appData), time.Now().Add(time.Second))
+		if err == websocket.ErrCloseSent {
+			return nil
+		} else if e, ok := err.(net.Error); ok && e.Timeout() {
+			return nil
+		}
+		return err
+	})
 }
 
 func (h *workerHandler) handleSend(c *websocket.Conn, writeCh chan *api.Msg) {
+	bytesOut := websocketBytes.WithLabelValues("out")
 	for msg := range writeCh {
 		marshaledData, err := proto.Marshal(msg)
 		if err != nil {
@@ -92,17 +302,29 @@ func (h *workerHandler) handleSend(c *websocket.Conn, writeCh chan *api.Msg) {
 			log.Errorf("write: %v", err)
 			break
 		}
+		bytesOut.Add(float64(len(marshaledData)))
 		log.Debugf("Msg sent: %v", msg)
 	}
+
+	// close to break the recv loop, and keep draining so that senders never block on a dead connection
+	_ = c.Close()
+	for range writeCh {
+	}
 }
 
-func (h *workerHandler) handleRecv(c *websocket.Conn, writeCh chan *api.Msg) {
+func (h *workerHandler) handleRecv(c *websocket.Conn, s *session) {
+	bytesIn := websocketBytes.WithLabelValues("in")
 	for {
 		mt, inputData, err := c.ReadMessage()
 		if err != nil {
 			log.Errorf("read: %v", err)
 			return
 		}
+		bytesIn.Add(float64(len(inputData)))
+
+		if h.heartbeatTimeout > 0 {
+			_ = c.SetReadDeadline(time.Now().Add(h.heartbeatTimeout))
+		}
 
 		if mt != websocket.BinaryMessage {
 			log.Error(errors.New("wrong message type"))
@@ -117,41 +339,126 @@ func (h *workerHandler) handleRecv(c *websocket.Conn, writeCh chan *api.Msg) {
 		}
 
 		log.Debugf("Msg recieved: %v", recvMsg)
-		err = h.dispatch(c.RemoteAddr(), recvMsg, writeCh)
-		if err != nil {
+		h.pool.Touch(s.workerId)
+		err = h.dispatch(s, recvMsg)
+		if errors.Cause(err) == auth.ErrAdmissionDenied {
+			h.reject(c, err)
+			return
+		} else if err != nil {
 			log.Errorf("dispatch: %v", err)
 			return
 		}
 	}
 }
 
-func (h *workerHandler) dispatch(addr net.Addr, inputMsg *api.Msg, outputCh chan *api.Msg) (err error) {
+// reject tells worker why it is disconnected by close frame, details are only logged
+func (h *workerHandler) reject(c *websocket.Conn, err error) {
+	log.Warnf("Worker rejected: %v", err)
+	closeMsg := websocket.FormatCloseMessage(websocket.ClosePolicyViolation, auth.ErrAdmissionDenied.Error())
+	_ = c.WriteControl(websocket.CloseMessage, closeMsg, time.Now().Add(time.Second))
+}
+
+func (h *workerHandler) checkBanned(s *session) error {
+	if s.registered && h.admission.Banned(s.workerId, s.principal) {
+		return errors.Wrapf(auth.ErrAdmissionDenied, "worker %s banned", s.workerId)
+	}
+	return nil
+}
+
+func (h *workerHandler) dispatch(s *session, inputMsg *api.Msg) (err error) {
+	if !s.registered && inputMsg.Cmd != api.CMD_Register && h.admission.TokenRequired() {
+		return errors.Wrapf(auth.ErrAdmissionDenied, "%s sends %s before register", s.workerId, inputMsg.Cmd)
+	}
+
+	if err := h.checkBanned(s); err != nil {
+		return err
+	}
+
 	switch inputMsg.Cmd {
 	case api.CMD_Register:
-		h.pool.Add(addr.String(), outputCh)
+		err = h.register(s, inputMsg.GetRegister())
 	case api.CMD_Close:
-		// TODO: handle
-		outputCh <- inputMsg
+		h.pool.Close(s.workerId)
+	case api.CMD_FetchFunc:
+		s.writeCh <- h.funcData(inputMsg.GetFetchFunc().GetFuncHash())
 	case api.CMD_Status:
-		err = h.pool.UpdateStatus(addr.String(), inputMsg.GetStatus())
+		err = h.pool.UpdateStatus(s.workerId, inputMsg.GetStatus())
+		if errors.Cause(err) == module.ErrStaleStatus {
+			log.Warnf("Ignore status: %v", err)
+			err = nil
+		}
 	default:
-		outputCh <- inputMsg
+		s.writeCh <- inputMsg
 	}
 
 	return err
 }
 
-func NewWorkerHandler(pool *module.WorkerPool) *workerHandler {
+// funcData answers worker which has no func of given hash cached, error is sent back instead of code if not found
+func (h *workerHandler) funcData(hash string) *api.Msg {
+	payload := &api.FuncDataPayload{FuncHash: hash}
+	code, err := h.funcs.Code(hash)
+	if err != nil {
+		log.Warnf("Fetch func: %v", err)
+		payload.Error = err.Error()
+	} else {
+		payload.Code = code
+	}
+
+	return &api.Msg{
+		Cmd:     api.CMD_FuncData,
+		Payload: &api.Msg_FuncData{FuncData: payload},
+	}
+}
+
+// register binds the connection to worker id from payload, legacy worker without payload is identified by remote address
+func (h *workerHandler) register(s *session, reg *api.RegisterPayload) error {
+	workerId := s.workerId
+	if reg.GetWorkerId() != "" {
+		workerId = reg.GetWorkerId()
+	}
+
+	if s.registered && workerId != s.workerId {
+		return errors.Errorf("connection already registered as worker %s, cannot register as %s", s.workerId, workerId)
+	}
+
+	if err := h.admission.Admit(workerId, s.remoteAddr, reg.GetAdmissionToken()); err != nil {
+		return err
+	}
+
+	// reputation is kept by what client can not choose freely, unlike worker id
+	principal := h.admission.Principal(s.remoteAddr, reg.GetAdmissionToken())
+	if err := h.pool.Add(workerId, s.writeCh, reg, module.WithPrincipal(principal)); err != nil {
+		return err
+	}
+
+	s.workerId = workerId
+	s.principal = principal
+	s.registered = true
+	log.Infof("Worker %s registered as %s, user agent: %s, protocol: %d", workerId, principal, reg.GetUserAgent(), reg.GetProtocolVersion())
+	return nil
+}
+
+func NewWorkerHandler(pool *module.WorkerPool, funcs *module.FuncRegistry, admission *auth.Admission, heartbeatTimeout time.Duration) *workerHandler {
 	return &workerHandler{
-		pool: pool,
+		pool:      pool,
+		funcs:     funcs,
+		admission: admission,
 		upgrader: websocket.Upgrader{
-			CheckOrigin: func(r *http.Request) bool { return true },
+			CheckOrigin: admission.CheckOrigin,
 		},
+		heartbeatTimeout: heartbeatTimeout,
 	}
 }
 
 type adminHandler struct {
-	jobRunner *module.JobRunner
+	jobRunner         *module.JobRunner
+	pool              *module.WorkerPool
+	funcs             *module.FuncRegistry
+	admission         *auth.Admission
+	retry             *module.RetryPolicy
+	maxFuncSize       int64
+	keepAliveInterval time.Duration
 }
 
 func (h *adminHandler) start(_ *gin.Context) {
@@ -168,27 +475,371 @@ func (h *adminHandler) runMinerJob(c *gin.Context) {
 		difficulty = d
 	}
 
-	minerJob := job.NewHashMiner(difficulty)
+	// miner runs built-in func of worker only
+	opts, err := h.jobOptions(c, "func")
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	minerJob := job.NewHashMiner(difficulty, opts...)
 	h.jobRunner.Submit(minerJob)
 
 	c.JSON(http.StatusCreated, minerJob.Id())
 }
 
 func (h *adminHandler) runCalPiJob(c *gin.Context) {
-	calPi := job.NewCalPi()
+	opts, err := h.jobOptions(c)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	calPi := job.NewCalPi(opts...)
 	h.jobRunner.Submit(calPi)
 
 	c.JSON(http.StatusCreated, calPi.Id())
 }
 
+// runGenericJob runs job defined by JSON spec in request body, func of spec must be registered
+func (h *adminHandler) runGenericJob(c *gin.Context) {
+	// generic job runs func of spec, and ends once every input reported back, there is no proof to check
+	opts, err := h.jobOptions(c, "maxTasks", "target", "func", "proofCheck")
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	spec := &job.JobSpec{}
+	if err := c.ShouldBindJSON(spec); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	if _, exist := h.funcs.Resolve(spec.Func); !exist {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "func not found: " + spec.Func})
+		return
+	}
+
+	genericJob, err := job.NewGenericJob(spec, opts...)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	h.jobRunner.Submit(genericJob)
+	c.JSON(http.StatusCreated, genericJob.Id())
+}
+
+// jobOptions parse job priority, fair share weight and bounds from request, tasks are retried by configured policy,
+// options given but not supported by the kind of job are rejected rather than silently ignored
+func (h *adminHandler) jobOptions(c *gin.Context, unsupported ...string) ([]job.Option, error) {
+	query := c.Request.URL.Query()
+	for _, name := range unsupported {
+		if _, given := query[name]; given {
+			return nil, errors.Errorf("option %s is not supported by this kind of job", name)
+		}
+	}
+
+	opts := []job.Option{job.WithRetryPolicy(h.retry)}
+	if p, err := strconv.Atoi(query.Get("priority")); err == nil {
+		opts = append(opts, job.WithPriority(p))
+	}
+
+	if w, err := strconv.Atoi(query.Get("weight")); err == nil {
+		opts = append(opts, job.WithWeight(w))
+	}
+
+	if n, err := strconv.ParseUint(query.Get("maxTasks"), 10, 64); err == nil {
+		opts = append(opts, job.WithMaxTasks(n))
+	}
+
+	if t, err := strconv.ParseFloat(query.Get("target"), 64); err == nil {
+		opts = append(opts, job.WithTarget(t))
+	}
+
+	if d, err := time.ParseDuration(query.Get("timeout")); err == nil {
+		opts = append(opts, job.WithDeadline(time.Now().Add(d)))
+	}
+
+	if cores, err := strconv.Atoi(query.Get("minCores")); err == nil {
+		opts = append(opts, job.WithMinCores(cores))
+	}
+
+	if funcId := query.Get("func"); funcId != "" {
+		opts = append(opts, job.WithFunc(funcId))
+	}
+
+	// e.g. verifyShare=0.1&replicas=3&quorum=2 runs one in ten tasks on 3 workers, 2 of them should agree
+	if share, err := strconv.ParseFloat(query.Get("verifyShare"), 64); err == nil {
+		replicas, _ := strconv.Atoi(query.Get("replicas"))
+		quorum, _ := strconv.Atoi(query.Get("quorum"))
+		opts = append(opts, job.WithVerification(share, replicas, quorum))
+	}
+
+	// proofCheck=true verifies results are valid proofs, only for workers report them, see doc/message.md
+	if check, _ := strconv.ParseBool(query.Get("proofCheck")); check {
+		opts = append(opts, job.WithProofCheck())
+	}
+
+	return opts, nil
+}
+
 func (h *adminHandler) interruptCurrentJob(_ *gin.Context) {
 	h.jobRunner.InterruptCurrentJob()
 }
 
+func (h *adminHandler) listWorkers(c *gin.Context) {
+	c.JSON(http.StatusOK, h.pool.ListWorkers())
+}
+
+func (h *adminHandler) listJobs(c *gin.Context) {
+	states := make([]module.JobState, 0)
+	for _, state := range c.QueryArray("state") {
+		states = append(states, module.JobState(state))
+	}
+
+	c.JSON(http.StatusOK, h.jobRunner.ListJobs(states...))
+}
+
+func (h *adminHandler) cancelJob(c *gin.Context) {
+	respondJobOperation(c, h.jobRunner.CancelJob(c.Param("id")))
+}
+
+func (h *adminHandler) pauseJob(c *gin.Context) {
+	respondJobOperation(c, h.jobRunner.PauseJob(c.Param("id")))
+}
+
+func (h *adminHandler) resumeJob(c *gin.Context) {
+	respondJobOperation(c, h.jobRunner.ResumeJob(c.Param("id")))
+}
+
+// jobEvents streams task status changes and job updates as server-sent events, until job ended or client gone
+func (h *adminHandler) jobEvents(c *gin.Context) {
+	jobId := c.Param("id")
+	j, exist := h.jobRunner.GetJobById(jobId)
+	if !exist {
+		c.Status(http.StatusNotFound)
+		return
+	}
+
+	events, cancel := h.jobRunner.Subscribe(jobId)
+	defer cancel()
+
+	// current state goes first, so client needs no extra request
+	state, _ := h.jobRunner.GetJobState(jobId)
+	c.SSEvent(module.JobEventType, module.NewJobEvent(j, state))
+	c.Writer.Flush()
+	if state.Terminal() {
+		return
+	}
+
+	keepAlive := time.NewTicker(h.keepAliveInterval)
+	defer keepAlive.Stop()
+	c.Stream(func(w io.Writer) bool {
+		select {
+		case e := <-events:
+			c.SSEvent(e.Type, e)
+			return e.Job == nil || !e.Job.State.Terminal()
+		case <-keepAlive.C:
+			_, err := w.Write([]byte(": keep-alive\n\n"))
+			return err == nil
+		case <-c.Request.Context().Done():
+			return false
+		}
+	})
+}
+
+func respondJobOperation(c *gin.Context, err error) {
+	switch errors.Cause(err) {
+	case nil:
+		c.Status(http.StatusAccepted)
+	case module.ErrJobNotFound:
+		c.Status(http.StatusNotFound)
+	case module.ErrJobStateConflict:
+		c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+	default:
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+	}
+}
+
+// uploadFunc stores WASM module of multipart form field "module" as version of func
+func (h *adminHandler) uploadFunc(c *gin.Context) {
+	file, err := c.FormFile("module")
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	if file.Size > h.maxFuncSize {
+		c.JSON(http.StatusRequestEntityTooLarge, gin.H{"error": "module too large"})
+		return
+	}
+
+	f, err := file.Open()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	defer f.Close()
+
+	code, err := ioutil.ReadAll(f)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	fn, err := h.funcs.Register(c.PostForm("name"), c.PostForm("version"), code)
+	switch errors.Cause(err) {
+	case nil:
+		c.JSON(http.StatusCreated, fn)
+	case module.ErrInvalidFunc:
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+	case module.ErrFuncConflict:
+		c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+	default:
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+	}
+}
+
+func (h *adminHandler) listFuncs(c *gin.Context) {
+	c.JSON(http.StatusOK, h.funcs.List())
+}
+
+func (h *adminHandler) getFunc(c *gin.Context) {
+	fn, exist := h.funcs.Resolve(c.Param("id"))
+	if !exist {
+		c.Status(http.StatusNotFound)
+		return
+	}
+
+	c.JSON(http.StatusOK, fn)
+}
+
+// workerTokenRequest issues token of given worker, or any worker if worker id is empty, ttl is duration like 720h,
+// token never expires without ttl
+type workerTokenRequest struct {
+	WorkerId string `json:"workerId"`
+	Note     string `json:"note"`
+	TTL      string `json:"ttl"`
+}
+
+// issuedWorkerToken carries secret of token, which is only returned once
+type issuedWorkerToken struct {
+	Token string `json:"token"`
+	*auth.WorkerToken
+}
+
+func (h *adminHandler) issueWorkerToken(c *gin.Context) {
+	req := &workerTokenRequest{}
+	if err := c.ShouldBindJSON(req); err != nil && err != io.EOF {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	var ttl time.Duration
+	if req.TTL != "" {
+		var err error
+		if ttl, err = time.ParseDuration(req.TTL); err != nil || ttl <= 0 {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "ttl should be positive duration like 720h"})
+			return
+		}
+	}
+
+	token, t, err := h.admission.IssueToken(req.WorkerId, req.Note, principalName(c), ttl)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusCreated, &issuedWorkerToken{Token: token, WorkerToken: t})
+}
+
+func (h *adminHandler) listWorkerTokens(c *gin.Context) {
+	c.JSON(http.StatusOK, h.admission.Tokens())
+}
+
+func (h *adminHandler) revokeWorkerToken(c *gin.Context) {
+	switch err := h.admission.RevokeToken(c.Param("id")); errors.Cause(err) {
+	case nil:
+		c.Status(http.StatusNoContent)
+	case auth.ErrWorkerTokenNotFound:
+		c.Status(http.StatusNotFound)
+	default:
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+	}
+}
+
+func (h *adminHandler) listBannedWorkers(c *gin.Context) {
+	c.JSON(http.StatusOK, h.admission.Bans())
+}
+
+// banWorker rejects worker from registering again, along with its principal (given, or of the worker if connected),
+// and evicts workers banned from pool so that their running tasks are re-dispatched
+func (h *adminHandler) banWorker(c *gin.Context) {
+	workerId := c.Param("id")
+	principal := c.Query("principal")
+	workers := h.pool.ListWorkers()
+	for _, w := range workers {
+		if w.Id == workerId && principal == "" {
+			principal = w.Principal
+		}
+	}
+
+	ban, err := h.admission.Ban(workerId, principal, c.Query("reason"), principalName(c))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	for _, w := range workers {
+		if (w.Id == workerId || (principal != "" && w.Principal == principal)) && h.pool.Evict(w.Id) {
+			log.Infof("Worker %s banned as %s and evicted", w.Id, principal)
+		}
+	}
+	c.JSON(http.StatusOK, ban)
+}
+
+func (h *adminHandler) unbanWorker(c *gin.Context) {
+	switch err := h.admission.Unban(c.Param("id")); errors.Cause(err) {
+	case nil:
+		c.Status(http.StatusNoContent)
+	case auth.ErrBanNotFound:
+		c.Status(http.StatusNotFound)
+	default:
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+	}
+}
+
+func (h *adminHandler) listReputations(c *gin.Context) {
+	c.JSON(http.StatusOK, h.pool.Reputations())
+}
+
+// resetReputation trusts worker principal again before its reputation recovers by time
+func (h *adminHandler) resetReputation(c *gin.Context) {
+	principal := c.Param("principal")
+	if !h.pool.ResetReputation(principal) {
+		c.Status(http.StatusNotFound)
+		return
+	}
+
+	log.Infof("Reputation of worker principal %s reset by %s", principal, principalName(c))
+	c.Status(http.StatusNoContent)
+}
+
+// principalName is name of authenticated admin, empty if admin auth is disabled
+func principalName(c *gin.Context) string {
+	if p := auth.PrincipalOf(c); p != nil {
+		return p.Name
+	}
+	return ""
+}
+
 type uiData struct {
-	Coins  int   `json:"coins,omitempty"`
-	Hashes int   `json:"hashes,omitempty"`
-	Now    int64 `json:"now,omitempty"`
+	Coins  int             `json:"coins,omitempty"`
+	Hashes int             `json:"hashes,omitempty"`
+	Now    int64           `json:"now,omitempty"`
+	State  module.JobState `json:"state,omitempty"`
 }
 
 func (h *adminHandler) getJobInfo(c *gin.Context) {
@@ -200,9 +851,10 @@ func (h *adminHandler) getJobInfo(c *gin.Context) {
 	}
 
 	result := j.GetResult()
-	switch j.(type) {
+	state, _ := h.jobRunner.GetJobState(jobId)
+	switch j := j.(type) {
 	case *job.HashMiner:
-		d := &uiData{Coins: len(result), Hashes: len(result), Now: time.Now().Unix()}
+		d := &uiData{Coins: j.HashCount(), Hashes: j.HashCount(), Now: time.Now().Unix(), State: state}
 		/*d := &uiData{Hashes: make([]string, 0, len(result)), Now: time.Now().Unix()}
 		for _, v := range result {
 			hashBytes, err := base64.StdEncoding.DecodeString(v.(string))
@@ -212,35 +864,123 @@ func (h *adminHandler) getJobInfo(c *gin.Context) {
 			d.Hashes = append(d.Hashes, fmt.Sprintf("%x", hashBytes))
 		}*/
 		c.JSON(http.StatusOK, d)
-	case *job.CalPi:
+	case *job.CalPi, *job.GenericJob:
+		result["state"] = state
 		c.JSON(http.StatusOK, result)
 	}
 }
 
-func NewAdminHandler(taskQ chan<- *module.Task, store module.JobStore) *adminHandler {
+func NewAdminHandler(conf *config.Config, taskQ chan<- *module.Task, decider *module.Decider, store module.JobStore, pool *module.WorkerPool, funcs *module.FuncRegistry, admission *auth.Admission) *adminHandler {
 	return &adminHandler{
-		jobRunner: module.NewJobRunner(taskQ, store),
+		jobRunner:         module.NewJobRunner(taskQ, store, module.WithJobQueueCapacity(conf.Queue.JobCapacity), module.WithJobInterrupter(decider.InterruptJob)),
+		pool:              pool,
+		funcs:             funcs,
+		admission:         admission,
+		retry:             conf.Retry.RetryPolicy(),
+		maxFuncSize:       conf.Funcs.MaxSize,
+		keepAliveInterval: conf.Events.KeepAliveInterval,
+	}
+}
+
+// registerBuiltinFuncs registers WASM modules shipped with scheduler, e.g. monte_carlo_pi_bg.wasm as custom-func-monte_carlo_pi
+func registerBuiltinFuncs(funcs *module.FuncRegistry, dir string) {
+	paths, _ := filepath.Glob(filepath.Join(dir, "*.wasm"))
+	for _, path := range paths {
+		code, err := ioutil.ReadFile(path)
+		if err != nil {
+			log.Errorf("read builtin func %s: %v", path, err)
+			continue
+		}
+
+		name := "custom-func-" + strings.TrimSuffix(strings.TrimSuffix(filepath.Base(path), ".wasm"), "_bg")
+		sum := sha256.Sum256(code)
+		version := builtinFuncVersion + "-" + hex.EncodeToString(sum[:4])
+		if _, err := funcs.Register(name, version, code); err != nil {
+			log.Errorf("register builtin func %s: %v", path, err)
+		}
 	}
 }
 
 func main() {
+	conf, err := config.Load(os.Args[1:])
+	if err == flag.ErrHelp {
+		return
+	} else if err != nil {
+		fmt.Fprintf(os.Stderr, "load config: %v\n", err)
+		os.Exit(2)
+	}
+
+	comm.InitLogger(comm.WithLoggerLevel(conf.Log.Level), comm.WithLoggerFile(conf.Log.File))
 	rand.Seed(time.Now().Unix())
 
-	taskQ := make(chan *module.Task, taskQueueCapacity)
-	pool := module.NewWorkerPool()
-	decider := module.NewDecider(pool, taskQ)
+	shutdownTracer, err := comm.InitTracer(
+		comm.WithOTLPEndpoint(conf.Tracing.OTLPEndpoint),
+		comm.WithTraceFile(conf.Tracing.File))
+	if err != nil {
+		log.Fatalf("init tracer: %v", err)
+	}
+
+	taskQ := make(chan *module.Task, conf.Queue.TaskCapacity)
+	pool := module.NewWorkerPool(module.WithCloseGracePeriod(conf.Schedule.CloseGracePeriod),
+		module.WithMinReputation(conf.Verify.MinReputation), module.WithReputationHalfLife(conf.Verify.ReputationHalfLife))
+	policy, err := module.NewSchedulePolicy(conf.Schedule.Policy)
+	if err != nil {
+		log.Fatalf("init schedule policy: %v", err)
+	}
+
+	funcs, err := module.NewFuncRegistry(conf.Funcs.RegistryPath)
+	if err != nil {
+		log.Fatalf("open func registry: %v", err)
+	}
+	registerBuiltinFuncs(funcs, conf.Funcs.BuiltinDir)
+	prometheus.MustRegister(module.NewPoolCollector(pool, taskQ))
+
+	decider := module.NewDecider(pool, taskQ,
+		module.WithSchedulePolicy(policy),
+		module.WithTaskTimeout(conf.Schedule.TaskTimeout),
+		module.WithFuncRegistry(funcs))
 	go decider.Start()
 
-	store := module.NewSimpleStore()
-	svr := BuildServer(
-		NewWorkerHandler(pool),
-		NewAdminHandler(taskQ, store))
-	go log.Fatal(svr.ListenAndServe())
+	store, err := module.NewFileStore(conf.Store.Path, conf.Store.FlushInterval,
+		module.WithCompactThreshold(conf.Store.CompactSize))
+	if err != nil {
+		log.Fatalf("open job store: %v", err)
+	}
+
+	// func upload is the largest admin request, 1MB is left for multipart overhead
+	guard, err := newGuard(&conf.Auth, conf.Funcs.MaxSize+1<<20)
+	if err != nil {
+		log.Fatalf("init admin auth: %v", err)
+	}
 
-	waitToShutdown(svr)
+	admission, err := newAdmission(&conf.Admission)
+	if err != nil {
+		log.Fatalf("init worker admission: %v", err)
+	}
+
+	svr, err := BuildServer(conf, guard,
+		NewWorkerHandler(pool, funcs, admission, conf.Schedule.HeartbeatTimeout),
+		NewAdminHandler(conf, taskQ, decider, store, pool, funcs, admission))
+	if err != nil {
+		log.Fatalf("build server: %v", err)
+	}
+
+	go func() {
+		var err error
+		if conf.TLS.CertFile != "" {
+			err = svr.ListenAndServeTLS(conf.TLS.CertFile, conf.TLS.KeyFile)
+		} else {
+			err = svr.ListenAndServe()
+		}
+		if err != http.ErrServerClosed {
+			log.Fatal(err)
+		}
+	}()
+
+	waitToShutdown(svr, store, shutdownTracer)
 }
 
-func waitToShutdown(server *http.Server) {
+func waitToShutdown(server *http.Server, store module.JobStore, shutdownTracer func(context.Context) error) {
 	done := make(chan os.Signal, 1)
 	signal.Notify(done, os.Interrupt, syscall.SIGINT, syscall.SIGTERM)
 
@@ -248,4 +988,10 @@ func waitToShutdown(server *http.Server) {
 	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
 	defer cancel()
 	_ = server.Shutdown(ctx)
+	if err := store.Close(); err != nil {
+		log.Errorf("close job store: %v", err)
+	}
+	if err := shutdownTracer(ctx); err != nil {
+		log.Errorf("shutdown tracer: %v", err)
+	}
 }